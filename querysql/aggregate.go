@@ -0,0 +1,116 @@
+package querysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithAggregatedRows makes the logger log all the rows of a log select as a single entry,
+// instead of one entry per row. The message of the entry is the rows rendered as a text table,
+// with at most `maxRows` rows, and the field `rows` is the number of rows of the select.
+// The entry is logged at the most severe level of the rows. Query tag columns, see
+// WithQueryName, are logged as fields rather than in the table. `maxRows` <= 0 disables
+// aggregation, which is the default.
+func WithAggregatedRows(maxRows int) LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.maxAggregatedRows = maxRows
+	}
+}
+
+// aggregatedEntry is the entry for all the rows of a log select, see WithAggregatedRows
+type aggregatedEntry struct {
+	// level is the most severe valid level of the rows; levelOK is false if no row had one
+	level   logrus.Level
+	levelOK bool
+	rows    int
+	table   string
+	// tagColumns and tagValues are the query tag columns, see WithQueryName
+	tagColumns []string
+	tagValues  []string
+}
+
+// aggregateRows reads all of `rows` into a single entry, leaving out the rows below the level of
+// WithMinLogLevel. It returns nil if there are no rows to log, and whether there were any rows.
+func (cfg *loggerConfig) aggregateRows(rows *sql.Rows, info *logSetInfo, cols []string, colTypes []*sql.ColumnType) (*aggregatedEntry, bool, error) {
+	entry := &aggregatedEntry{}
+	var tableCols []int
+	for i, col := range cols {
+		if tag, ok := info.tagValue(col); ok {
+			entry.tagColumns = append(entry.tagColumns, cols[i])
+			entry.tagValues = append(entry.tagValues, tag)
+		} else {
+			tableCols = append(tableCols, i)
+		}
+	}
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	line := make([]string, 0, len(tableCols))
+	for _, i := range tableCols {
+		line = append(line, cols[i])
+	}
+	_, _ = fmt.Fprintln(w, strings.Join(line, "\t"))
+
+	var logLevel string
+	fields := make([]interface{}, len(cols))
+	scanPointers := make([]interface{}, len(cols))
+	scanPointers[0] = &logLevel
+	for i := 1; i < len(cols); i++ {
+		scanPointers[i] = &fields[i]
+	}
+	hadRow := false
+	for rows.Next() {
+		hadRow = true
+		if err := rows.Scan(scanPointers...); err != nil {
+			return nil, hadRow, err
+		}
+		level, err := cfg.parseLevel(logLevel)
+		if err == nil && info.belowMinLevel(level) {
+			continue
+		}
+		entry.rows++
+		if err == nil && (!entry.levelOK || level < entry.level) {
+			entry.level, entry.levelOK = level, true
+		}
+		if entry.rows > cfg.maxAggregatedRows {
+			continue
+		}
+
+		line = line[:0]
+		for _, i := range tableCols {
+			if i == 0 {
+				line = append(line, logLevel)
+				continue
+			}
+			value := fields[i]
+			if !info.isRedacted(cols[i]) {
+				if value, err = cfg.logValue(value, colTypes[i].DatabaseTypeName()); err != nil {
+					return nil, hadRow, err
+				}
+			}
+			if value == nil {
+				value = "NULL"
+			}
+			line = append(line, fmt.Sprint(value))
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(line, "\t"))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, hadRow, err
+	}
+	if entry.rows == 0 {
+		return nil, hadRow, nil
+	}
+	if err := w.Flush(); err != nil {
+		return nil, hadRow, err
+	}
+	if omitted := entry.rows - cfg.maxAggregatedRows; omitted > 0 {
+		_, _ = fmt.Fprintf(&table, "…(%d more rows)\n", omitted)
+	}
+	entry.table = strings.TrimRight(table.String(), "\n")
+	return entry, hadRow, nil
+}
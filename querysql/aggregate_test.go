@@ -0,0 +1,57 @@
+package querysql
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregatedRows(t *testing.T) {
+	set := &bufferedSet{
+		columns:       []string{"_log", "name", "amount"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT"},
+		rows: [][]any{
+			{"info", "alice", int64(10)},
+			{"warning", "bob", nil},
+			{"debug", "carol", int64(1000)},
+		},
+	}
+	logSet := func(logger RowsLogger) {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		require.NoError(t, logger(rows))
+		require.NoError(t, rows.Close())
+	}
+
+	var buf bytes.Buffer
+	logSet(StdMSSQLLogger(log.New(&buf, "", 0), WithAggregatedRows(2)))
+	assert.Equal(t, ""+
+		"level=warning rows=3\n"+
+		"_log     name   amount\n"+
+		"info     alice  10\n"+
+		"warning  bob    NULL\n"+
+		"…(1 more rows)\n", buf.String())
+
+	logger, hook := test.NewNullLogger()
+	logSet(LogrusMSSQLLogger(logger, logrus.InfoLevel, WithAggregatedRows(10)))
+	require.Len(t, hook.Entries, 1)
+	assert.Equal(t, logrus.WarnLevel, hook.Entries[0].Level)
+	assert.Equal(t, logrus.Fields{"rows": 3}, hook.Entries[0].Data)
+	assert.Equal(t, ""+
+		"_log     name   amount\n"+
+		"info     alice  10\n"+
+		"warning  bob    NULL\n"+
+		"debug    carol  1000", hook.Entries[0].Message)
+
+	// Empty log selects are logged as without aggregation
+	hook.Reset()
+	set.rows = nil
+	logSet(LogrusMSSQLLogger(logger, logrus.InfoLevel, WithAggregatedRows(10)))
+	require.Len(t, hook.Entries, 1)
+	assert.Equal(t, logrus.Fields{"_norows": true, "name": "", "amount": ""}, hook.Entries[0].Data)
+}
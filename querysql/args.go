@@ -0,0 +1,68 @@
+package querysql
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var parameterNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// expandArgs replaces a map[string]any in `args` with one sql.NamedArg per key, so that
+//
+//	querysql.Slice[int](ctx, db, `select @a + @b`, map[string]any{"a": 1, "b": 2})
+//
+// passes the parameters @a and @b. The map may only be combined with other named parameters,
+// and not with one of the same name.
+func expandArgs(args []any) ([]any, error) {
+	var params map[string]any
+	var named []string
+	positional := 0
+	for _, arg := range args {
+		switch typedArg := arg.(type) {
+		case map[string]any:
+			if params != nil {
+				return nil, fmt.Errorf("only a single map of named parameters can be passed")
+			}
+			params = typedArg
+		case sql.NamedArg:
+			named = append(named, typedArg.Name)
+		default:
+			positional++
+		}
+	}
+	if params == nil {
+		return args, nil
+	}
+	if positional > 0 {
+		return nil, fmt.Errorf("a map of named parameters cannot be mixed with positional parameters")
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if !parameterNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid parameter name '%s'; must be a letter followed by letters, digits or underscores", name)
+		}
+		for _, other := range named {
+			// SQL Server compares parameter names case-insensitively
+			if strings.EqualFold(name, other) {
+				return nil, fmt.Errorf("parameter '%s' is given both in the map of named parameters and as sql.Named", name)
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	expanded := make([]any, 0, len(args)-1+len(params))
+	for _, arg := range args {
+		if _, ok := arg.(map[string]any); !ok {
+			expanded = append(expanded, arg)
+		}
+	}
+	for _, name := range names {
+		expanded = append(expanded, sql.Named(name, params[name]))
+	}
+	return expanded, nil
+}
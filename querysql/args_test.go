@@ -0,0 +1,44 @@
+package querysql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandArgs(t *testing.T) {
+	// Without a map, args are passed through
+	args, err := expandArgs([]any{1, "two", sql.Named("three", 3)})
+	require.NoError(t, err)
+	assert.Equal(t, []any{1, "two", sql.Named("three", 3)}, args)
+
+	// Map entries become named parameters, sorted by name
+	args, err = expandArgs([]any{map[string]any{"b": 2, "a": "one", "c_3": nil}})
+	require.NoError(t, err)
+	assert.Equal(t, []any{sql.Named("a", "one"), sql.Named("b", 2), sql.Named("c_3", nil)}, args)
+
+	// ... and can be combined with other named parameters
+	args, err = expandArgs([]any{sql.Named("x", 1), map[string]any{"a": 2}})
+	require.NoError(t, err)
+	assert.Equal(t, []any{sql.Named("x", 1), sql.Named("a", 2)}, args)
+
+	_, err = expandArgs([]any{sql.Named("A", 1), map[string]any{"a": 2}})
+	assert.EqualError(t, err, "parameter 'a' is given both in the map of named parameters and as sql.Named")
+
+	_, err = expandArgs([]any{map[string]any{"a": 1}, 2})
+	assert.EqualError(t, err, "a map of named parameters cannot be mixed with positional parameters")
+
+	_, err = expandArgs([]any{map[string]any{"a": 1}, map[string]any{"b": 1}})
+	assert.EqualError(t, err, "only a single map of named parameters can be passed")
+
+	// database/sql rejects names not starting with a letter at query time, so we do it up front
+	_, err = expandArgs([]any{map[string]any{"_d": 1}})
+	assert.EqualError(t, err, "invalid parameter name '_d'; must be a letter followed by letters, digits or underscores")
+
+	for _, name := range []string{"", "1a", "@a", "-a", "_a", "a b", "a;drop table x"} {
+		_, err = expandArgs([]any{map[string]any{name: 1}})
+		assert.Error(t, err, name)
+	}
+}
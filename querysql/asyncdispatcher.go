@@ -0,0 +1,171 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncDispatcherOption configures AsyncDispatcher
+type AsyncDispatcherOption func(*asyncDispatcher)
+
+// AsyncDropWhenFull makes the dispatcher returned by AsyncDispatcher drop dispatcher selects
+// when the queue is full, counting them in `dropped`, instead of waiting for room in the queue
+func AsyncDropWhenFull(dropped *atomic.Int64) AsyncDispatcherOption {
+	return func(a *asyncDispatcher) {
+		a.dropped = dropped
+	}
+}
+
+// AsyncDispatcher returns a RowsGoDispatcher that reads the dispatcher select into memory and
+// returns, while up to `workers` goroutines pass the queued selects to `dispatcher`; so that slow
+// functions, e.g. pushing metrics to a remote backend, do not delay the query. When `queueSize`
+// selects are waiting for a goroutine, it waits for room in the queue, unless AsyncDropWhenFull
+// is given; use AsyncDispatcherCtx to give up when the context of the query is done.
+//
+// Since the functions are called after the select has been processed, their errors are not
+// returned by the query, but by the returned flush function. It waits until the queued selects
+// have been dispatched, or `ctx` is done, and returns the errors since the previous flush
+// combined with errors.Join; call it e.g. at shutdown and in tests. The goroutines exit when the
+// queue is empty, so there is nothing to close. AsyncDispatcher panics if `workers` is not
+// positive or `queueSize` is negative.
+func AsyncDispatcher(dispatcher RowsGoDispatcher, workers, queueSize int, opts ...AsyncDispatcherOption) (RowsGoDispatcher, func(ctx context.Context) error) {
+	a := newAsyncDispatcher(dispatcher, workers, queueSize, opts)
+	return func(rows *sql.Rows) error {
+		return a.dispatch(context.Background(), rows)
+	}, a.flush
+}
+
+// AsyncDispatcherCtx is like AsyncDispatcher, but returns a RowsGoDispatcherCtx that gives up
+// waiting for room in the queue with ctx.Err() when the context passed to New is done. Register
+// it with WithDispatcherCtx.
+func AsyncDispatcherCtx(dispatcher RowsGoDispatcher, workers, queueSize int, opts ...AsyncDispatcherOption) (RowsGoDispatcherCtx, func(ctx context.Context) error) {
+	a := newAsyncDispatcher(dispatcher, workers, queueSize, opts)
+	return a.dispatch, a.flush
+}
+
+type asyncDispatcher struct {
+	dispatcher RowsGoDispatcher
+	workers    int
+	dropped    *atomic.Int64
+	// slots has room for the selects being dispatched and those waiting in the queue
+	slots chan struct{}
+
+	mu sync.Mutex
+	// queue are the selects waiting for a goroutine
+	queue []*bufferedSet
+	// running is the number of goroutines started and not yet exited
+	running int
+	// pending is the number of selects queued or being dispatched
+	pending int
+	// idle is closed when pending drops to 0
+	idle chan struct{}
+	errs []error
+}
+
+func newAsyncDispatcher(dispatcher RowsGoDispatcher, workers, queueSize int, opts []AsyncDispatcherOption) *asyncDispatcher {
+	if workers <= 0 {
+		panic(fmt.Sprintf("AsyncDispatcher: workers must be positive, got %d", workers))
+	}
+	if queueSize < 0 {
+		panic(fmt.Sprintf("AsyncDispatcher: queueSize must not be negative, got %d", queueSize))
+	}
+	a := &asyncDispatcher{dispatcher: dispatcher, workers: workers, slots: make(chan struct{}, workers+queueSize)}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func (a *asyncDispatcher) dispatch(ctx context.Context, rows *sql.Rows) error {
+	set, err := readBufferedSet(rows)
+	if err != nil {
+		return err
+	}
+	if a.dropped == nil {
+		select {
+		case a.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		select {
+		case a.slots <- struct{}{}:
+		default:
+			a.dropped.Add(1)
+			return nil
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queue = append(a.queue, set)
+	if a.pending == 0 {
+		a.idle = make(chan struct{})
+	}
+	a.pending++
+	if a.running < a.workers {
+		a.running++
+		go a.work()
+	}
+	return nil
+}
+
+// work dispatches queued selects until the queue is empty
+func (a *asyncDispatcher) work() {
+	for {
+		a.mu.Lock()
+		if len(a.queue) == 0 {
+			a.running--
+			a.mu.Unlock()
+			return
+		}
+		set := a.queue[0]
+		a.queue[0] = nil
+		a.queue = a.queue[1:]
+		a.mu.Unlock()
+
+		rows, err := set.Rows()
+		if err == nil {
+			err = a.dispatcher(rows)
+			_ = rows.Close()
+		}
+		<-a.slots
+		a.done(err)
+	}
+}
+
+// done records that a select has been dispatched with the error `err`
+func (a *asyncDispatcher) done(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.errs = append(a.errs, err)
+	}
+	a.pending--
+	if a.pending == 0 {
+		close(a.idle)
+	}
+}
+
+func (a *asyncDispatcher) flush(ctx context.Context) error {
+	a.mu.Lock()
+	idle := a.idle
+	pending := a.pending
+	a.mu.Unlock()
+	if pending > 0 {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	errs := a.errs
+	a.errs = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,119 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncDispatcher(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	var calls atomic.Int64
+	errFailed := errors.New("failed")
+	slow := func(label string) error {
+		started <- struct{}{}
+		<-release
+		calls.Add(1)
+		if label == "fail" {
+			return errFailed
+		}
+		return nil
+	}
+	selectRows := func(label string) *sql.Rows {
+		set := &bufferedSet{
+			columns:       []string{"_function", "label"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+			rows:          [][]any{{"slow", label}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = rows.Close() })
+		return rows
+	}
+	funcs := NewDispatcherFuncs().Register("slow", slow)
+
+	t.Run("block", func(t *testing.T) {
+		calls.Store(0)
+		dispatcher, flush := AsyncDispatcher(funcs.Dispatcher(), 2, 1)
+		// returns before the function is called
+		require.NoError(t, dispatcher(selectRows("ok")))
+		require.NoError(t, dispatcher(selectRows("fail")))
+		assert.Equal(t, int64(0), calls.Load())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, flush(ctx), context.DeadlineExceeded)
+
+		close(release)
+		err := flush(context.Background())
+		assert.ErrorIs(t, err, errFailed)
+		assert.Equal(t, int64(2), calls.Load())
+		assert.NoError(t, flush(context.Background()))
+
+		// the dispatcher can be used after a flush
+		require.NoError(t, dispatcher(selectRows("ok")))
+		require.NoError(t, flush(context.Background()))
+		assert.Equal(t, int64(3), calls.Load())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		calls.Store(0)
+		release = make(chan struct{})
+		started = make(chan struct{}, 10)
+		dispatcher, flush := AsyncDispatcherCtx(funcs.Dispatcher(), 1, 0)
+		require.NoError(t, dispatcher(context.Background(), selectRows("ok")))
+		<-started
+
+		// the goroutine is busy and there is no queue, so the query waits until its context is done
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, dispatcher(ctx, selectRows("ok")), context.DeadlineExceeded)
+
+		close(release)
+		require.NoError(t, flush(context.Background()))
+		assert.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		calls.Store(0)
+		release = make(chan struct{})
+		started = make(chan struct{}, 10)
+		var dropped atomic.Int64
+		dispatcher, flush := AsyncDispatcher(funcs.Dispatcher(), 1, 1, AsyncDropWhenFull(&dropped))
+		require.NoError(t, dispatcher(selectRows("ok")))
+		// the goroutine has taken the first select, so the queue has room for one more
+		<-started
+		require.NoError(t, dispatcher(selectRows("ok")))
+		require.NoError(t, dispatcher(selectRows("ok")))
+		assert.Equal(t, int64(1), dropped.Load())
+
+		close(release)
+		require.NoError(t, flush(context.Background()))
+		assert.Equal(t, int64(2), calls.Load())
+	})
+
+	t.Run("idle", func(t *testing.T) {
+		a := newAsyncDispatcher(func(rows *sql.Rows) error { return nil }, 4, 4, nil)
+		for i := 0; i < 8; i++ {
+			require.NoError(t, a.dispatch(context.Background(), selectRows("ok")))
+		}
+		require.NoError(t, a.flush(context.Background()))
+		// the goroutines exit once the queue is empty
+		assert.Eventually(t, func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			return a.running == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	assert.PanicsWithValue(t, "AsyncDispatcher: workers must be positive, got 0", func() {
+		AsyncDispatcher(funcs.Dispatcher(), 0, 1)
+	})
+}
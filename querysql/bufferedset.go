@@ -0,0 +1,283 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// bufferedSet is a result set held in memory. RowsLogger and RowsGoDispatcher only know how to
+// consume a *sql.Rows, so to pass them data that querysql has generated itself (or read once and
+// wants to pass on to several consumers), the set is turned back into a *sql.Rows by Rows().
+type bufferedSet struct {
+	columns []string
+	// databaseTypes holds the DatabaseTypeName of each column
+	databaseTypes []string
+	rows          [][]any
+}
+
+// readBufferedSet reads the remaining rows of the current result set of `rows` into memory
+func readBufferedSet(rows *sql.Rows) (*bufferedSet, error) {
+	return readBufferedSetCtx(context.Background(), rows)
+}
+
+// readBufferedSetCtx is like readBufferedSet, but stops with the error of `ctx` if it is done,
+// checking it every ctxCheckInterval rows
+func readBufferedSetCtx(ctx context.Context, rows *sql.Rows) (*bufferedSet, error) {
+	set, err := newBufferedSet(rows)
+	if err != nil {
+		return nil, err
+	}
+	for n := 0; rows.Next(); n++ {
+		if n%ctxCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if err = set.ScanRow(rows); err != nil {
+			return nil, err
+		}
+	}
+	// A cancelled context makes database/sql close the rows, which ends the loop above early
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return set, rows.Err()
+}
+
+// newBufferedSet creates an empty set with the columns of the current result set of `rows`;
+// rows are added to it by using it as a Target
+func newBufferedSet(rows *sql.Rows) (*bufferedSet, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	set := &bufferedSet{
+		columns:       cols,
+		databaseTypes: make([]string, len(cols)),
+	}
+	for i, colType := range colTypes {
+		set.databaseTypes[i] = colType.DatabaseTypeName()
+	}
+	return set, nil
+}
+
+var _ Target = &bufferedSet{}
+
+// ScanRow appends the current row of `rows` to the set
+func (set *bufferedSet) ScanRow(rows *sql.Rows) error {
+	// Scanning into *any gives the value from the driver as is; []byte values are copied
+	fields := make([]any, len(set.columns))
+	scanPointers := make([]any, len(fields))
+	for i := range fields {
+		scanPointers[i] = &fields[i]
+	}
+	if err := rows.Scan(scanPointers...); err != nil {
+		return err
+	}
+	set.rows = append(set.rows, fields)
+	return nil
+}
+
+// newLogEntrySet creates a set with a single row following the RowsLogger protocol;
+// the log level goes in the first column, followed by the fields of the entry
+func newLogEntrySet(level string, columns []string, values []any) *bufferedSet {
+	set := &bufferedSet{
+		columns:       append([]string{"_log"}, columns...),
+		databaseTypes: make([]string, 0, len(columns)+1),
+	}
+	row := make([]any, 0, len(values)+1)
+	row = append(row, level)
+	set.databaseTypes = append(set.databaseTypes, "NVARCHAR")
+	for _, value := range values {
+		// Use the types a SQL Server driver would use for the value, so that RowsLogger
+		// implementations can treat these entries like any other
+		switch v := value.(type) {
+		case int:
+			value = int64(v)
+			set.databaseTypes = append(set.databaseTypes, "BIGINT")
+		case int64:
+			set.databaseTypes = append(set.databaseTypes, "BIGINT")
+		case float64:
+			set.databaseTypes = append(set.databaseTypes, "FLOAT")
+		case bool:
+			set.databaseTypes = append(set.databaseTypes, "BIT")
+		case time.Time:
+			set.databaseTypes = append(set.databaseTypes, "DATETIME2")
+		case []byte:
+			set.databaseTypes = append(set.databaseTypes, "VARBINARY")
+		default:
+			if v != nil {
+				value = fmt.Sprint(v)
+			}
+			set.databaseTypes = append(set.databaseTypes, "NVARCHAR")
+		}
+		row = append(row, value)
+	}
+	set.rows = [][]any{row}
+	return set
+}
+
+// Rows returns the set as a *sql.Rows. The caller must close it.
+func (set *bufferedSet) Rows() (*sql.Rows, error) {
+	return bufferedDB.QueryContext(context.Background(), "", set)
+}
+
+// logSetInfo tells the loggers of this package how querysql has changed a log select before
+// passing it on, where this can not be seen from the rows; in particular when there are none.
+// It is kept out of band, see replayToLogger, so that other RowsLoggers see the columns with
+// the types they were selected with.
+type logSetInfo struct {
+	// tag is the column added by WithQueryName or WithQueryTag, if any
+	tag *logTag
+	// redacted holds the names of the columns redacted by WithLogRedaction
+	redacted map[string]bool
+	// minLevel is the level set by WithMinLogLevel, if any
+	minLevel *logrus.Level
+}
+
+// replayedLogSets maps each *sql.Rows being passed to a logger by replayToLogger to its logSetInfo.
+// The entry is removed when the logger returns. Loggers that pass on other *sql.Rows, e.g. read
+// into memory, do not pass on the logSetInfo, except for MultiLogger.
+var replayedLogSets sync.Map
+
+// logSetInfoOf returns the logSetInfo of `rows` if they are being replayed by replayToLogger,
+// and nil otherwise. The methods of logSetInfo can be called on nil.
+func logSetInfoOf(rows *sql.Rows) *logSetInfo {
+	info, ok := replayedLogSets.Load(rows)
+	if !ok {
+		return nil
+	}
+	return info.(*logSetInfo)
+}
+
+// tagValue returns the value of the tag if `column` was added by WithQueryName or WithQueryTag
+func (info *logSetInfo) tagValue(column string) (string, bool) {
+	if info == nil || info.tag == nil || info.tag.field != column {
+		return "", false
+	}
+	return info.tag.value, true
+}
+
+// minLogLevel returns the level set by WithMinLogLevel, if any
+func (info *logSetInfo) minLogLevel() (logrus.Level, bool) {
+	if info == nil || info.minLevel == nil {
+		return 0, false
+	}
+	return *info.minLevel, true
+}
+
+// belowMinLevel tells whether rows at `level` are not to be logged because of WithMinLogLevel
+func (info *logSetInfo) belowMinLevel(level logrus.Level) bool {
+	minLevel, ok := info.minLogLevel()
+	return ok && level > minLevel
+}
+
+// isRedacted tells whether `column` was redacted by WithLogRedaction; its values are RedactedValue
+func (info *logSetInfo) isRedacted(column string) bool {
+	return info != nil && info.redacted[column]
+}
+
+// noRowsValue is the value logged for `column` in the entry for an empty log select;
+// the tag for WithQueryName, RedactedValue for redacted columns and otherwise ""
+func (info *logSetInfo) noRowsValue(column string) string {
+	if info.isRedacted(column) {
+		return RedactedValue
+	}
+	tag, _ := info.tagValue(column)
+	return tag
+}
+
+// bufferedDB is an in-process database/sql.DB whose only purpose is to serve a
+// bufferedSet, passed as the single query argument, as a *sql.Rows
+var bufferedDB = sql.OpenDB(bufferedConnector{})
+
+type bufferedConnector struct{}
+
+func (c bufferedConnector) Connect(context.Context) (driver.Conn, error) {
+	return bufferedConn{}, nil
+}
+
+func (c bufferedConnector) Driver() driver.Driver {
+	return bufferedDriver{}
+}
+
+type bufferedDriver struct{}
+
+func (d bufferedDriver) Open(string) (driver.Conn, error) {
+	return bufferedConn{}, nil
+}
+
+type bufferedConn struct{}
+
+var _ driver.QueryerContext = bufferedConn{}
+var _ driver.NamedValueChecker = bufferedConn{}
+
+func (c bufferedConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("bufferedConn: Prepare not supported")
+}
+
+func (c bufferedConn) Close() error {
+	return nil
+}
+
+func (c bufferedConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("bufferedConn: Begin not supported")
+}
+
+// CheckNamedValue accepts the *bufferedSet argument without conversion
+func (c bufferedConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c bufferedConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 1 {
+		return nil, errors.New("bufferedConn: expected a single *bufferedSet argument")
+	}
+	set, ok := args[0].Value.(*bufferedSet)
+	if !ok {
+		return nil, errors.New("bufferedConn: expected a single *bufferedSet argument")
+	}
+	return &bufferedRows{set: set}, nil
+}
+
+type bufferedRows struct {
+	set  *bufferedSet
+	next int
+}
+
+var _ driver.RowsColumnTypeDatabaseTypeName = &bufferedRows{}
+
+func (r *bufferedRows) Columns() []string {
+	return r.set.columns
+}
+
+func (r *bufferedRows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.set.databaseTypes[index]
+}
+
+func (r *bufferedRows) Close() error {
+	return nil
+}
+
+func (r *bufferedRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.set.rows) {
+		return io.EOF
+	}
+	for i, value := range r.set.rows[r.next] {
+		dest[i] = value
+	}
+	r.next++
+	return nil
+}
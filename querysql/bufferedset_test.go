@@ -0,0 +1,109 @@
+package querysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferedSetRoundTrip(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	set := newLogEntrySet("info",
+		[]string{"s", "i", "f", "b", "t", "bin", "null"},
+		[]any{"hello", 42, 1.5, true, at, []byte{1, 2}, nil},
+	)
+
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	cols, err := rows.Columns()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_log", "s", "i", "f", "b", "t", "bin", "null"}, cols)
+	colTypes, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	var typeNames []string
+	for _, colType := range colTypes {
+		typeNames = append(typeNames, colType.DatabaseTypeName())
+	}
+	assert.Equal(t, []string{"NVARCHAR", "NVARCHAR", "BIGINT", "FLOAT", "BIT", "DATETIME2", "VARBINARY", "NVARCHAR"}, typeNames)
+
+	// Reading it back gives the same set
+	readBack, err := readBufferedSet(rows)
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	assert.Equal(t, set, readBack)
+	assert.Equal(t, []any{"info", "hello", int64(42), 1.5, true, at, []byte{1, 2}, nil}, readBack.rows[0])
+
+	// And it can be replayed several times
+	for i := 0; i < 2; i++ {
+		rows, err = readBack.Rows()
+		require.NoError(t, err)
+		var level string
+		var s any
+		var n int
+		require.True(t, rows.Next())
+		dest := make([]any, len(cols))
+		dest[0], dest[1], dest[2] = &level, &s, &n
+		for j := 3; j < len(dest); j++ {
+			dest[j] = new(any)
+		}
+		require.NoError(t, rows.Scan(dest...))
+		assert.Equal(t, "info", level)
+		assert.Equal(t, "hello", s)
+		assert.Equal(t, 42, n)
+		assert.False(t, rows.Next())
+		require.NoError(t, rows.Close())
+	}
+}
+
+// replayedLogSetsLen returns the number of entries in replayedLogSets
+func replayedLogSetsLen() int {
+	n := 0
+	replayedLogSets.Range(func(any, any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestReplayedLogSetsEmptied(t *testing.T) {
+	set := &bufferedSet{
+		columns:       []string{"_log", "x", "secret"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"info", "a", "s"}, {"debug", "b", "s"}},
+	}
+	var buf bytes.Buffer
+	ctx := WithQueryTag(context.Background(), "query")
+	ctx = WithLogRedaction(ctx, func(column string) bool { return column == "secret" })
+	ctx = WithMinLogLevel(ctx, logrus.InfoLevel)
+
+	seen := 0
+	seeInfo := func(rows *sql.Rows) error {
+		if logSetInfoOf(rows) != nil {
+			seen++
+		}
+		_, err := readBufferedSet(rows)
+		return err
+	}
+	errFailed := errors.New("failed")
+	failing := func(rows *sql.Rows) error { return errFailed }
+	for _, logger := range []RowsLogger{
+		StdMSSQLLogger(log.New(&buf, "", 0)),
+		MultiLogger(seeInfo, StdMSSQLLogger(log.New(&buf, "", 0))),
+		MultiLogger(seeInfo, failing),
+		failing,
+	} {
+		_ = DrainAll(New(WithLogger(ctx, logger), bufferedDB, "buffered set", set))
+		assert.Equal(t, 0, replayedLogSetsLen())
+	}
+	// the settings reached the loggers while they ran
+	assert.Equal(t, 2, seen)
+	assert.Contains(t, buf.String(), "secret="+RedactedValue)
+}
@@ -0,0 +1,25 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+)
+
+var _ CtxQuerier = &sql.Conn{}
+
+// OnConn reserves a single connection from `db` and calls `f` with it, so that all queries
+// done through `q` run in the same session. This is needed when e.g. a temp table created
+// by one query is used by the next. The connection is returned to the pool when `f`
+// returns, also if it panics.
+func OnConn(ctx context.Context, db *sql.DB, f func(q CtxQuerier) error) (err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return f(conn)
+}
@@ -0,0 +1,50 @@
+package querysql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+func TestOnConn(t *testing.T) {
+	ctx := context.Background()
+	err := querysql.OnConn(ctx, sqldb, func(q querysql.CtxQuerier) error {
+		_, err := querysql.ExecContext(ctx, q, `
+create table #OnConn (X int);
+insert into #OnConn (X) values (1), (2);
+`)
+		require.NoError(t, err)
+
+		// Same session, so the temp table is still there
+		xs, err := querysql.Slice[int](ctx, q, `select X from #OnConn order by X`)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, xs)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, sqldb.Stats().InUse)
+
+	// Errors from the callback are returned
+	err = querysql.OnConn(ctx, sqldb, func(q querysql.CtxQuerier) error {
+		_, err := querysql.Single[int](ctx, q, `select X from #DoesNotExist`)
+		return err
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, sqldb.Stats().InUse)
+}
+
+func TestOnConnReleasesConnOnPanic(t *testing.T) {
+	ctx := context.Background()
+	func() {
+		defer func() {
+			assert.Equal(t, "boom", recover())
+		}()
+		_ = querysql.OnConn(ctx, sqldb, func(q querysql.CtxQuerier) error {
+			panic("boom")
+		})
+	}()
+	assert.Equal(t, 0, sqldb.Stats().InUse)
+}
@@ -1,6 +1,11 @@
 package querysql
 
 import (
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
 	"golang.org/x/net/context"
 )
 
@@ -8,6 +13,26 @@ type contextKey int
 
 const ckRowsLogger contextKey = 0
 const ckRowsDispatcher contextKey = 1
+const ckRetryPolicy contextKey = 2
+const ckQueryTimeout contextKey = 3
+const ckQueryEcho contextKey = 4
+const ckTimingLogs contextKey = 5
+const ckQueryName contextKey = 6
+const ckQueryTagField contextKey = 7
+const ckLogRedaction contextKey = 8
+const ckMinLogLevel contextKey = 9
+const ckLogSampling contextKey = 10
+const ckRowsLoggerCtx contextKey = 11
+const ckLogKey contextKey = 12
+const ckProgressLogger contextKey = 13
+const ckRowsDispatcherCtx contextKey = 14
+const ckDispatcherFuncs contextKey = 15
+const ckDispatchKey contextKey = 16
+const ckRowsMonitor contextKey = 17
+const ckDispatchResultLogger contextKey = 18
+const ckDispatchPayload contextKey = 19
+const ckNoQueryErrorContext contextKey = 20
+const ckSQLMessages contextKey = 21
 
 // WithLogger will return the context with a logger registered for use with querysql;
 // during queries, querysql will use Logger() to extract the logger from the context
@@ -23,6 +48,50 @@ func Logger(ctx context.Context) RowsLogger {
 	return nil
 }
 
+var defaultLogger atomic.Pointer[RowsLogger]
+
+// SetDefaultLogger registers a RowsLogger that New uses when the context has no logger, so that
+// it can be set up once at startup instead of on every context. Passing nil removes it.
+// It is safe to call concurrently with queries.
+func SetDefaultLogger(logger RowsLogger) {
+	if logger == nil {
+		defaultLogger.Store(nil)
+		return
+	}
+	defaultLogger.Store(&logger)
+}
+
+// DefaultLogger returns the logger registered by SetDefaultLogger, or nil
+func DefaultLogger() RowsLogger {
+	if logger := defaultLogger.Load(); logger != nil {
+		return *logger
+	}
+	return nil
+}
+
+// WithLoggerCtx is like WithLogger, but registers a RowsLoggerCtx, which is passed the
+// context given to New. It is used instead of the RowsLogger registered by WithLogger.
+func WithLoggerCtx(ctx context.Context, logger RowsLoggerCtx) context.Context {
+	return context.WithValue(ctx, ckRowsLoggerCtx, logger)
+}
+
+func LoggerCtx(ctx context.Context) RowsLoggerCtx {
+	l, _ := ctx.Value(ckRowsLoggerCtx).(RowsLoggerCtx)
+	return l
+}
+
+// WithLogKey returns a context that makes New trigger logging for a custom column name, such as
+// "loglevel", in addition to "_log"; see ResultSets.LogKeyLowercase. The key is compared
+// case-insensitively. WithRowsLogKey takes precedence over the key on the context.
+func WithLogKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ckLogKey, key)
+}
+
+func LogKey(ctx context.Context) string {
+	key, _ := ctx.Value(ckLogKey).(string)
+	return key
+}
+
 func WithDispatcher(ctx context.Context, dispatcher RowsGoDispatcher) context.Context {
 	return context.WithValue(ctx, ckRowsDispatcher, dispatcher)
 }
@@ -34,3 +103,221 @@ func Dispatcher(ctx context.Context) RowsGoDispatcher {
 	}
 	return nil
 }
+
+// WithDispatcherCtx is like WithDispatcher, but registers a RowsGoDispatcherCtx, which is passed
+// the context given to New. It is used instead of the RowsGoDispatcher registered by WithDispatcher.
+func WithDispatcherCtx(ctx context.Context, dispatcher RowsGoDispatcherCtx) context.Context {
+	return context.WithValue(ctx, ckRowsDispatcherCtx, dispatcher)
+}
+
+func DispatcherCtx(ctx context.Context) RowsGoDispatcherCtx {
+	d, _ := ctx.Value(ckRowsDispatcherCtx).(RowsGoDispatcherCtx)
+	return d
+}
+
+// WithDispatchKey returns a context that makes New trigger the dispatcher for a custom name of the
+// first column, such as "callback", in addition to "_function"; see
+// ResultSets.DispatchKeyLowercase. The key is compared case-insensitively. WithRowsDispatchKey
+// takes precedence over the key on the context.
+func WithDispatchKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ckDispatchKey, key)
+}
+
+func DispatchKey(ctx context.Context) string {
+	key, _ := ctx.Value(ckDispatchKey).(string)
+	return key
+}
+
+// WithAdditionalDispatcher registers a dispatcher calling the functions of `funcs` as well as
+// those of the DispatcherFuncs added earlier to `ctx` by WithAdditionalDispatcher, so that e.g.
+// a library can add its functions without replacing those of the application. Dispatcher
+// selects fail if more than one DispatcherFuncs has the function.
+// The dispatcher is registered as by WithDispatcherCtx. Rows calling a function that no
+// DispatcherFuncs has are passed on to the dispatcher registered on `ctx` by WithDispatcherCtx
+// or WithDispatcher before the first call to WithAdditionalDispatcher, if any; otherwise the
+// dispatcher select fails.
+func WithAdditionalDispatcher(ctx context.Context, funcs *DispatcherFuncs) context.Context {
+	previous, ok := ctx.Value(ckDispatcherFuncs).(additionalDispatchers)
+	if !ok {
+		previous.fallback = DispatcherCtx(ctx)
+		if dispatcher := Dispatcher(ctx); previous.fallback == nil && dispatcher != nil {
+			previous.fallback = func(_ context.Context, rows *sql.Rows) error {
+				return dispatcher(rows)
+			}
+		}
+	}
+	all := additionalDispatchers{
+		funcs:    append(append([]*DispatcherFuncs(nil), previous.funcs...), funcs.clone()),
+		fallback: previous.fallback,
+	}
+	ctx = context.WithValue(ctx, ckDispatcherFuncs, all)
+	composed := composeDispatcherFuncs(all.funcs)
+	if all.fallback == nil {
+		return WithDispatcherCtx(ctx, func(ctx context.Context, rows *sql.Rows) error {
+			return dispatch(ctx, rows, composed)
+		})
+	}
+	return WithDispatcherCtx(ctx, func(ctx context.Context, rows *sql.Rows) error {
+		return dispatchWithFallback(ctx, rows, composed, all.fallback)
+	})
+}
+
+// additionalDispatchers is what WithAdditionalDispatcher stores on the context
+type additionalDispatchers struct {
+	funcs []*DispatcherFuncs
+	// fallback is the dispatcher registered before the first DispatcherFuncs was added
+	fallback RowsGoDispatcherCtx
+}
+
+// WithQueryTimeout returns a context that makes New run each query with the given timeout.
+// The timeout covers the whole lifetime of the ResultSets, and the derived context is
+// cancelled when the ResultSets is closed; either explicitly, or automatically after the
+// last result set (including any trailing logging and dispatcher selects) has been read.
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, ckQueryTimeout, timeout)
+}
+
+func QueryTimeout(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(ckQueryTimeout).(time.Duration)
+	return d, ok
+}
+
+// WithQueryEcho returns a context that makes New log the query it is about to run through the
+// RowsLogger on the context; a trimmed version of the SQL text together with the names and
+// types of the parameters (never their values). When the ResultSets is closed, a second entry
+// is logged with the duration of the query and the number of result sets that were read.
+func WithQueryEcho(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ckQueryEcho, true)
+}
+
+func QueryEcho(ctx context.Context) bool {
+	echo, _ := ctx.Value(ckQueryEcho).(bool)
+	return echo
+}
+
+// WithoutQueryErrorContext returns a context that makes New and Next return the errors of the
+// driver as they are, instead of wrapped in a QueryError with the start of the SQL text; e.g. if
+// the query text should never end up in logs, or for code doing type assertions on the errors.
+func WithoutQueryErrorContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ckNoQueryErrorContext, true)
+}
+
+// QueryErrorContext tells whether errors of the driver are wrapped in a QueryError, which is the
+// default; see WithoutQueryErrorContext
+func QueryErrorContext(ctx context.Context) bool {
+	disabled, _ := ctx.Value(ckNoQueryErrorContext).(bool)
+	return !disabled
+}
+
+// WithTimingLogs returns a context that makes ResultSets log a summary entry at debug level
+// through the RowsLogger on the context when it is closed, with the number of result sets
+// (including logging and dispatcher selects), the number of rows read from the other
+// result sets, the total duration of the query and the duration of each result set.
+func WithTimingLogs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ckTimingLogs, true)
+}
+
+func TimingLogs(ctx context.Context) bool {
+	timing, _ := ctx.Value(ckTimingLogs).(bool)
+	return timing
+}
+
+// WithQueryName returns a context that makes every entry logged through the RowsLogger by the
+// queries done with it, including the entries for empty log selects, be tagged with `name`.
+// This makes it possible to tell which query logged what when several queries run
+// concurrently. The name of the field is given by WithQueryTag, by default "query_id".
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, ckQueryName, name)
+}
+
+func QueryName(ctx context.Context) string {
+	name, _ := ctx.Value(ckQueryName).(string)
+	return name
+}
+
+// WithQueryTag returns a context that tags every logged entry like WithQueryName, in the
+// field `field`. Without WithQueryName the value is a short hash of the SQL text of the query.
+// An empty `field` gives the default "query_id".
+func WithQueryTag(ctx context.Context, field string) context.Context {
+	if field == "" {
+		field = defaultQueryTagField
+	}
+	return context.WithValue(ctx, ckQueryTagField, field)
+}
+
+func QueryTag(ctx context.Context) (string, bool) {
+	field, ok := ctx.Value(ckQueryTagField).(string)
+	return field, ok
+}
+
+// WithLogRedaction returns a context that makes the values of the columns for which `redact`
+// returns true be logged as "[REDACTED]", before they are passed to the RowsLogger.
+// See RedactColumns for matching the column names against patterns.
+func WithLogRedaction(ctx context.Context, redact func(column string) bool) context.Context {
+	return context.WithValue(ctx, ckLogRedaction, redact)
+}
+
+func LogRedaction(ctx context.Context) func(column string) bool {
+	redact, _ := ctx.Value(ckLogRedaction).(func(column string) bool)
+	return redact
+}
+
+// WithMinLogLevel returns a context that makes log selects only log the rows with a level of
+// at least `level`; e.g. with logrus.InfoLevel, rows with `_log='debug'` are read but not
+// logged. Levels given as aliases or numbers are resolved with the configuration of the
+// RowsLogger. The entries for empty log selects are logged if the default level of the
+// RowsLogger is at least `level`.
+func WithMinLogLevel(ctx context.Context, level logrus.Level) context.Context {
+	return context.WithValue(ctx, ckMinLogLevel, level)
+}
+
+func MinLogLevel(ctx context.Context) (logrus.Level, bool) {
+	level, ok := ctx.Value(ckMinLogLevel).(logrus.Level)
+	return level, ok
+}
+
+// WithLogSampling returns a context that makes log selects only log every `everyN`th row,
+// starting with the first. If rows are left out, an entry at warning level with the event
+// "log.sampled" tells how many, together with the names of the columns of the select.
+// All rows are still read from the database.
+func WithLogSampling(ctx context.Context, everyN int) context.Context {
+	return context.WithValue(ctx, ckLogSampling, everyN)
+}
+
+func LogSampling(ctx context.Context) int {
+	everyN, _ := ctx.Value(ckLogSampling).(int)
+	return everyN
+}
+
+// WithProgressLogger returns a context that makes the rows of progress selects, such as
+// `select _progress='copy rows', done=@i, total=@n`, be passed to `logger` as a ProgressEvent
+// with the percentage done and the time elapsed since the first progress row of the query.
+// Without a ProgressLogger, progress rows are logged through the RowsLogger at info level.
+func WithProgressLogger(ctx context.Context, logger ProgressLogger) context.Context {
+	return context.WithValue(ctx, ckProgressLogger, logger)
+}
+
+// WithProgressFunc is like WithProgressLogger, for callbacks that can not fail, e.g. updating a UI
+func WithProgressFunc(ctx context.Context, f func(event ProgressEvent)) context.Context {
+	return WithProgressLogger(ctx, func(event ProgressEvent) error {
+		f(event)
+		return nil
+	})
+}
+
+func Progress(ctx context.Context) ProgressLogger {
+	logger, _ := ctx.Value(ckProgressLogger).(ProgressLogger)
+	return logger
+}
+
+// WithMonitor returns a context that makes metric selects, such as
+// `select _metric='orders_processed_total', labels='region=eu', value=42`, be passed to
+// `monitor`. Without a RowsMonitor, metric selects are discarded.
+func WithMonitor(ctx context.Context, monitor RowsMonitor) context.Context {
+	return context.WithValue(ctx, ckRowsMonitor, monitor)
+}
+
+func Monitor(ctx context.Context) RowsMonitor {
+	monitor, _ := ctx.Value(ckRowsMonitor).(RowsMonitor)
+	return monitor
+}
@@ -0,0 +1,107 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultLogger(t *testing.T) {
+	defaultLogger, defaultHook := test.NewNullLogger()
+	ctxLogger, ctxHook := test.NewNullLogger()
+	SetDefaultLogger(LogrusMSSQLLogger(defaultLogger, logrus.InfoLevel))
+	defer SetDefaultLogger(nil)
+
+	logSelect := newLogEntrySet("info", []string{"x"}, []any{"hello"})
+	require.NoError(t, DrainAll(New(context.Background(), bufferedDB, "buffered set", logSelect)))
+	assert.Len(t, defaultHook.Entries, 1)
+
+	// The logger on the context wins
+	ctx := WithLogger(context.Background(), LogrusMSSQLLogger(ctxLogger, logrus.InfoLevel))
+	require.NoError(t, DrainAll(New(ctx, bufferedDB, "buffered set", logSelect)))
+	assert.Len(t, defaultHook.Entries, 1)
+	assert.Len(t, ctxHook.Entries, 1)
+
+	SetDefaultLogger(nil)
+	assert.Nil(t, DefaultLogger())
+	require.NoError(t, DrainAll(New(context.Background(), bufferedDB, "buffered set", logSelect)))
+	assert.Len(t, defaultHook.Entries, 1)
+}
+
+func TestWarnDiscardedLogSelect(t *testing.T) {
+	warn := WarnDiscardedLogSelect
+	defer func() {
+		WarnDiscardedLogSelect = warn
+		discardedLogSelectWarned.Store(false)
+	}()
+	var warnings [][]string
+	WarnDiscardedLogSelect = func(columns []string) {
+		warnings = append(warnings, columns)
+	}
+	discardedLogSelectWarned.Store(false)
+
+	logSelect := newLogEntrySet("info", []string{"x"}, []any{"hello"})
+	// Explicitly silenced
+	require.NoError(t, DrainAll(New(context.Background(), bufferedDB, "buffered set", logSelect).WithLogger(nil)))
+	assert.Empty(t, warnings)
+
+	// Only once
+	require.NoError(t, DrainAll(New(context.Background(), bufferedDB, "buffered set", logSelect)))
+	require.NoError(t, DrainAll(New(context.Background(), bufferedDB, "buffered set", logSelect)))
+	assert.Equal(t, [][]string{{"_log", "x"}}, warnings)
+}
+
+func TestDispatchKey(t *testing.T) {
+	methods := &dispatchedMethods{}
+	ctx := WithDispatcher(context.Background(), NewDispatcherFuncs().Register("Record", methods.Record).Dispatcher())
+	ctx = WithDispatchKey(ctx, "Callback")
+	set := &bufferedSet{
+		columns:       []string{"CALLBACK", "label"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"Record", "x"}},
+	}
+	require.NoError(t, DrainAll(New(ctx, bufferedDB, "buffered set", set)))
+	assert.Equal(t, []string{"x"}, methods.labels)
+
+	set = &bufferedSet{
+		columns:       []string{"callback", "_log", "label"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"Record", "info", "x"}},
+	}
+	assert.EqualError(t, DrainAll(New(ctx, bufferedDB, "buffered set", set)),
+		"result set 0: select has both the dispatch key column 'callback' and the log key column '_log'; use separate selects for dispatching and logging")
+}
+
+func TestDispatchAndLogInOneSelect(t *testing.T) {
+	methods := &dispatchedMethods{}
+	ctx := WithDispatcher(context.Background(), NewDispatcherFuncs().Register("Record", methods.Record).Dispatcher())
+	ctx = WithLogger(ctx, func(rows *sql.Rows) error {
+		_, err := readBufferedSet(rows)
+		return err
+	})
+	for _, tc := range []struct {
+		columns  []string
+		row      []any
+		expected string
+	}{
+		{[]string{"_function", "_log", "label"}, []any{"Record", "info", "x"},
+			"result set 0: select has both the dispatch key column '_function' and the log key column '_log'; use separate selects for dispatching and logging"},
+		{[]string{"_log", "_function", "label"}, []any{"info", "Record", "x"},
+			"result set 0: select has both the dispatch key column '_function' and the log key column '_log'; use separate selects for dispatching and logging"},
+		{[]string{"level", "label", "_function"}, []any{"info", "x", "Record"},
+			"result set 0: select has both the dispatch key column '_function' and the log key column 'level'; use separate selects for dispatching and logging"},
+	} {
+		set := &bufferedSet{
+			columns:       tc.columns,
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"},
+			rows:          [][]any{tc.row},
+		}
+		assert.EqualError(t, DrainAll(New(WithLogKey(ctx, "level"), bufferedDB, "buffered set", set)), tc.expected)
+	}
+	assert.Empty(t, methods.labels)
+}
@@ -0,0 +1,108 @@
+package querysql
+
+import (
+	"context"
+	"fmt"
+)
+
+// Cursor reads the rows of a single result set in chunks of a size controlled by the caller,
+// from a single streaming *sql.Rows. This allows processing very large result sets without
+// holding them in memory, while still letting the caller decide when to read more rows.
+type Cursor[T any] struct {
+	rs      *ResultSets
+	scanner RowScanner[T]
+	row     T
+	done    bool
+}
+
+// OpenCursor executes the query and returns a Cursor for reading its result set. Logging and
+// dispatcher selects before the result set are processed before OpenCursor returns.
+// ErrNoMoreSets is returned if the query has no result set. The Cursor must be closed.
+func OpenCursor[T any](ctx context.Context, querier CtxQuerier, qry string, args ...any) (*Cursor[T], error) {
+	rs := New(ctx, querier, qry, args...)
+	if rs.Err != nil {
+		return nil, rs.Err
+	}
+	if err := rs.start(); err != nil {
+		return nil, err
+	}
+	if rs.Done() {
+		return nil, ErrNoMoreSets
+	}
+
+	cursor := &Cursor[T]{rs: rs}
+	cursor.scanner.target = &cursor.row
+	return cursor, nil
+}
+
+// Fetch reads up to n rows. Fewer rows are returned only when the end of the result set
+// has been reached, and once the cursor is exhausted an empty slice is returned.
+//
+// When the end of the result set is reached, any logging and dispatcher selects following it
+// are processed, and ErrNotDone is returned together with the rows if there are more result
+// sets after that. Fetch must not be called concurrently with another call to Fetch or Close.
+func (c *Cursor[T]) Fetch(n int) ([]T, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("Cursor.Fetch: n must be positive, got %d", n)
+	}
+	rs := c.rs
+	if !rs.enter() {
+		return nil, ErrConcurrentUse
+	}
+	defer rs.leave()
+	if c.done {
+		return nil, nil
+	}
+	if err := rs.ctxErr(); err != nil {
+		return nil, c.fail(err)
+	}
+
+	var result []T
+	for len(result) < n && rs.Rows.Next() {
+		if len(result)%ctxCheckInterval == 0 {
+			if err := rs.ctxErr(); err != nil {
+				return nil, c.fail(err)
+			}
+		}
+		if err := c.scanner.scanRow(rs.Rows); err != nil {
+			return nil, c.fail(err)
+		}
+		result = append(result, c.row)
+	}
+	if len(result) == n {
+		return result, nil
+	}
+
+	// Reached the end of the result set
+	c.done = true
+	if err := rs.ctxErr(); err != nil {
+		return nil, c.fail(err)
+	}
+	if err := rs.Rows.Err(); err != nil {
+		return nil, c.fail(err)
+	}
+	if err := rs.nextResultSet(); err != nil {
+		return nil, c.fail(err)
+	}
+	if _, err := rs.processAllSpecialSelects(); err != nil {
+		return nil, c.fail(err)
+	}
+	if !rs.Done() {
+		// The rows were read fine; the caller decides what to do with them
+		return result, c.fail(ErrNotDone)
+	}
+	return result, nil
+}
+
+// fail closes the cursor from within Fetch and returns `err`
+func (c *Cursor[T]) fail(err error) error {
+	c.done = true
+	_ = c.rs.close()
+	return err
+}
+
+// Close closes the underlying ResultSets. It is safe to call Close several times.
+func (c *Cursor[T]) Close() error {
+	c.done = true
+	return c.rs.Close()
+}
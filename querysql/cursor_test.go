@@ -0,0 +1,89 @@
+package querysql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+const cursorQuery = `
+select _log='info', x = 'before';
+
+select top(2500) X = row_number() over (order by a.object_id), Y = 'row'
+from sys.all_objects a cross join sys.all_objects b;
+
+select _log='info', x = 'after';
+`
+
+func TestCursor(t *testing.T) {
+	type row struct {
+		X int
+		Y string
+	}
+
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+
+	cursor, err := querysql.OpenCursor[row](ctx, sqldb, cursorQuery)
+	require.NoError(t, err)
+	defer cursor.Close()
+	assert.Equal(t, []logrus.Fields{{"x": "before"}}, hook.lines)
+
+	var sizes []int
+	next := 1
+	for {
+		batch, err := cursor.Fetch(1000)
+		require.NoError(t, err)
+		if len(batch) == 0 {
+			break
+		}
+		sizes = append(sizes, len(batch))
+		for _, r := range batch {
+			assert.Equal(t, row{next, "row"}, r)
+			next++
+		}
+	}
+	assert.Equal(t, []int{1000, 1000, 500}, sizes)
+	assert.Equal(t, []logrus.Fields{{"x": "before"}, {"x": "after"}}, hook.lines)
+}
+
+func TestCursorCancelledBetweenFetches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cursor, err := querysql.OpenCursor[int](ctx, sqldb, `
+select top(2500) row_number() over (order by a.object_id)
+from sys.all_objects a cross join sys.all_objects b;
+`)
+	require.NoError(t, err)
+	defer cursor.Close()
+
+	batch, err := cursor.Fetch(10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, batch)
+
+	cancel()
+	_, err = cursor.Fetch(10)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestCursorErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := querysql.OpenCursor[int](ctx, sqldb, `declare @x int = 1`)
+	assert.Equal(t, querysql.ErrNoMoreSets, err)
+
+	cursor, err := querysql.OpenCursor[int](ctx, sqldb, `select 1; select 2;`)
+	require.NoError(t, err)
+	defer cursor.Close()
+	batch, err := cursor.Fetch(10)
+	assert.Equal(t, querysql.ErrNotDone, err)
+	assert.Equal(t, []int{1}, batch)
+}
@@ -0,0 +1,171 @@
+package querysql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The numbers of the SQL Server errors classified by the functions below
+const (
+	mssqlUniqueConstraintViolated = 2627
+	mssqlUniqueIndexViolated      = 2601
+	mssqlRollbackWithoutBegin     = 3903
+)
+
+// The numbers of SQL Server errors about locking, to pass to IsMssqlError
+const (
+	// MssqlErrorDeadlockVictim is returned to the transaction chosen as the deadlock victim;
+	// the transaction has been rolled back, so it can be retried from the start
+	MssqlErrorDeadlockVictim = int32(1205)
+	// MssqlErrorLockTimeout is returned when a lock was not granted within SET LOCK_TIMEOUT
+	MssqlErrorLockTimeout = int32(1222)
+	// MssqlErrorSnapshotConflict is returned when a transaction with snapshot isolation updates
+	// a row that was changed by another transaction after it started; the transaction is rolled back
+	MssqlErrorSnapshotConflict = int32(3960)
+)
+
+// MssqlErrorConstraintViolation is the number of the SQL Server error returned when a statement
+// conflicts with a foreign key or check constraint
+const MssqlErrorConstraintViolation = int32(547)
+
+// The numbers of SQL Server errors about the values of a statement, typically caused by input
+// that should have been validated; they are never resolved by running the statement again
+const (
+	// MssqlErrorStringTruncated is returned when a value does not fit in a column; before SQL
+	// Server 2019 without telling which column
+	MssqlErrorStringTruncated = int32(8152)
+	// MssqlErrorStringTruncatedInColumn is MssqlErrorStringTruncated telling which column, from
+	// SQL Server 2019
+	MssqlErrorStringTruncatedInColumn = int32(2628)
+	// MssqlErrorConversionFailed is returned when converting a string to another type fails
+	MssqlErrorConversionFailed = int32(245)
+	// MssqlErrorConversionOverflow is returned when converting between data types fails,
+	// e.g. because the value is out of range
+	MssqlErrorConversionOverflow = int32(8114)
+)
+
+// The patterns of the names of constraints and indexes in the messages of SQL Server errors, e.g.
+//
+//	The INSERT statement conflicted with the FOREIGN KEY constraint "FK_Order_Customer". ...
+//	Violation of PRIMARY KEY constraint 'PK_Order'. Cannot insert duplicate key in object ...
+//	Cannot insert duplicate key row in object 'dbo.Order' with unique index 'IX_Order_Number'. ...
+var (
+	constraintViolationName  = regexp.MustCompile(`conflicted with the [A-Z ]*constraint "([^"]*)"`)
+	uniqueConstraintName     = regexp.MustCompile(`Violation of [A-Z ]*constraint '([^']*)'`)
+	uniqueIndexViolationName = regexp.MustCompile(`with unique index '([^']*)'`)
+)
+
+// mssqlError is implemented by the errors of SQL Server returned by both
+// github.com/denisenkom/go-mssqldb and its fork github.com/microsoft/go-mssqldb
+type mssqlError interface {
+	error
+	SQLErrorNumber() int32
+}
+
+// IsMssqlError reports whether `err`, or an error it wraps, is an error returned by SQL Server
+// with one of the error numbers in `numbers`; or with any number if none are given. It works
+// with the driver github.com/denisenkom/go-mssqldb as well as its fork
+// github.com/microsoft/go-mssqldb.
+func IsMssqlError(err error, numbers ...int32) bool {
+	var sqlErr mssqlError
+	if !errors.As(err, &sqlErr) {
+		return false
+	}
+	if len(numbers) == 0 {
+		return true
+	}
+	for _, number := range numbers {
+		if sqlErr.SQLErrorNumber() == number {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUniqueKeyOrIndexViolatedError reports whether `err` is SQL Server refusing to insert a
+// duplicate key into a primary key, a unique constraint or a unique index
+func IsUniqueKeyOrIndexViolatedError(err error) bool {
+	return IsMssqlError(err, mssqlUniqueConstraintViolated, mssqlUniqueIndexViolated)
+}
+
+// IsRedundantRollbackError reports whether `err` is SQL Server complaining that there is no
+// transaction to roll back, typically because the transaction was already rolled back by SQL,
+// e.g. by XACT_ABORT or a rollback in a stored procedure
+func IsRedundantRollbackError(err error) bool {
+	return IsMssqlError(err, mssqlRollbackWithoutBegin)
+}
+
+// IsDeadlockError reports whether `err` is SQL Server choosing the transaction as the victim of a
+// deadlock. The transaction has then been rolled back, so retrying means retrying all of it.
+func IsDeadlockError(err error) bool {
+	return IsMssqlError(err, MssqlErrorDeadlockVictim)
+}
+
+// IsForeignKeyOrCheckViolationError reports whether `err` is SQL Server refusing a statement that
+// conflicts with a foreign key or check constraint
+func IsForeignKeyOrCheckViolationError(err error) bool {
+	return IsMssqlError(err, MssqlErrorConstraintViolation)
+}
+
+// ConstraintViolation returns the name of the constraint, or unique index, violated if `err` is
+// one of the errors classified by IsForeignKeyOrCheckViolationError and
+// IsUniqueKeyOrIndexViolatedError; e.g. to map it to a message for the user.
+// The name is parsed from the message of SQL Server, so ok is false if the message is not in English.
+func ConstraintViolation(err error) (constraintName string, ok bool) {
+	var sqlErr mssqlError
+	if !errors.As(err, &sqlErr) {
+		return "", false
+	}
+	var pattern *regexp.Regexp
+	switch sqlErr.SQLErrorNumber() {
+	case MssqlErrorConstraintViolation:
+		pattern = constraintViolationName
+	case mssqlUniqueConstraintViolated:
+		pattern = uniqueConstraintName
+	case mssqlUniqueIndexViolated:
+		pattern = uniqueIndexViolationName
+	default:
+		return "", false
+	}
+	match := pattern.FindStringSubmatch(sqlErr.Error())
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// IsTimeoutOrCanceled reports whether `err` is the query being cancelled or timing out rather
+// than failing in SQL: the context passed to New being cancelled or reaching its deadline
+// (including WithQueryTimeout), or a network timeout talking to SQL Server. SQL Server not
+// granting a lock within SET LOCK_TIMEOUT is an error of the statement, not of the query, and
+// is not included; see MssqlErrorLockTimeout.
+func IsTimeoutOrCanceled(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// The driver does not always wrap the network error it failed on
+	return strings.Contains(err.Error(), "i/o timeout")
+}
+
+// IsDataTruncationError reports whether `err` is SQL Server refusing to store a string or binary
+// value that does not fit in its column
+func IsDataTruncationError(err error) bool {
+	return IsMssqlError(err, MssqlErrorStringTruncated, MssqlErrorStringTruncatedInColumn)
+}
+
+// IsConversionError reports whether `err` is SQL Server failing to convert a value to the type
+// of a column or parameter, e.g. 'abc' to int
+func IsConversionError(err error) bool {
+	return IsMssqlError(err, MssqlErrorConversionFailed, MssqlErrorConversionOverflow)
+}
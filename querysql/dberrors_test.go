@@ -0,0 +1,137 @@
+package querysql_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+func TestIsMssqlError(t *testing.T) {
+	uniqueKey := mssql.Error{Number: 2627, Message: "Violation of PRIMARY KEY constraint"}
+	uniqueIndex := &mssql.Error{Number: 2601, Message: "Cannot insert duplicate key row"}
+	rollback := mssql.Error{Number: 3903, Message: "The ROLLBACK TRANSACTION request has no corresponding BEGIN TRANSACTION."}
+	deadlock := mssql.Error{Number: querysql.MssqlErrorDeadlockVictim, Message: "Transaction (Process ID 52) was deadlocked on lock resources with another process and has been chosen as the deadlock victim. Rerun the transaction."}
+	for _, tc := range []struct {
+		err       error
+		any       bool
+		uniqueKey bool
+		rollback  bool
+		deadlock  bool
+	}{
+		{nil, false, false, false, false},
+		{errors.New("Violation of PRIMARY KEY constraint"), false, false, false, false},
+		{errors.New("Transaction was deadlocked and has been chosen as the deadlock victim"), false, false, false, false},
+		{uniqueKey, true, true, false, false},
+		{uniqueIndex, true, true, false, false},
+		{fmt.Errorf("wrapped: %w", uniqueKey), true, true, false, false},
+		{&querysql.ResultSetError{Index: 1, Err: uniqueIndex}, true, true, false, false},
+		{rollback, true, false, true, false},
+		{deadlock, true, false, false, true},
+		{&querysql.QueryError{Query: "update T set X = 1", Err: deadlock}, true, false, false, true},
+		{mssql.Error{Number: 1222, Message: "Lock request time out period exceeded."}, true, false, false, false},
+		{mssql.Error{Number: 50000, Message: "raiserror"}, true, false, false, false},
+	} {
+		t.Run(fmt.Sprintf("%v", tc.err), func(t *testing.T) {
+			assert.Equal(t, tc.any, querysql.IsMssqlError(tc.err))
+			assert.Equal(t, tc.uniqueKey, querysql.IsUniqueKeyOrIndexViolatedError(tc.err))
+			assert.Equal(t, tc.rollback, querysql.IsRedundantRollbackError(tc.err))
+			assert.Equal(t, tc.deadlock, querysql.IsDeadlockError(tc.err))
+		})
+	}
+	assert.True(t, querysql.IsMssqlError(uniqueKey, 50000, 2627))
+	assert.True(t, querysql.IsMssqlError(mssql.Error{Number: 1222}, querysql.MssqlErrorLockTimeout))
+	assert.False(t, querysql.IsMssqlError(uniqueKey, 50000))
+}
+
+func TestIsUniqueKeyOrIndexViolatedErrorFromDB(t *testing.T) {
+	ctx := context.Background()
+	_, err := querysql.ExecContext(ctx, sqldb, `
+create table #UniqueKey (ID int primary key);
+insert into #UniqueKey (ID) values (1);
+insert into #UniqueKey (ID) values (1);
+`)
+	require.Error(t, err)
+	assert.True(t, querysql.IsUniqueKeyOrIndexViolatedError(err))
+	assert.False(t, querysql.IsRedundantRollbackError(err))
+
+	_, err = querysql.ExecContext(ctx, sqldb, `rollback`)
+	require.Error(t, err)
+	assert.True(t, querysql.IsRedundantRollbackError(err))
+	assert.False(t, querysql.IsUniqueKeyOrIndexViolatedError(err))
+}
+
+func TestConstraintViolation(t *testing.T) {
+	for _, tc := range []struct {
+		err          error
+		fkOrCheck    bool
+		expectedName string
+	}{
+		{mssql.Error{Number: 547, Message: `The INSERT statement conflicted with the FOREIGN KEY constraint "FK_Order_Customer". The conflict occurred in database "shop", table "dbo.Customer", column 'CustomerID'.`},
+			true, "FK_Order_Customer"},
+		{mssql.Error{Number: 547, Message: `The DELETE statement conflicted with the REFERENCE constraint "FK_Order_Customer". The conflict occurred in database "shop", table "dbo.Order", column 'CustomerID'.`},
+			true, "FK_Order_Customer"},
+		{mssql.Error{Number: 547, Message: `The UPDATE statement conflicted with the FOREIGN KEY SAME TABLE constraint "FK_Category_Parent". The conflict occurred in database "shop", table "dbo.Category", column 'ID'.`},
+			true, "FK_Category_Parent"},
+		{mssql.Error{Number: 547, Message: `The INSERT statement conflicted with the CHECK constraint "CK_Order_Amount". The conflict occurred in database "shop", table "dbo.Order", column 'Amount'.`},
+			true, "CK_Order_Amount"},
+		{mssql.Error{Number: 2627, Message: `Violation of PRIMARY KEY constraint 'PK_Order'. Cannot insert duplicate key in object 'dbo.Order'. The duplicate key value is (1).`},
+			false, "PK_Order"},
+		{mssql.Error{Number: 2627, Message: `Violation of UNIQUE KEY constraint 'UQ_Order_Number'. Cannot insert duplicate key in object 'dbo.Order'. The duplicate key value is (A-1).`},
+			false, "UQ_Order_Number"},
+		{fmt.Errorf("wrapped: %w", mssql.Error{Number: 2601, Message: `Cannot insert duplicate key row in object 'dbo.Order' with unique index 'IX_Order_Number'. The duplicate key value is (A-1).`}),
+			false, "IX_Order_Number"},
+		{mssql.Error{Number: 547, Message: `Die INSERT-Anweisung steht in Konflikt mit der FOREIGN KEY-Einschränkung 'FK_Order_Customer'.`},
+			true, ""},
+		{mssql.Error{Number: 50000, Message: `conflicted with the CHECK constraint "CK_Order_Amount"`},
+			false, ""},
+		{errors.New(`The INSERT statement conflicted with the CHECK constraint "CK_Order_Amount".`),
+			false, ""},
+	} {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tc.fkOrCheck, querysql.IsForeignKeyOrCheckViolationError(tc.err))
+			name, ok := querysql.ConstraintViolation(tc.err)
+			assert.Equal(t, tc.expectedName, name)
+			assert.Equal(t, tc.expectedName != "", ok)
+		})
+	}
+}
+
+func TestConstraintViolationFromDB(t *testing.T) {
+	_, err := querysql.ExecContext(context.Background(), sqldb, `
+create table #Checked (Amount int constraint CK_Checked_Amount check (Amount > 0));
+insert into #Checked (Amount) values (-1);
+`)
+	require.Error(t, err)
+	assert.True(t, querysql.IsForeignKeyOrCheckViolationError(err))
+	name, ok := querysql.ConstraintViolation(err)
+	assert.True(t, ok)
+	assert.Equal(t, "CK_Checked_Amount", name)
+}
+
+func TestIsDataTruncationOrConversionError(t *testing.T) {
+	for _, tc := range []struct {
+		err        error
+		truncation bool
+		conversion bool
+	}{
+		{mssql.Error{Number: 8152, Message: "String or binary data would be truncated."}, true, false},
+		{mssql.Error{Number: 2628, Message: "String or binary data would be truncated in table 'shop.dbo.Order', column 'Number'. Truncated value: 'A-123'."}, true, false},
+		{mssql.Error{Number: 245, Message: "Conversion failed when converting the varchar value 'abc' to data type int."}, false, true},
+		{mssql.Error{Number: 8114, Message: "Error converting data type varchar to bigint."}, false, true},
+		{&querysql.QueryError{Query: "insert into Order", Err: mssql.Error{Number: 2628}}, true, false},
+		{mssql.Error{Number: 547, Message: "The INSERT statement conflicted with the CHECK constraint"}, false, false},
+		{errors.New("String or binary data would be truncated."), false, false},
+	} {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			assert.Equal(t, tc.truncation, querysql.IsDataTruncationError(tc.err))
+			assert.Equal(t, tc.conversion, querysql.IsConversionError(tc.err))
+			assert.False(t, querysql.IsTransientError(tc.err))
+		})
+	}
+}
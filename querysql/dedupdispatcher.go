@@ -0,0 +1,95 @@
+package querysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrDispatchSuppressed is passed to the observer given with DedupObserver for the calls
+// suppressed by DedupDispatcher
+var ErrDispatchSuppressed = errors.New("dispatch suppressed as a duplicate")
+
+// DedupOption configures DedupDispatcher
+type DedupOption func(*dedupDispatcher)
+
+// DedupObserver makes the dispatcher returned by DedupDispatcher call `observer` for each
+// suppressed call, with the name of the function, a duration of 0 and ErrDispatchSuppressed,
+// e.g. for counting them with queryprom.DispatchMetrics
+func DedupObserver(observer DispatchObserver) DedupOption {
+	return func(d *dedupDispatcher) {
+		d.observer = observer
+	}
+}
+
+// DedupDispatcher returns a RowsGoDispatcher passing the rows of dispatcher selects on to
+// `dispatcher`, e.g. one returned by GoMSSQLDispatcher, except rows identical to one passed on
+// less than `window` ago; i.e. calls of the same function with the same arguments. This protects
+// e.g. a metrics backend from a procedure updating a gauge in a loop. Selects where all rows are
+// suppressed are not passed on at all.
+func DedupDispatcher(dispatcher RowsGoDispatcher, window time.Duration, opts ...DedupOption) RowsGoDispatcher {
+	d := &dedupDispatcher{dispatcher: dispatcher, window: window, now: time.Now, lastCalls: map[string]time.Time{}}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d.dispatch
+}
+
+type dedupDispatcher struct {
+	dispatcher RowsGoDispatcher
+	window     time.Duration
+	observer   DispatchObserver
+	now        func() time.Time
+
+	mu sync.Mutex
+	// lastCalls are the times the calls were last passed on, by dedupKey
+	lastCalls map[string]time.Time
+}
+
+func (d *dedupDispatcher) dispatch(rows *sql.Rows) error {
+	set, err := readBufferedSet(rows)
+	if err != nil {
+		return err
+	}
+	passed := &bufferedSet{columns: set.columns, databaseTypes: set.databaseTypes}
+	var suppressed []string
+	d.mu.Lock()
+	now := d.now()
+	for key, at := range d.lastCalls {
+		if now.Sub(at) >= d.window {
+			delete(d.lastCalls, key)
+		}
+	}
+	for _, row := range set.rows {
+		key := dedupKey(row)
+		if _, ok := d.lastCalls[key]; ok {
+			suppressed = append(suppressed, fmt.Sprint(row[0]))
+			continue
+		}
+		d.lastCalls[key] = now
+		passed.rows = append(passed.rows, row)
+	}
+	d.mu.Unlock()
+
+	if d.observer != nil {
+		for _, name := range suppressed {
+			d.observer(name, 0, ErrDispatchSuppressed)
+		}
+	}
+	if len(passed.rows) == 0 {
+		return nil
+	}
+	passedRows, err := passed.Rows()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = passedRows.Close() }()
+	return d.dispatcher(passedRows)
+}
+
+// dedupKey identifies a call by the function name and the arguments, including their types
+func dedupKey(row []any) string {
+	return fmt.Sprintf("%#v", row)
+}
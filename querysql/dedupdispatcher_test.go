@@ -0,0 +1,46 @@
+package querysql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupDispatcher(t *testing.T) {
+	methods := &dispatchedMethods{}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var suppressed []string
+	dispatcher := DedupDispatcher(NewDispatcherFuncs().Register("Record", methods.Record).Dispatcher(), time.Minute,
+		DedupObserver(func(name string, duration time.Duration, err error) {
+			assert.ErrorIs(t, err, ErrDispatchSuppressed)
+			suppressed = append(suppressed, name)
+		}),
+		func(d *dedupDispatcher) { d.now = func() time.Time { return now } })
+	dispatch := func(labels ...string) {
+		set := &bufferedSet{columns: []string{"_function", "label"}, databaseTypes: []string{"NVARCHAR", "NVARCHAR"}}
+		for _, label := range labels {
+			set.rows = append(set.rows, []any{"Record", label})
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		require.NoError(t, dispatcher(rows))
+	}
+
+	dispatch("a", "a", "b")
+	dispatch("a")
+	assert.Equal(t, []string{"a", "b"}, methods.labels)
+	assert.Equal(t, []string{"Record", "Record"}, suppressed)
+
+	now = now.Add(30 * time.Second)
+	dispatch("b", "c")
+	assert.Equal(t, []string{"a", "b", "c"}, methods.labels)
+
+	// "a" and "b" were passed on a minute ago, "c" only 30 seconds ago
+	now = now.Add(30 * time.Second)
+	dispatch("a", "b", "c")
+	assert.Equal(t, []string{"a", "b", "c", "a", "b"}, methods.labels)
+	assert.Len(t, suppressed, 4)
+}
@@ -0,0 +1,81 @@
+package querysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxEchoQueryLength is the maximum length of the SQL text included in query echo log entries
+const maxEchoQueryLength = 500
+
+type queryEcho struct {
+	query string
+	start time.Time
+}
+
+// trimQuery collapses all whitespace in `qry` into single spaces and truncates it
+// to `maxLength` bytes, to make it fit in a single log line
+func trimQuery(qry string, maxLength int) string {
+	trimmed := strings.Join(strings.Fields(qry), " ")
+	if len(trimmed) > maxLength {
+		// avoid cutting a multi-byte character in half
+		cut := maxLength
+		for cut > 0 && !isRuneStart(trimmed[cut]) {
+			cut--
+		}
+		trimmed = trimmed[:cut] + "..."
+	}
+	return trimmed
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// describeParams describes the names and types of `args`, e.g. "@p1 string, @offset int"
+func describeParams(args []any) string {
+	descriptions := make([]string, len(args))
+	for i, arg := range args {
+		name := fmt.Sprintf("p%d", i+1)
+		if named, ok := arg.(sql.NamedArg); ok {
+			name = named.Name
+			arg = named.Value
+		}
+		descriptions[i] = fmt.Sprintf("@%s %T", name, arg)
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// startEcho logs the query about to be run, if WithQueryEcho is set on the context
+func (rs *ResultSets) startEcho(qry string, args []any) error {
+	if !QueryEcho(rs.ctx) {
+		return nil
+	}
+	rs.echo = &queryEcho{
+		query: trimQuery(qry, maxEchoQueryLength),
+		start: time.Now(),
+	}
+	err := rs.logEntry("info",
+		[]string{"event", "query", "params"},
+		[]any{"query.start", rs.echo.query, describeParams(args)},
+	)
+	if err != nil {
+		rs.echo = nil
+	}
+	return err
+}
+
+// endEcho logs the duration of the query, if startEcho was called
+func (rs *ResultSets) endEcho() error {
+	if rs.echo == nil {
+		return nil
+	}
+	echo := rs.echo
+	rs.echo = nil
+	return rs.logEntry("info",
+		[]string{"event", "query", "duration_ms", "sets"},
+		[]any{"query.end", echo.query, time.Since(echo.start).Milliseconds(), rs.setIndex},
+	)
+}
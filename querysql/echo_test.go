@@ -0,0 +1,24 @@
+package querysql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimQuery(t *testing.T) {
+	assert.Equal(t, "select 1; select @p1", trimQuery(`
+		select 1;
+		select   @p1
+	`, 100))
+	assert.Equal(t, "select...", trimQuery("select 1", 6))
+	// "æ" is two bytes; do not cut it in half
+	assert.Equal(t, "select ...", trimQuery("select æøå", 8))
+}
+
+func TestDescribeParams(t *testing.T) {
+	assert.Equal(t, "", describeParams(nil))
+	assert.Equal(t, "@p1 string, @offset int, @p3 <nil>",
+		describeParams([]any{"secret value", sql.Named("offset", 10), nil}))
+}
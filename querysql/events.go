@@ -0,0 +1,141 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Event is a domain event emitted by a dispatcher select, see EventDispatcher
+type Event struct {
+	// Name is the first column of the select
+	Name string
+	// Fields are the other columns by name. UNIQUEIDENTIFIER columns are given as uuid.UUID,
+	// DECIMAL, NUMERIC and MONEY as float64 and BIT as bool, the other columns as returned by
+	// the driver. NULL columns are nil.
+	Fields map[string]any
+}
+
+// EventDispatcher returns a RowsGoDispatcherCtx sending each row of dispatcher selects calling
+// one of `names` on `ch`, so that SQL scripts can emit domain events that Go code reacts to, e.g.
+//
+//	ctx = querysql.WithDispatcherCtx(ctx, querysql.EventDispatcher(events, "OrderShipped"))
+//	...
+//	select _function='OrderShipped', orderId=@orderId, at=sysutcdatetime()
+//
+// sends Event{Name: "OrderShipped", Fields: map[string]any{"orderId": ..., "at": ...}}. Like
+// function names for GoMSSQLDispatcher, the event names are matched case-insensitively; the Name
+// of the Event is as given in `names`. When the channel is full it waits for room in it, giving
+// up with the error of the context passed to New if it is done; use EventDispatcherDropWhenFull
+// to fail instead.
+//
+// The dispatcher never closes `ch`. Since sending on a closed channel panics, close it only after
+// the last query using the dispatcher has returned.
+func EventDispatcher(ch chan<- Event, names ...string) RowsGoDispatcherCtx {
+	return newEventDispatcher(ch, names, false).dispatch
+}
+
+// EventDispatcherDropWhenFull is like EventDispatcher, but fails the dispatcher select when the
+// channel is full, instead of waiting for room in it
+func EventDispatcherDropWhenFull(ch chan<- Event, names ...string) RowsGoDispatcherCtx {
+	return newEventDispatcher(ch, names, true).dispatch
+}
+
+func newEventDispatcher(ch chan<- Event, names []string, dropWhenFull bool) *eventDispatcher {
+	e := &eventDispatcher{ch: ch, names: map[string]string{}, dropWhenFull: dropWhenFull}
+	for _, name := range names {
+		e.names[canonicalName(name)] = name
+	}
+	return e
+}
+
+type eventDispatcher struct {
+	ch chan<- Event
+	// names maps the canonical names of the events to the names given
+	names        map[string]string
+	dropWhenFull bool
+}
+
+func (e *eventDispatcher) dispatch(ctx context.Context, rows *sql.Rows) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	fields := make([]any, len(cols))
+	scanPointers := make([]any, len(cols))
+	for i := range cols {
+		scanPointers[i] = &fields[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(scanPointers...); err != nil {
+			return err
+		}
+		// See dispatchRow; `select _function=... where 1=2` is not an error
+		if fields[0] == nil {
+			continue
+		}
+		selected, ok := fields[0].(string)
+		if !ok {
+			return fmt.Errorf("first argument to 'select' is expected to be a string. Got '%v' of type '%T' instead", fields[0], fields[0])
+		}
+		name, ok := e.names[canonicalName(selected)]
+		if !ok {
+			return fmt.Errorf("could not find event '%s'. Expected one of %s", selected, e.quotedNames())
+		}
+		event := Event{Name: name, Fields: make(map[string]any, len(cols)-1)}
+		for i := 1; i < len(cols); i++ {
+			if event.Fields[cols[i]], err = eventValue(fields[i], colTypes[i].DatabaseTypeName()); err != nil {
+				return fmt.Errorf("event '%s', column '%s': %w", name, cols[i], err)
+			}
+		}
+		if err = e.send(ctx, event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (e *eventDispatcher) send(ctx context.Context, event Event) error {
+	if e.dropWhenFull {
+		select {
+		case e.ch <- event:
+			return nil
+		default:
+			return fmt.Errorf("event channel full, dropped event '%s'", event.Name)
+		}
+	}
+	select {
+	case e.ch <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// quotedNames returns the names of the events, sorted and quoted
+func (e *eventDispatcher) quotedNames() string {
+	names := make([]string, 0, len(e.names))
+	for _, name := range e.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "'" + strings.Join(names, "', '") + "'"
+}
+
+// eventValue converts a column to a field of Event
+func eventValue(value any, databaseTypeName string) (any, error) {
+	if b, ok := value.([]byte); value == nil || (ok && b == nil) {
+		return nil, nil
+	}
+	if databaseTypeName == "BIT" {
+		return bitLogValue(value)
+	}
+	return ConvertSQLBytes(value, databaseTypeName)
+}
@@ -0,0 +1,68 @@
+package querysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventDispatcher(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	dispatchSet := func(ctx context.Context, dispatcher RowsGoDispatcherCtx, set *bufferedSet) error {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(ctx, rows)
+	}
+	shipped := &bufferedSet{
+		columns:       []string{"_function", "orderId", "amount", "express", "at", "note"},
+		databaseTypes: []string{"NVARCHAR", "UNIQUEIDENTIFIER", "MONEY", "BIT", "DATETIME2", "NVARCHAR"},
+		rows: [][]any{
+			{"OrderShipped", []byte{3, 2, 1, 0, 5, 4, 7, 6, 8, 9, 10, 11, 12, 13, 14, 15}, []byte("12.5000"), true, at, nil},
+			{nil, nil, nil, nil, nil, nil},
+		},
+	}
+
+	events := make(chan Event, 1)
+	dispatcher := EventDispatcher(events, "OrderShipped", "OrderCancelled")
+	require.NoError(t, dispatchSet(context.Background(), dispatcher, shipped))
+	require.Len(t, events, 1)
+	assert.Equal(t, Event{Name: "OrderShipped", Fields: map[string]any{
+		"orderId": uuid.MustParse("00010203-0405-0607-0809-0a0b0c0d0e0f"),
+		"amount":  12.5,
+		"express": true,
+		"at":      at,
+		"note":    nil,
+	}}, <-events)
+
+	// names are matched case-insensitively, and the event has the name as registered
+	require.NoError(t, dispatchSet(context.Background(), dispatcher, &bufferedSet{
+		columns:       []string{"_function", "orderId"},
+		databaseTypes: []string{"NVARCHAR", "INT"},
+		rows:          [][]any{{"orderCANCELLED", int64(1)}},
+	}))
+	assert.Equal(t, Event{Name: "OrderCancelled", Fields: map[string]any{"orderId": int64(1)}}, <-events)
+
+	assert.EqualError(t, dispatchSet(context.Background(), dispatcher, &bufferedSet{
+		columns:       []string{"_function"},
+		databaseTypes: []string{"NVARCHAR"},
+		rows:          [][]any{{"OrderLost"}},
+	}), "could not find event 'OrderLost'. Expected one of 'OrderCancelled', 'OrderShipped'")
+
+	t.Run("block", func(t *testing.T) {
+		events := make(chan Event)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, dispatchSet(ctx, EventDispatcher(events, "OrderShipped"), shipped), context.Canceled)
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		events := make(chan Event)
+		dispatcher := EventDispatcherDropWhenFull(events, "OrderShipped")
+		assert.EqualError(t, dispatchSet(context.Background(), dispatcher, shipped), "event channel full, dropped event 'OrderShipped'")
+	})
+}
@@ -1,13 +1,17 @@
 package querysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
 	"regexp"
 	"runtime"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 type funcInfo struct {
@@ -16,151 +20,826 @@ type funcInfo struct {
 	isClosure bool
 	argType   []reflect.Type
 	valueOf   reflect.Value
+	// returnsError is set if the last return value of the function is an error, which is
+	// returned by the dispatcher
+	returnsError bool
+	// numResults is the number of other return values, which are logged
+	numResults int
+	// takesCtx is set if the first parameter of the function is a context.Context, which is
+	// not counted in numArgs and argType
+	takesCtx bool
+	// variadic is set if the last of argType is the slice of a variadic parameter, which is
+	// passed the columns after those of the other parameters
+	variadic bool
+	// structArg is set if the only parameter is a struct, whose fields are set from the columns
+	// by name
+	structArg bool
+	// payload is set if the last parameter is a slice of structs, which is passed the rows of
+	// the result set after the dispatcher select rather than a column
+	payload bool
+	// paramNames are the canonical names of the parameters given to RegisterWithParams, which
+	// the columns are bound to by name rather than in order
+	paramNames []string
+	onError    DispatchErrorPolicy
+	observers  []DispatchObserver
+	// strictTypes is set by DispatcherFuncs.StrictTypes
+	strictTypes bool
 }
 
-func GoMSSQLDispatcher(fs []interface{}) RowsGoDispatcher {
-	var knownFuncs string
-	var funcMap = map[string]funcInfo{}
+// DispatchObserver is called after each call of a function by the dispatcher, with the name the
+// function was called by, how long the call took, and the error returned by the dispatcher for
+// the call; including errors converting the columns to the parameters of the function.
+// See DispatcherFuncs.WithDispatchObserver.
+type DispatchObserver func(name string, duration time.Duration, err error)
 
-	// Check if the `fs` passed in are indeed functions and construct a map of func name to func
-	for _, f := range fs {
-		var fInfo funcInfo
+// DispatchErrorPolicy tells what happens to the query when a dispatcher select fails, see
+// DispatcherFuncs.OnError
+type DispatchErrorPolicy int
+
+const (
+	// DispatchErrorAbort returns the error from the query, so that the following result sets are
+	// not read
+	DispatchErrorAbort DispatchErrorPolicy = iota
+	// DispatchErrorContinue logs the error and continues with the following result sets. The
+	// errors are returned by ResultSets.DispatchErrors, and at the end by ExecContext.
+	DispatchErrorContinue
+)
+
+// continuedError is an error of a dispatcher select that does not abort the query, see
+// DispatchErrorContinue
+type continuedError struct {
+	err error
+}
+
+func (e continuedError) Error() string {
+	return e.err.Error()
+}
+
+func (e continuedError) Unwrap() error {
+	return e.err
+}
+
+// wrap marks `err` as not aborting the query if so is the policy
+func (policy DispatchErrorPolicy) wrap(err error) error {
+	if err == nil || policy != DispatchErrorContinue {
+		return err
+	}
+	return continuedError{err}
+}
+
+// paramType returns the type the value of column `i` (after the function name) is passed as
+func (fInfo funcInfo) paramType(i int) reflect.Type {
+	if fInfo.variadic && i >= fInfo.numArgs-1 {
+		return fInfo.argType[fInfo.numArgs-1].Elem()
+	}
+	return fInfo.argType[i]
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+var uuidType = reflect.TypeOf(uuid.UUID{})
+var timeType = reflect.TypeOf(time.Time{})
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// GoMSSQLDispatcher returns DispatcherFuncs with the functions in `fs`, named by their Go
+// symbols or by Func; pass its Dispatcher to WithDispatcher, and use Names and Describe to check
+// the functions, e.g. at startup. It panics if `fs` contains something else than functions.
+func GoMSSQLDispatcher(fs []interface{}) *DispatcherFuncs {
+	return NewDispatcherFuncs(fs...)
+}
+
+// NamedFunc is a function with an explicit name, see Func
+type NamedFunc struct {
+	Name string
+	F    interface{}
+}
+
+// Func names `f` explicitly when passed to GoMSSQLDispatcher, GoMSSQLDispatcherCtx and
+// NewDispatcherFuncs, rather than by its Go symbol. This is needed for closures, which are
+// named by the enclosing function, so that two closures created in the same function collide:
+//
+//	dispatcher := querysql.GoMSSQLDispatcher([]interface{}{
+//		querysql.Func("RecordMetric", func(name string, value float64) { registry.Record(name, value) }),
+//		querysql.Func("Audit", func(event string) { auditLog.Println(event) }),
+//	})
+func Func(name string, f interface{}) NamedFunc {
+	return NamedFunc{Name: name, F: f}
+}
+
+// GoMSSQLDispatcherCtx returns the DispatcherCtx of GoMSSQLDispatcher(fs), which passes the
+// context given to New to the functions taking a context.Context as the first parameter; the
+// columns of the select are passed as the remaining parameters. Register it with
+// WithDispatcherCtx.
+func GoMSSQLDispatcherCtx(fs []interface{}) RowsGoDispatcherCtx {
+	return NewDispatcherFuncs(fs...).DispatcherCtx()
+}
+
+// GoMSSQLDispatcherNamed returns a dispatcher like that of GoMSSQLDispatcher, but the functions
+// are called by the keys of `fs` rather than by the names of their Go symbols
+func GoMSSQLDispatcherNamed(fs map[string]interface{}) RowsGoDispatcher {
+	names := make([]string, 0, len(fs))
+	for name := range fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	funcs := NewDispatcherFuncs()
+	for _, name := range names {
+		funcs.Register(name, fs[name])
+	}
+	return funcs.Dispatcher()
+}
 
-		funcType := reflect.TypeOf(f)
-		if funcType.Kind() != reflect.Func {
-			panic("Provided type is not a function")
+// DispatcherFuncs are the functions of a dispatcher by name, for registering functions by name
+// and by Go symbol in the same dispatcher and for inspecting the registered functions, e.g.
+//
+//	dispatcher := querysql.NewDispatcherFuncs(RecordMetric).
+//		Register("Audit", auditor.Audit).
+//		Dispatcher()
+//
+// Its dispatchers call a function once for each row of the dispatcher select, stopping at the
+// first error, which is returned; other return values are logged at debug level by the logger
+// of the query, and a panic is returned as an error. Like SQL, the names are case-insensitive.
+// The columns after the name are passed as the parameters in order, a single struct parameter
+// gets them by name, and with DispatcherCtx a trailing slice of structs gets the rows of the
+// result set after a single-row dispatcher select. Functions taking a context.Context first get
+// the context of the query from DispatcherCtx, and context.Background() from Dispatcher. NULL
+// columns are passed as nil pointers, UNIQUEIDENTIFIER as uuid.UUID, BIT as bool and text given
+// as bytes as string; sql.Scanner parameters, e.g. SQLMoney, are scanned from the column.
+type DispatcherFuncs struct {
+	// funcs are keyed by canonicalName of the names, while funcInfo.name keeps the case
+	funcs map[string]funcInfo
+	// names are the names of funcs in the order they were registered
+	names []string
+	// conflicts are the names registered by more than one of the DispatcherFuncs composed by
+	// WithAdditionalDispatcher, with the indices of those
+	conflicts   map[string][]int
+	onError     DispatchErrorPolicy
+	observers   []DispatchObserver
+	strictTypes bool
+}
+
+// NewDispatcherFuncs returns DispatcherFuncs with the functions in `fs` registered by the names
+// of their Go symbols, or by the names given with Func, see GoMSSQLDispatcher
+func NewDispatcherFuncs(fs ...interface{}) *DispatcherFuncs {
+	d := &DispatcherFuncs{funcs: map[string]funcInfo{}}
+	for _, f := range fs {
+		if named, ok := f.(NamedFunc); ok {
+			d.Register(named.Name, named.F)
+			continue
 		}
+		name, isClosure := goFunctionName(f)
+		d.add(name, isClosure, f)
+	}
+	return d
+}
 
-		fInfo.valueOf = reflect.ValueOf(f)
-		getFunctionName := func(fullName string) (string, bool) {
-			paths := strings.Split(fullName, "/")
-			lastPath := paths[len(paths)-1]
-			parts := strings.Split(lastPath, ".")
-			fName := parts[len(parts)-1]
-			matched, err := regexp.Match(`func\d+`, []byte(fName))
-			if err != nil {
-				panic(err.Error())
-			}
-			if matched {
-				return parts[len(parts)-2], true // It is a closure
+// Register registers `f` to be called by `name`, and returns `d`. Like GoMSSQLDispatcher it
+// panics if `f` is not a function, or if `name` is taken.
+func (d *DispatcherFuncs) Register(name string, f interface{}) *DispatcherFuncs {
+	if f == nil || reflect.TypeOf(f).Kind() != reflect.Func {
+		panic("Provided type is not a function")
+	}
+	d.add(name, false, f)
+	return d
+}
+
+// RegisterWithParams is like Register, but binds the columns of dispatcher selects to the
+// parameters of `f` by name rather than in order, so that e.g.
+//
+//	funcs.RegisterWithParams("Record", Record, "component", "val", "time")
+//
+// is called by `select _function='Record', time=1.23, component='abc', val=1`. The names are
+// case-insensitive. It panics unless there is a name for each parameter after any
+// context.Context, or if `f` is variadic or takes a struct or a payload, see DispatcherFuncs.
+func (d *DispatcherFuncs) RegisterWithParams(name string, f interface{}, params ...string) *DispatcherFuncs {
+	d.Register(name, f)
+	fInfo := d.funcs[canonicalName(name)]
+	if fInfo.variadic || fInfo.structArg || fInfo.payload {
+		panic(fmt.Sprintf("Function %s can not have named parameters since it is variadic or takes a struct or a payload", name))
+	}
+	if len(params) != fInfo.numArgs {
+		panic(fmt.Sprintf("Function %s has %d parameters but %d parameter names", name, fInfo.numArgs, len(params)))
+	}
+	for _, param := range params {
+		fInfo.paramNames = append(fInfo.paramNames, canonicalName(param))
+	}
+	d.funcs[canonicalName(name)] = fInfo
+	return d
+}
+
+// OnError sets what happens to the query when a dispatcher select calling one of the functions
+// of `d` fails, and returns `d`. The default is DispatchErrorAbort. The policy applies to the
+// functions registered before and after; with WithAdditionalDispatcher, a select calling an
+// unknown function only continues if all of the composed DispatcherFuncs continue.
+func (d *DispatcherFuncs) OnError(policy DispatchErrorPolicy) *DispatcherFuncs {
+	d.onError = policy
+	for name, fInfo := range d.funcs {
+		fInfo.onError = policy
+		d.funcs[name] = fInfo
+	}
+	return d
+}
+
+// WithDispatchObserver adds `observer` to be called around each call of the functions of `d`,
+// e.g. for metrics, and returns `d`. Like OnError it applies to the functions registered before
+// and after.
+func (d *DispatcherFuncs) WithDispatchObserver(observer DispatchObserver) *DispatcherFuncs {
+	d.observers = append(d.observers, observer)
+	for name, fInfo := range d.funcs {
+		fInfo.observers = append(fInfo.observers[:len(fInfo.observers):len(fInfo.observers)], observer)
+		d.funcs[name] = fInfo
+	}
+	return d
+}
+
+// StrictTypes only passes columns to parameters of the same type, after the conversions of MS SQL
+// types described for GoMSSQLDispatcher, and returns `d`. By default the columns are converted
+// to the parameters where Go allows it, so that e.g. an INT column is passed to a float64
+// parameter and a FLOAT column is truncated when passed to an int64 parameter, which can hide
+// that the select gives the wrong column. Like OnError it applies to the functions registered
+// before and after.
+func (d *DispatcherFuncs) StrictTypes() *DispatcherFuncs {
+	d.strictTypes = true
+	for name, fInfo := range d.funcs {
+		fInfo.strictTypes = true
+		d.funcs[name] = fInfo
+	}
+	return d
+}
+
+// Names returns the names of the registered functions in the order they were registered
+func (d *DispatcherFuncs) Names() []string {
+	return append([]string(nil), d.names...)
+}
+
+// Describe returns the number and types of the parameters of the function registered by `name`,
+// not counting a context.Context, and false if there is none; e.g. for checking at startup that
+// the functions called by SQL are registered. A variadic parameter is counted once, as a slice.
+func (d *DispatcherFuncs) Describe(name string) (numArgs int, argTypes []reflect.Type, ok bool) {
+	fInfo, ok := d.funcs[canonicalName(name)]
+	if !ok {
+		return 0, nil, false
+	}
+	return fInfo.numArgs, append([]reflect.Type(nil), fInfo.argType...), true
+}
+
+// Dispatcher returns a RowsGoDispatcher calling the functions registered so far, see
+// DispatcherFuncs
+func (d *DispatcherFuncs) Dispatcher() RowsGoDispatcher {
+	dispatcher := d.DispatcherCtx()
+	return func(rows *sql.Rows) error {
+		return dispatcher(context.Background(), rows)
+	}
+}
+
+// DispatcherCtx returns a RowsGoDispatcherCtx calling the functions registered so far, see
+// GoMSSQLDispatcherCtx
+func (d *DispatcherFuncs) DispatcherCtx() RowsGoDispatcherCtx {
+	funcs := d.clone()
+	return func(ctx context.Context, rows *sql.Rows) error {
+		return dispatch(ctx, rows, funcs)
+	}
+}
+
+func (d *DispatcherFuncs) clone() *DispatcherFuncs {
+	c := &DispatcherFuncs{funcs: make(map[string]funcInfo, len(d.funcs)), names: d.Names(), conflicts: d.conflicts, onError: d.onError, observers: d.observers, strictTypes: d.strictTypes}
+	for name, fInfo := range d.funcs {
+		c.funcs[name] = fInfo
+	}
+	return c
+}
+
+// composeDispatcherFuncs returns the functions of all of `ds`. Names registered in more than one
+// of them are conflicts, for which lookup returns an error.
+func composeDispatcherFuncs(ds []*DispatcherFuncs) *DispatcherFuncs {
+	composed := &DispatcherFuncs{funcs: map[string]funcInfo{}, conflicts: map[string][]int{}, onError: DispatchErrorContinue}
+	registeredBy := map[string]int{}
+	for i, d := range ds {
+		if d.onError != DispatchErrorContinue {
+			composed.onError = DispatchErrorAbort
+		}
+		for _, name := range d.names {
+			key := canonicalName(name)
+			if first, in := registeredBy[key]; in {
+				if len(composed.conflicts[key]) == 0 {
+					composed.conflicts[key] = []int{first}
+				}
+				composed.conflicts[key] = append(composed.conflicts[key], i)
+				continue
 			}
-			return fName, false
+			registeredBy[key] = i
+			composed.funcs[key] = d.funcs[key]
+			composed.names = append(composed.names, name)
 		}
-		fInfo.name, fInfo.isClosure = getFunctionName(runtime.FuncForPC(fInfo.valueOf.Pointer()).Name())
+	}
+	return composed
+}
 
-		if knownFuncs == "" {
-			knownFuncs = fmt.Sprintf("'%s'", fInfo.name)
-		} else {
-			knownFuncs = fmt.Sprintf("%s, '%s'", knownFuncs, fInfo.name)
+// has returns whether a function is registered by `fname`, including by more than one dispatcher
+func (d *DispatcherFuncs) has(fname string) bool {
+	key := canonicalName(fname)
+	_, ok := d.funcs[key]
+	_, conflict := d.conflicts[key]
+	return ok || conflict
+}
+
+// lookup returns the function registered by `fname`
+func (d *DispatcherFuncs) lookup(fname string) (funcInfo, error) {
+	key := canonicalName(fname)
+	if indices, conflict := d.conflicts[key]; conflict {
+		return funcInfo{}, fmt.Errorf("function '%s' is registered by more than one dispatcher added with WithAdditionalDispatcher (dispatchers %v)", fname, indices)
+	}
+	fInfo, ok := d.funcs[key]
+	if !ok {
+		knownFuncs := "'" + strings.Join(d.names, "', '") + "'"
+		return funcInfo{}, fmt.Errorf("could not find '%s'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of %s", fname, knownFuncs)
+	}
+	return fInfo, nil
+}
+
+// goFunctionName returns the name of the Go symbol of the function `f`, and whether it is a
+// closure, in which case the name is that of the enclosing function
+func goFunctionName(f interface{}) (string, bool) {
+	if reflect.TypeOf(f).Kind() != reflect.Func {
+		panic("Provided type is not a function")
+	}
+	fullName := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	paths := strings.Split(fullName, "/")
+	lastPath := paths[len(paths)-1]
+	parts := strings.Split(lastPath, ".")
+	fName := parts[len(parts)-1]
+	matched, err := regexp.Match(`func\d+`, []byte(fName))
+	if err != nil {
+		panic(err.Error())
+	}
+	if matched {
+		return parts[len(parts)-2], true // It is a closure
+	}
+	return fName, false
+}
+
+// add checks that `f` is a function the dispatcher can call and registers it by `name`
+func (d *DispatcherFuncs) add(name string, isClosure bool, f interface{}) {
+	fInfo := funcInfo{name: name, isClosure: isClosure, valueOf: reflect.ValueOf(f), onError: d.onError, observers: d.observers, strictTypes: d.strictTypes}
+
+	typeOfFunc := fInfo.valueOf.Type()
+	firstArg := 0
+	if typeOfFunc.NumIn() > 0 && typeOfFunc.In(0) == contextType {
+		fInfo.takesCtx = true
+		firstArg = 1
+	}
+	fInfo.numArgs = typeOfFunc.NumIn() - firstArg
+	fInfo.argType = make([]reflect.Type, fInfo.numArgs)
+
+	for i := 0; i < fInfo.numArgs; i++ {
+		fInfo.argType[i] = typeOfFunc.In(firstArg + i)
+	}
+	fInfo.variadic = typeOfFunc.IsVariadic()
+	if fInfo.numArgs == 1 && !fInfo.variadic {
+		argType := fInfo.argType[0]
+		// time.Time and types scanned by themselves are passed a single column as usual
+		fInfo.structArg = argType.Kind() == reflect.Struct && argType != timeType && !reflect.PointerTo(argType).Implements(scannerType)
+	}
+	if fInfo.numArgs > 0 && !fInfo.variadic {
+		argType := fInfo.argType[fInfo.numArgs-1]
+		fInfo.payload = argType.Kind() == reflect.Slice && argType.Elem().Kind() == reflect.Struct && argType.Elem() != timeType
+	}
+	fInfo.numResults = typeOfFunc.NumOut()
+	if fInfo.numResults > 0 && typeOfFunc.Out(fInfo.numResults-1) == errorType {
+		fInfo.returnsError = true
+		fInfo.numResults--
+	}
+	key := canonicalName(fInfo.name)
+	if registered, in := d.funcs[key]; in {
+		if registered.name != fInfo.name {
+			panic(fmt.Sprintf("Function %s collides with %s in dispatcher, the names are case-insensitive", fInfo.name, registered.name))
 		}
+		panic(fmt.Sprintf("Function already in dispatcher %s (closure==%v)", fInfo.name, fInfo.isClosure))
+	}
+	d.funcs[key] = fInfo
+	d.names = append(d.names, fInfo.name)
+}
 
-		typeOfFunc := fInfo.valueOf.Type()
-		fInfo.numArgs = typeOfFunc.NumIn()
-		fInfo.argType = make([]reflect.Type, fInfo.numArgs)
+// dispatch calls the functions of `funcs` named by the first column of each of `rows`
+func dispatch(ctx context.Context, rows *sql.Rows, funcs *DispatcherFuncs) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
 
-		for i := 0; i < fInfo.numArgs; i++ {
-			fInfo.argType[i] = funcType.In(i)
+	fields := make([]interface{}, len(cols))
+	scanPointers := make([]interface{}, len(cols))
+	for i := 0; i < len(cols); i++ {
+		scanPointers[i] = &fields[i]
+	}
+	for n := 0; rows.Next(); n++ {
+		if n%ctxCheckInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
 		}
-		if _, in := funcMap[fInfo.name]; in {
-			panic(fmt.Sprintf("Function already in dispatcher %s (closure==%v)", fInfo.name, fInfo.isClosure))
+		if err = rows.Scan(scanPointers...); err != nil {
+			return err
+		}
+		if err = dispatchRow(ctx, fields, colTypes, funcs); err != nil {
+			return err
 		}
-		funcMap[fInfo.name] = fInfo
 	}
+	// A cancelled context makes database/sql close the rows, which ends the loop above early
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	return rows.Err()
+}
 
-	return func(rows *sql.Rows) error {
-		cols, err := rows.Columns()
+// dispatchWithFallback is like dispatch, but passes the rows calling a function that `funcs`
+// does not have to `fallback`, each run of such consecutive rows as one *sql.Rows
+func dispatchWithFallback(ctx context.Context, rows *sql.Rows, funcs *DispatcherFuncs, fallback RowsGoDispatcherCtx) error {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	set, err := readBufferedSetCtx(ctx, rows)
+	if err != nil {
+		return err
+	}
+	var unknown [][]any
+	dispatchUnknown := func() error {
+		if len(unknown) == 0 {
+			return nil
+		}
+		fallbackRows, err := (&bufferedSet{columns: set.columns, databaseTypes: set.databaseTypes, rows: unknown}).Rows()
+		unknown = nil
 		if err != nil {
 			return err
 		}
-		colTypes, err := rows.ColumnTypes()
+		defer func() { _ = fallbackRows.Close() }()
+		return fallback(ctx, fallbackRows)
+	}
+	for _, fields := range set.rows {
+		if fname, ok := fields[0].(string); ok && !funcs.has(fname) {
+			unknown = append(unknown, fields)
+			continue
+		}
+		if err = dispatchUnknown(); err != nil {
+			return err
+		}
+		if err = dispatchRow(ctx, fields, colTypes, funcs); err != nil {
+			return err
+		}
+	}
+	return dispatchUnknown()
+}
+
+// dispatchRow calls the function named by the first of `fields` with the others as arguments
+func dispatchRow(ctx context.Context, fields []interface{}, colTypes []*sql.ColumnType, funcs *DispatcherFuncs) error {
+	// The first argument to the select is expected to be a string
+	// with the name of the function to be called
+	fname, ok := fields[0].(string)
+	if !ok {
+		// The first argument is expected to be a string, but we can get nil if we do something like `select _function=... where 1=2`
+		// The lack of results is not an error, and it just means there is nothing to do
+		if fields[0] == nil {
+			return nil
+		}
+		return funcs.onError.wrap(fmt.Errorf("first argument to 'select' is expected to be a string. Got '%v' of type '%s' instead", fields[0], reflect.TypeOf(fields[0]).String()))
+	}
+	fInfo, err := funcs.lookup(fname)
+	if err != nil {
+		return funcs.onError.wrap(err)
+	}
+	start := time.Now()
+	err = callFunc(ctx, fname, fInfo, fields, colTypes)
+	for _, observer := range fInfo.observers {
+		observer(fname, time.Since(start), err)
+	}
+	return fInfo.onError.wrap(err)
+}
+
+// callFunc calls `fInfo` with the values of `fields` after the function name
+func callFunc(ctx context.Context, fname string, fInfo funcInfo, fields []interface{}, colTypes []*sql.ColumnType) error {
+	var err error
+	if fInfo.paramNames != nil {
+		fields, colTypes, err = bindParamNames(fname, fInfo.paramNames, fields, colTypes)
 		if err != nil {
 			return err
 		}
+	}
 
-		fields := make([]interface{}, len(cols))
-		scanPointers := make([]interface{}, len(cols))
-		for i := 0; i < len(cols); i++ {
-			scanPointers[i] = &fields[i]
+	var in []reflect.Value
+	switch {
+	case fInfo.structArg:
+		arg, err := dispatchStructArg(fname, fInfo.argType[0], fields, colTypes, fInfo.strictTypes)
+		if err != nil {
+			return err
+		}
+		in = []reflect.Value{arg}
+	case fInfo.variadic && len(fields)-1 < fInfo.numArgs-1:
+		return fmt.Errorf("incorrect number of parameters for function '%s': expected at least %d but got %d", fname, fInfo.numArgs-1, len(fields)-1)
+	case fInfo.payload && len(fields)-1 != fInfo.numArgs-1:
+		return fmt.Errorf("incorrect number of parameters for function '%s': expected %d columns before the payload result set but got %d", fname, fInfo.numArgs-1, len(fields)-1)
+	case !fInfo.variadic && !fInfo.payload && len(fields)-1 != fInfo.numArgs:
+		return fmt.Errorf("incorrect number of parameters for function '%s'", fname)
+	default:
+		// Set up the args for calling fo the function; the values for a variadic parameter are
+		// passed one by one, which reflect.Value.Call allows
+		in = make([]reflect.Value, len(fields)-1)
+		for i, value := range fields {
+			if i == 0 {
+				continue // function name
+			}
+			in[i-1], err = dispatchArg(value, colTypes[i], fInfo.paramType(i-1), fInfo.strictTypes)
+			if err != nil {
+				return err
+			}
 		}
-		for rows.Next() {
-			if err = rows.Scan(scanPointers...); err != nil {
+		if fInfo.payload {
+			payload, err := dispatchPayload(ctx, fname, fInfo.argType[fInfo.numArgs-1])
+			if err != nil {
 				return err
 			}
+			in = append(in, payload)
 		}
+	}
 
-		// The first argument to the select is expected to be a string
-		// with the name of the function to be called
-		fname, ok := fields[0].(string)
-		if !ok {
-			// The first argument is expected to be a string, but we can get nil if we do something like `select _function=... where 1=2`
-			// The lack of results is not an error, and it just means there is nothing to do
-			if fields[0] == nil {
-				return nil
+	if fInfo.takesCtx {
+		in = append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, in...)
+	}
+	out, err := recoverCall(ctx, fname, fInfo.valueOf, in, fields, colTypes)
+	if err != nil {
+		return err
+	}
+	if fInfo.returnsError && !out[fInfo.numResults].IsNil() {
+		return fmt.Errorf("%s: %w", fname, out[fInfo.numResults].Interface().(error))
+	}
+	if fInfo.numResults > 0 {
+		if logResults, ok := ctx.Value(ckDispatchResultLogger).(func(fname string, results []any) error); ok {
+			results := make([]any, fInfo.numResults)
+			for i := range results {
+				results[i] = out[i].Interface()
 			}
-			return fmt.Errorf("first argument to 'select' is expected to be a string. Got '%v' of type '%s' instead", fields[0], reflect.TypeOf(fields[0]).String())
-		}
-		fInfo, ok := funcMap[fname]
-		if !ok {
-			return fmt.Errorf("could not find '%s'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of %s", fname, knownFuncs)
+			return logResults(fname, results)
 		}
+	}
+	return nil
+}
 
-		if len(cols)-1 != fInfo.numArgs {
-			return fmt.Errorf("incorrect number of parameters for function '%s'", fname)
+// recoverCall calls `f` with `in`, and returns an error with the columns of the row if it
+// panics, with the values of the columns redacted by LogRedaction(ctx) left out
+func recoverCall(ctx context.Context, fname string, f reflect.Value, in []reflect.Value, fields []interface{}, colTypes []*sql.ColumnType) (out []reflect.Value, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
 		}
+		columns := formatDispatchColumns(fields, colTypes, LogRedaction(ctx))
+		if rErr, ok := r.(error); ok {
+			err = fmt.Errorf("dispatch to '%s' panicked: %w (%s)", fname, rErr, columns)
+		} else {
+			err = fmt.Errorf("dispatch to '%s' panicked: %v (%s)", fname, r, columns)
+		}
+	}()
+	return f.Call(in), nil
+}
 
-		// Set up the args for calling fo the function
-		in := make([]reflect.Value, fInfo.numArgs)
-		for i, value := range fields {
-			if i == 0 {
-				continue // function name
+// formatDispatchColumns formats the columns after the function name as `name=value`, the values
+// formatted as by the loggers
+func formatDispatchColumns(fields []interface{}, colTypes []*sql.ColumnType, redact func(column string) bool) string {
+	cfg := newLoggerConfig(nil)
+	columns := make([]string, 0, len(fields)-1)
+	for i := 1; i < len(fields); i++ {
+		var value any = RedactedValue
+		if redact == nil || !redact(colTypes[i].Name()) {
+			var err error
+			if value, err = cfg.logValue(fields[i], colTypes[i].DatabaseTypeName()); err != nil {
+				value = fields[i]
 			}
+		}
+		columns = append(columns, formatStdField(colTypes[i].Name(), value))
+	}
+	return strings.Join(columns, " ")
+}
 
-			// Convert MSSQL types to Go types
-			switch typedValue := value.(type) {
-			case []uint8:
-				switch colTypes[i].DatabaseTypeName() {
-				case "DECIMAL":
-					str := string(typedValue)
-					value, err = strconv.ParseFloat(str, 64)
-					if err != nil {
-						return fmt.Errorf("could not convert argument '%s' of '%s' to float64",
-							str,
-							colTypes[i].Name())
-					}
-				case "MONEY":
-					str := string(typedValue)
-					value, err = strconv.ParseFloat(str, 64)
-					if err != nil {
-						return fmt.Errorf("could not convert argument '%s' of '%s' to float64",
-							str,
-							colTypes[i].Name())
-					}
-				}
+// bindParamNames returns `fields` and `colTypes` reordered so that the columns after the
+// function name are in the order of `paramNames`
+func bindParamNames(fname string, paramNames []string, fields []interface{}, colTypes []*sql.ColumnType) ([]interface{}, []*sql.ColumnType, error) {
+	bound := make([]interface{}, len(paramNames)+1)
+	boundTypes := make([]*sql.ColumnType, len(paramNames)+1)
+	bound[0], boundTypes[0] = fields[0], colTypes[0]
+	expected := "'" + strings.Join(paramNames, "', '") + "'"
+	for i := 1; i < len(fields); i++ {
+		col := canonicalName(colTypes[i].Name())
+		j := 0
+		for j < len(paramNames) && paramNames[j] != col {
+			j++
+		}
+		if j == len(paramNames) {
+			return nil, nil, fmt.Errorf("column '%s' is not a parameter of function '%s'.  Expected the columns %s", colTypes[i].Name(), fname, expected)
+		}
+		if boundTypes[j+1] != nil {
+			return nil, nil, fmt.Errorf("column '%s' is given more than once for function '%s'", colTypes[i].Name(), fname)
+		}
+		bound[j+1], boundTypes[j+1] = fields[i], colTypes[i]
+	}
+	for j, param := range paramNames {
+		if boundTypes[j+1] == nil {
+			return nil, nil, fmt.Errorf("missing column '%s' for function '%s'.  Expected the columns %s", param, fname, expected)
+		}
+	}
+	return bound, boundTypes, nil
+}
+
+// dispatchPayload reads the result set after the dispatcher select into a slice of `sliceType`
+// for the last parameter of the function `fname`, like SliceOf
+func dispatchPayload(ctx context.Context, fname string, sliceType reflect.Type) (reflect.Value, error) {
+	nextPayloadSet, ok := ctx.Value(ckDispatchPayload).(func() (*sql.Rows, error))
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("function '%s' takes a payload result set, which needs the dispatcher to be passed the context of the query, e.g. with GoMSSQLDispatcherCtx", fname)
+	}
+	rows, err := nextPayloadSet()
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("payload of function '%s': %w", fname, err)
+	}
+	payload := reflect.MakeSlice(sliceType, 0, 0)
+	row := reflect.New(sliceType.Elem())
+	var scanPointers []interface{}
+	for rows.Next() {
+		if scanPointers == nil {
+			if scanPointers, _, err = getPointersToFields(rows, row.Interface()); err != nil {
+				return reflect.Value{}, fmt.Errorf("payload of function '%s': %w", fname, err)
 			}
+		}
+		if err = rows.Scan(scanPointers...); err != nil {
+			return reflect.Value{}, fmt.Errorf("payload of function '%s': %w", fname, err)
+		}
+		payload = reflect.Append(payload, row.Elem())
+	}
+	if err = rows.Err(); err != nil {
+		return reflect.Value{}, fmt.Errorf("payload of function '%s': %w", fname, err)
+	}
+	return payload, nil
+}
 
-			// Check if SQL type and Go func type match
-			reflectedValue := reflect.ValueOf(value)
-			sqlType := reflect.TypeOf(value)
-			fArgType := fInfo.argType[i-1]
-			if fArgType != sqlType {
-				// Try to convert the sql value to the expected type
-				if !reflectedValue.CanConvert(fArgType) {
-					return fmt.Errorf("expected parameter '%s' to be of type '%s' but got '%s' instead",
-						colTypes[i].Name(),
-						fArgType,
-						sqlType)
-				}
-				reflectedValue = reflectedValue.Convert(fArgType)
+// dispatchStructArg returns a struct of type `structType` with the fields set to the columns of
+// the same canonical name, as for scanning rows into structs. Every exported field must be set
+// by a column, and every column must set a field.
+func dispatchStructArg(fname string, structType reflect.Type, fields []interface{}, colTypes []*sql.ColumnType, strict bool) (reflect.Value, error) {
+	ptr := reflect.New(structType)
+	names := DeepFieldNames(ptr.Interface())
+	pointers := DeepFieldPointers(ptr.Interface())
+	name2index := make(map[string]int, len(names))
+	for i, name := range names {
+		if pointers[i] != nil {
+			name2index[canonicalName(name)] = i
+		}
+	}
+
+	set := make([]bool, len(names))
+	for i := 1; i < len(fields); i++ {
+		j, ok := name2index[canonicalName(colTypes[i].Name())]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("column '%s' does not map to a field of '%s' for function '%s'", colTypes[i].Name(), structType, fname)
+		}
+		field := reflect.ValueOf(pointers[j]).Elem()
+		value, err := dispatchArg(fields[i], colTypes[i], field.Type(), strict)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		field.Set(value)
+		set[j] = true
+	}
+	for i, name := range names {
+		if pointers[i] != nil && !set[i] {
+			return reflect.Value{}, fmt.Errorf("field '%s' of '%s' is not set by any column for function '%s'", name, structType, fname)
+		}
+	}
+	return ptr.Elem(), nil
+}
+
+// dispatchArg converts the value of a column to `argType`. NULL is only allowed for pointer
+// and interface types, and is passed as nil.
+func dispatchArg(value interface{}, colType *sql.ColumnType, argType reflect.Type, strict bool) (reflect.Value, error) {
+	switch {
+	case value == nil && (argType.Kind() == reflect.Pointer || argType.Kind() == reflect.Interface):
+		return reflect.Zero(argType), nil
+	case argType.Kind() == reflect.Pointer && reflect.TypeOf(value) != argType:
+		elem, err := dispatchArg(value, colType, argType.Elem(), strict)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(argType.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case argType != uuidType && reflect.PointerTo(argType).Implements(scannerType):
+		// e.g. SQLMoney or sql.NullString; uuid.UUID does not know the byte order of MS SQL
+		ptr := reflect.New(argType)
+		if err := ptr.Interface().(sql.Scanner).Scan(value); err != nil {
+			return reflect.Value{}, fmt.Errorf("could not convert argument of '%s' to '%s': %w", colType.Name(), argType, err)
+		}
+		return ptr.Elem(), nil
+	case value == nil:
+		return reflect.Value{}, fmt.Errorf("parameter '%s' is NULL, but the function takes '%s'; take a pointer to allow NULL",
+			colType.Name(),
+			argType)
+	}
+
+	var err error
+	if colType.DatabaseTypeName() == "BIT" {
+		// the driver may give BIT as bool, int64 or text; pass it as bool, or 0 and 1 to integers
+		value, err = bitLogValue(value)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("could not convert argument of '%s' to bool: %w", colType.Name(), err)
+		}
+		if argType.Kind() >= reflect.Int && argType.Kind() <= reflect.Uint64 {
+			if value == true {
+				value = int64(1)
+			} else {
+				value = int64(0)
 			}
-			in[i-1] = reflectedValue
 		}
+	}
 
-		fInfo.valueOf.Call(in)
+	// Convert MSSQL types to Go types
+	switch typedValue := value.(type) {
+	case time.Time:
+		if argType.Kind() == reflect.String {
+			value = typedValue.Format(time.RFC3339Nano)
+		}
+	case string:
+		if argType == timeType && isSQLTimeType(colType.DatabaseTypeName()) {
+			value, err = parseSQLTime(typedValue)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("could not convert argument '%s' of '%s' to time.Time",
+					typedValue,
+					colType.Name())
+			}
+		}
+	case []uint8:
+		// the driver gives the bytes of UNIQUEIDENTIFIER in the mixed-endian order of MS SQL;
+		// functions taking []byte get them as they are
+		if colType.DatabaseTypeName() == "UNIQUEIDENTIFIER" && argType.Kind() == reflect.Slice {
+			break
+		}
+		value, err = ConvertSQLBytes(typedValue, colType.DatabaseTypeName())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("could not convert argument of '%s' from %s: %w", colType.Name(), colType.DatabaseTypeName(), err)
+		}
+		if id, ok := value.(uuid.UUID); ok && argType.Kind() == reflect.String {
+			value = id.String()
+		}
+	}
 
-		if err = rows.Err(); err != nil {
-			return err
+	// Check if SQL type and Go func type match
+	reflectedValue := reflect.ValueOf(value)
+	sqlType := reflect.TypeOf(value)
+	if argType != sqlType {
+		if strict && !(argType.Kind() == reflect.Interface && sqlType.Implements(argType)) {
+			return reflect.Value{}, fmt.Errorf("expected parameter '%s' to be of type '%s' but got '%s' instead; types must match exactly with StrictTypes",
+				colType.Name(),
+				argType,
+				sqlType)
 		}
+		// Try to convert the sql value to the expected type
+		if !reflectedValue.CanConvert(argType) {
+			return reflect.Value{}, fmt.Errorf("expected parameter '%s' to be of type '%s' but got '%s' instead",
+				colType.Name(),
+				argType,
+				sqlType)
+		}
+		reflectedValue = reflectedValue.Convert(argType)
+	}
+	return reflectedValue, nil
+}
 
-		return nil
+// sqlTimeLayouts are the layouts of the time types of MS SQL as text, with and without offset
+var sqlTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.9999999 -07:00",
+	"2006-01-02 15:04:05.9999999",
+	"2006-01-02",
+}
+
+func isSQLTimeType(databaseTypeName string) bool {
+	switch databaseTypeName {
+	case "DATE", "DATETIME", "DATETIME2", "SMALLDATETIME", "DATETIMEOFFSET":
+		return true
+	}
+	return false
+}
+
+// parseSQLTime parses a time given as text, e.g. a DATETIMEOFFSET converted to NVARCHAR; times
+// without an offset are UTC
+func parseSQLTime(value string) (time.Time, error) {
+	var err error
+	for _, layout := range sqlTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, err
 }
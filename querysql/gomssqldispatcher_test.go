@@ -0,0 +1,810 @@
+package querysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInvalidLabel = errors.New("invalid label")
+
+func dispatchedWithError(label string) error {
+	if label == "" {
+		return errInvalidLabel
+	}
+	return nil
+}
+
+func dispatchedWithResult(label string) int {
+	return len(label)
+}
+
+func dispatchedWithResults(label string) (string, float64, error) {
+	if label == "" {
+		return "", 0, errInvalidLabel
+	}
+	return label + label, 0.5, nil
+}
+
+type dispatchKey struct{}
+
+var dispatchedCtxValues []any
+
+func dispatchedWithCtx(ctx context.Context, label string) {
+	dispatchedCtxValues = append(dispatchedCtxValues, ctx.Value(dispatchKey{}), label)
+}
+
+func TestGoMSSQLDispatcherError(t *testing.T) {
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedWithError}).Dispatcher()
+	dispatch := func(label string) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "label"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+			rows:          [][]any{{"dispatchedWithError", label}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(rows)
+	}
+
+	assert.NoError(t, dispatch("ok"))
+	err := dispatch("")
+	assert.ErrorIs(t, err, errInvalidLabel)
+	assert.Equal(t, "dispatchedWithError: invalid label", err.Error())
+}
+
+func TestDispatchResults(t *testing.T) {
+	var logged []string
+	logger := func(rows *sql.Rows) error {
+		set, err := readBufferedSet(rows)
+		require.NoError(t, err)
+		logged = append(logged, fmt.Sprint(set.columns, set.rows))
+		return nil
+	}
+	funcs := NewDispatcherFuncs(dispatchedWithResult, dispatchedWithResults)
+	dispatch := func(rs *ResultSets, fname, label string) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "label"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+			rows:          [][]any{{fname, label}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		rs.Rows = rows
+		return rs.processDispatcherSelect()
+	}
+
+	rs := &ResultSets{Logger: logger, DispatcherCtx: funcs.DispatcherCtx()}
+	require.NoError(t, dispatch(rs, "dispatchedWithResult", "abc"))
+	require.NoError(t, dispatch(rs, "dispatchedWithResults", "abc"))
+	assert.EqualError(t, dispatch(rs, "dispatchedWithResults", ""), "result set 0: dispatchedWithResults: invalid label")
+	assert.Equal(t, []string{
+		"[_log function result_0] [[debug dispatchedWithResult 3]]",
+		"[_log function result_0 result_1] [[debug dispatchedWithResults abcabc 0.5]]",
+	}, logged)
+
+	// without the context of the query there is no logger
+	logged = nil
+	rs = &ResultSets{Logger: logger, Dispatcher: funcs.Dispatcher()}
+	require.NoError(t, dispatch(rs, "dispatchedWithResult", "abc"))
+	assert.Empty(t, logged)
+}
+
+func TestGoMSSQLDispatcherCtx(t *testing.T) {
+	dispatchedCtxValues = nil
+	ctx := context.WithValue(context.Background(), dispatchKey{}, "value")
+	functions := []interface{}{dispatchedWithCtx, dispatchedWithError}
+	set := &bufferedSet{
+		columns:       []string{"_function", "label"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"dispatchedWithCtx", "x"}},
+	}
+	for _, rs := range []*ResultSets{
+		{ctx: ctx, DispatcherCtx: GoMSSQLDispatcherCtx(functions)},
+		// without the context of the query
+		{ctx: ctx, Dispatcher: GoMSSQLDispatcher(functions).Dispatcher()},
+	} {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		rs.Rows = rows
+		require.NoError(t, rs.processDispatcherSelect())
+		require.NoError(t, rows.Close())
+	}
+	assert.Equal(t, []any{"value", "x", nil, "x"}, dispatchedCtxValues)
+}
+
+type dispatchedMethods struct {
+	labels []string
+}
+
+func (m *dispatchedMethods) Record(label string) {
+	m.labels = append(m.labels, label)
+}
+
+func TestGoMSSQLDispatcherNamed(t *testing.T) {
+	methods := &dispatchedMethods{}
+	dispatch := func(dispatcher RowsGoDispatcher, fname string) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "label"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+			rows:          [][]any{{fname, "x"}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(rows)
+	}
+
+	named := GoMSSQLDispatcherNamed(map[string]interface{}{
+		"Record":   methods.Record,
+		"Validate": dispatchedWithError,
+	})
+	require.NoError(t, dispatch(named, "Record"))
+	assert.Equal(t, []string{"x"}, methods.labels)
+	assert.EqualError(t, dispatch(named, "dispatchedWithError"),
+		"could not find 'dispatchedWithError'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'Record', 'Validate'")
+
+	funcs := NewDispatcherFuncs(dispatchedWithError).Register("Record", methods.Record)
+	assert.Equal(t, []string{"dispatchedWithError", "Record"}, funcs.Names())
+	mixed := funcs.Dispatcher()
+	require.NoError(t, dispatch(mixed, "dispatchedWithError"))
+	require.NoError(t, dispatch(mixed, "Record"))
+	assert.Equal(t, []string{"x", "x"}, methods.labels)
+	assert.EqualError(t, dispatch(mixed, "Missing"),
+		"could not find 'Missing'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'dispatchedWithError', 'Record'")
+
+	assert.PanicsWithValue(t, "Function already in dispatcher Record (closure==false)", func() {
+		funcs.Register("Record", dispatchedWithError)
+	})
+	assert.PanicsWithValue(t, "Provided type is not a function", func() {
+		funcs.Register("Other", "not a function")
+	})
+
+	// closures created in the same function are told apart by Func, and can be mixed with
+	// functions named by their Go symbol
+	var labels []string
+	closureFuncs := GoMSSQLDispatcher([]interface{}{
+		Func("First", func(label string) { labels = append(labels, "first "+label) }),
+		Func("Second", func(label string) { labels = append(labels, "second "+label) }),
+		dispatchedWithError,
+	})
+	assert.Equal(t, []string{"First", "Second", "dispatchedWithError"}, closureFuncs.Names())
+	numArgs, argTypes, ok := closureFuncs.Describe("second")
+	assert.True(t, ok)
+	assert.Equal(t, 1, numArgs)
+	assert.Equal(t, []reflect.Type{reflect.TypeOf("")}, argTypes)
+	closures := closureFuncs.Dispatcher()
+	require.NoError(t, dispatch(closures, "Second"))
+	require.NoError(t, dispatch(closures, "First"))
+	require.NoError(t, dispatch(closures, "dispatchedWithError"))
+	assert.Equal(t, []string{"second x", "first x"}, labels)
+	// SQL is case-insensitive, and so are the names
+	methods.labels = nil
+	require.NoError(t, dispatch(mixed, "record"))
+	require.NoError(t, dispatch(mixed, "DISPATCHEDWITHERROR"))
+	assert.Equal(t, []string{"x"}, methods.labels)
+	assert.EqualError(t, dispatch(mixed, "missing"),
+		"could not find 'missing'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'dispatchedWithError', 'Record'")
+	assert.PanicsWithValue(t, "Function RECORD collides with Record in dispatcher, the names are case-insensitive", func() {
+		funcs.Register("RECORD", dispatchedWithError)
+	})
+	numArgs, _, ok = funcs.Describe("RECORD")
+	assert.True(t, ok)
+	assert.Equal(t, 1, numArgs)
+
+	unnamed := []interface{}{func(label string) {}, func(label string) {}}
+	assert.PanicsWithValue(t, "Function already in dispatcher TestGoMSSQLDispatcherNamed (closure==true)", func() {
+		GoMSSQLDispatcher(unnamed)
+	})
+}
+
+func TestWithAdditionalDispatcher(t *testing.T) {
+	methods := &dispatchedMethods{}
+	ctx := WithAdditionalDispatcher(context.Background(), NewDispatcherFuncs(dispatchedWithError))
+	ctx = WithAdditionalDispatcher(ctx, NewDispatcherFuncs().Register("Record", methods.Record))
+	conflicting := WithAdditionalDispatcher(ctx, NewDispatcherFuncs().Register("dispatchedWithError", methods.Record))
+	dispatch := func(ctx context.Context, fname string) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "label"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+			rows:          [][]any{{fname, "x"}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return DispatcherCtx(ctx)(ctx, rows)
+	}
+
+	require.NoError(t, dispatch(ctx, "dispatchedWithError"))
+	require.NoError(t, dispatch(ctx, "Record"))
+	assert.Equal(t, []string{"x"}, methods.labels)
+	assert.EqualError(t, dispatch(ctx, "Missing"),
+		"could not find 'Missing'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'dispatchedWithError', 'Record'")
+
+	require.NoError(t, dispatch(conflicting, "Record"))
+	assert.EqualError(t, dispatch(conflicting, "dispatchedWithError"),
+		"function 'dispatchedWithError' is registered by more than one dispatcher added with WithAdditionalDispatcher (dispatchers [0 2])")
+
+	// Functions the DispatcherFuncs do not have go to the dispatcher of the application
+	app := &dispatchedMethods{}
+	methods.labels = nil
+	ctx = WithDispatcher(context.Background(), NewDispatcherFuncs().Register("Record", app.Record).Dispatcher())
+	ctx = WithAdditionalDispatcher(ctx, NewDispatcherFuncs().Register("Library", methods.Record))
+	ctx = WithAdditionalDispatcher(ctx, NewDispatcherFuncs(dispatchedWithError))
+	set := &bufferedSet{
+		columns:       []string{"_function", "label"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"Record", "a"}, {"Record", "b"}, {"Library", "c"}, {"Record", "d"}},
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	require.NoError(t, DispatcherCtx(ctx)(ctx, rows))
+	assert.Equal(t, []string{"a", "b", "d"}, app.labels)
+	assert.Equal(t, []string{"c"}, methods.labels)
+	assert.ErrorContains(t, dispatch(ctx, "Missing"), "could not find 'Missing'")
+}
+
+func TestDispatchCancelled(t *testing.T) {
+	methods := &dispatchedMethods{}
+	dispatcher := NewDispatcherFuncs().Register("Record", methods.Record).DispatcherCtx()
+	set := &bufferedSet{
+		columns:       []string{"_function", "label"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"Record", "a"}},
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, dispatcher(ctx, rows), context.Canceled)
+	assert.Empty(t, methods.labels)
+}
+
+func TestGoMSSQLDispatcherRows(t *testing.T) {
+	methods := &dispatchedMethods{}
+	dispatcher := NewDispatcherFuncs(dispatchedWithError).Register("Record", methods.Record).Dispatcher()
+	dispatch := func(rows [][]any) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "label"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+			rows:          rows,
+		}
+		sqlRows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = sqlRows.Close() }()
+		return dispatcher(sqlRows)
+	}
+
+	require.NoError(t, dispatch([][]any{{"Record", "a"}, {"Record", "b"}, {"Record", "c"}}))
+	assert.Equal(t, []string{"a", "b", "c"}, methods.labels)
+
+	// stops at the first error
+	methods.labels = nil
+	err := dispatch([][]any{{"Record", "a"}, {"dispatchedWithError", ""}, {"Record", "c"}})
+	assert.ErrorIs(t, err, errInvalidLabel)
+	assert.Equal(t, []string{"a"}, methods.labels)
+}
+
+var dispatchedTags [][]string
+
+func dispatchedVariadic(metric string, tags ...string) {
+	dispatchedTags = append(dispatchedTags, append([]string{metric}, tags...))
+}
+
+func TestGoMSSQLDispatcherVariadic(t *testing.T) {
+	dispatchedTags = nil
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedVariadic}).Dispatcher()
+	dispatch := func(row ...any) error {
+		set := &bufferedSet{columns: []string{"_function"}, databaseTypes: []string{"NVARCHAR"}, rows: [][]any{row}}
+		for i := 1; i < len(row); i++ {
+			set.columns = append(set.columns, fmt.Sprintf("c%d", i))
+			set.databaseTypes = append(set.databaseTypes, "NVARCHAR")
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(rows)
+	}
+
+	require.NoError(t, dispatch("dispatchedVariadic", "m0"))
+	require.NoError(t, dispatch("dispatchedVariadic", "m1", "a"))
+	require.NoError(t, dispatch("dispatchedVariadic", "m5", "a", "b", "c", "d", "e"))
+	assert.Equal(t, [][]string{{"m0"}, {"m1", "a"}, {"m5", "a", "b", "c", "d", "e"}}, dispatchedTags)
+
+	assert.EqualError(t, dispatch("dispatchedVariadic"),
+		"incorrect number of parameters for function 'dispatchedVariadic': expected at least 1 but got 0")
+	assert.EqualError(t, dispatch("dispatchedVariadic", "m", "a", 1.5),
+		"expected parameter 'c3' to be of type 'string' but got 'float64' instead")
+}
+
+type dispatchedPayment struct {
+	ID     uuid.UUID
+	Amount float64
+	Label  string
+}
+
+var dispatchedPayments []dispatchedPayment
+
+func dispatchedWithStruct(payment dispatchedPayment) {
+	dispatchedPayments = append(dispatchedPayments, payment)
+}
+
+func TestGoMSSQLDispatcherStruct(t *testing.T) {
+	dispatchedPayments = nil
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedWithStruct}).Dispatcher()
+	id := uuid.MustParse("fdbd3b3a-1c3b-4e66-a4d0-8f4b3c0cb7ec")
+	idBytes := []byte{0x3a, 0x3b, 0xbd, 0xfd, 0x3b, 0x1c, 0x66, 0x4e, 0xa4, 0xd0, 0x8f, 0x4b, 0x3c, 0x0c, 0xb7, 0xec}
+	dispatch := func(columns []string, databaseTypes []string, row ...any) error {
+		set := &bufferedSet{
+			columns:       append([]string{"_function"}, columns...),
+			databaseTypes: append([]string{"NVARCHAR"}, databaseTypes...),
+			rows:          [][]any{append([]any{"dispatchedWithStruct"}, row...)},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(rows)
+	}
+
+	// the columns are mapped by name, in any order
+	require.NoError(t, dispatch(
+		[]string{"label", "amount", "id"},
+		[]string{"NVARCHAR", "MONEY", "UNIQUEIDENTIFIER"},
+		"x", []byte("12.50"), idBytes))
+	assert.Equal(t, []dispatchedPayment{{ID: id, Amount: 12.5, Label: "x"}}, dispatchedPayments)
+
+	assert.EqualError(t, dispatch(
+		[]string{"label", "amount"},
+		[]string{"NVARCHAR", "MONEY"},
+		"x", []byte("12.50")),
+		"field 'ID' of 'querysql.dispatchedPayment' is not set by any column for function 'dispatchedWithStruct'")
+	assert.EqualError(t, dispatch(
+		[]string{"label", "amount", "id", "extra"},
+		[]string{"NVARCHAR", "MONEY", "UNIQUEIDENTIFIER", "INT"},
+		"x", []byte("12.50"), idBytes, int64(1)),
+		"column 'extra' does not map to a field of 'querysql.dispatchedPayment' for function 'dispatchedWithStruct'")
+}
+
+var dispatchedParams []any
+
+func dispatchedWithParams(component string, val int64, time float64) {
+	dispatchedParams = append(dispatchedParams, component, val, time)
+}
+
+func TestRegisterWithParams(t *testing.T) {
+	dispatchedParams = nil
+	dispatcher := NewDispatcherFuncs().
+		RegisterWithParams("Record", dispatchedWithParams, "component", "val", "time").
+		Dispatcher()
+	dispatch := func(columns []string, row ...any) error {
+		set := &bufferedSet{
+			columns:       append([]string{"_function"}, columns...),
+			databaseTypes: make([]string, len(columns)+1),
+			rows:          [][]any{append([]any{"Record"}, row...)},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(rows)
+	}
+
+	require.NoError(t, dispatch([]string{"time", "Component", "val"}, 1.23, "abc", int64(1)))
+	assert.Equal(t, []any{"abc", int64(1), 1.23}, dispatchedParams)
+
+	assert.EqualError(t, dispatch([]string{"time", "component", "value"}, 1.23, "abc", int64(1)),
+		"column 'value' is not a parameter of function 'Record'.  Expected the columns 'component', 'val', 'time'")
+	assert.EqualError(t, dispatch([]string{"time", "component"}, 1.23, "abc"),
+		"missing column 'val' for function 'Record'.  Expected the columns 'component', 'val', 'time'")
+
+	assert.PanicsWithValue(t, "Function Other has 3 parameters but 2 parameter names", func() {
+		NewDispatcherFuncs().RegisterWithParams("Other", dispatchedWithParams, "component", "val")
+	})
+}
+
+func TestStrictTypes(t *testing.T) {
+	dispatch := func(funcs *DispatcherFuncs, databaseTypes []string, row ...any) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "component", "val", "time"},
+			databaseTypes: append([]string{"NVARCHAR"}, databaseTypes...),
+			rows:          [][]any{append([]any{"dispatchedWithParams"}, row...)},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return funcs.Dispatcher()(rows)
+	}
+	intTime := []string{"NVARCHAR", "INT", "INT"}
+	floatVal := []string{"NVARCHAR", "FLOAT", "FLOAT"}
+
+	// converted by default
+	dispatchedParams = nil
+	require.NoError(t, dispatch(NewDispatcherFuncs(dispatchedWithParams), intTime, "abc", int64(1), int64(2)))
+	require.NoError(t, dispatch(NewDispatcherFuncs(dispatchedWithParams), floatVal, "abc", 1.5, 2.5))
+	assert.Equal(t, []any{"abc", int64(1), 2.0, "abc", int64(1), 2.5}, dispatchedParams)
+
+	strict := NewDispatcherFuncs(dispatchedWithParams).StrictTypes()
+	assert.EqualError(t, dispatch(strict, intTime, "abc", int64(1), int64(2)),
+		"expected parameter 'time' to be of type 'float64' but got 'int64' instead; types must match exactly with StrictTypes")
+	assert.EqualError(t, dispatch(strict, floatVal, "abc", 1.5, 2.5),
+		"expected parameter 'val' to be of type 'int64' but got 'float64' instead; types must match exactly with StrictTypes")
+
+	// the conversions of MS SQL types still apply
+	dispatchedParams = nil
+	require.NoError(t, dispatch(strict, []string{"NVARCHAR", "BIGINT", "DECIMAL"}, "abc", int64(1), []byte("2.50")))
+	assert.Equal(t, []any{"abc", int64(1), 2.5}, dispatchedParams)
+}
+
+type dispatchedRow struct {
+	Name string
+}
+
+func dispatchedWithPayload(batchID int64, rows []dispatchedRow) {}
+
+func TestDispatchPayloadErrors(t *testing.T) {
+	funcs := NewDispatcherFuncs(dispatchedWithPayload)
+	dispatch := func(rs *ResultSets, rows ...[]any) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "batchId"},
+			databaseTypes: []string{"NVARCHAR", "INT"},
+			rows:          rows,
+		}
+		sqlRows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = sqlRows.Close() }()
+		rs.Rows = sqlRows
+		return rs.processDispatcherSelect()
+	}
+
+	rs := &ResultSets{DispatcherCtx: funcs.DispatcherCtx()}
+	assert.EqualError(t, dispatch(rs, []any{"dispatchedWithPayload", int64(1)}),
+		"result set 0: payload of function 'dispatchedWithPayload': missing payload result set")
+	assert.EqualError(t, dispatch(rs, []any{"dispatchedWithPayload", int64(1)}, []any{"dispatchedWithPayload", int64(2)}),
+		"result set 0: payload of function 'dispatchedWithPayload': a select calling a function taking a payload result set must have a single row")
+
+	rs = &ResultSets{Dispatcher: funcs.Dispatcher()}
+	assert.EqualError(t, dispatch(rs, []any{"dispatchedWithPayload", int64(1)}),
+		"result set 0: function 'dispatchedWithPayload' takes a payload result set, which needs the dispatcher to be passed the context of the query, e.g. with GoMSSQLDispatcherCtx")
+
+	assert.PanicsWithValue(t, "Function Import can not have named parameters since it is variadic or takes a struct or a payload", func() {
+		NewDispatcherFuncs().RegisterWithParams("Import", dispatchedWithPayload, "batchId", "rows")
+	})
+}
+
+var dispatchedNullable []any
+
+func dispatchedWithPointers(label *string, val *int64) {
+	dispatchedNullable = append(dispatchedNullable, label, val)
+}
+
+func TestGoMSSQLDispatcherNull(t *testing.T) {
+	dispatchedNullable = nil
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedWithPointers, dispatchedWithError}).Dispatcher()
+	dispatch := func(columns []string, rows ...[]any) error {
+		set := &bufferedSet{
+			columns:       columns,
+			databaseTypes: make([]string, len(columns)),
+			rows:          rows,
+		}
+		sqlRows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = sqlRows.Close() }()
+		return dispatcher(sqlRows)
+	}
+
+	require.NoError(t, dispatch([]string{"_function", "label", "val"},
+		[]any{"dispatchedWithPointers", "x", nil},
+		[]any{"dispatchedWithPointers", nil, int64(2)}))
+	label, val := "x", int64(2)
+	assert.Equal(t, []any{&label, (*int64)(nil), (*string)(nil), &val}, dispatchedNullable)
+
+	assert.EqualError(t, dispatch([]string{"_function", "label"}, []any{"dispatchedWithError", nil}),
+		"parameter 'label' is NULL, but the function takes 'string'; take a pointer to allow NULL")
+
+	// e.g. `select _function='dispatchedWithError', label=null where 1=2` with the driver
+	// returning a row of nulls
+	require.NoError(t, dispatch([]string{"_function", "label"}, []any{nil, nil}))
+}
+
+var dispatchedTimes []any
+
+func dispatchedWithTime(at time.Time, text string) {
+	dispatchedTimes = append(dispatchedTimes, at, text)
+}
+
+func TestGoMSSQLDispatcherTime(t *testing.T) {
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedWithTime}).Dispatcher()
+	utc := time.Date(2024, 1, 2, 3, 4, 5, 123456700, time.UTC)
+	offset := time.Date(2024, 1, 2, 4, 4, 5, 123456700, time.FixedZone("", 3600))
+	for _, tc := range []struct {
+		databaseType string
+		at, text     any
+		expectedAt   time.Time
+		expectedText string
+	}{
+		{"DATETIME", utc.Truncate(time.Millisecond), utc, utc.Truncate(time.Millisecond), "2024-01-02T03:04:05.1234567Z"},
+		{"DATETIME2", utc, utc, utc, "2024-01-02T03:04:05.1234567Z"},
+		{"DATETIMEOFFSET", offset, offset, offset, "2024-01-02T04:04:05.1234567+01:00"},
+		// as text, e.g. converted to NVARCHAR by the driver
+		{"DATETIMEOFFSET", "2024-01-02 04:04:05.1234567 +01:00", "x", offset, "x"},
+	} {
+		dispatchedTimes = nil
+		set := &bufferedSet{
+			columns:       []string{"_function", "at", "text"},
+			databaseTypes: []string{"NVARCHAR", tc.databaseType, tc.databaseType},
+			rows:          [][]any{{"dispatchedWithTime", tc.at, tc.text}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		require.NoError(t, dispatcher(rows), tc.databaseType)
+		require.NoError(t, rows.Close())
+		require.Len(t, dispatchedTimes, 2)
+		assert.True(t, tc.expectedAt.Equal(dispatchedTimes[0].(time.Time)), tc.databaseType)
+		assert.Equal(t, tc.expectedText, dispatchedTimes[1], tc.databaseType)
+	}
+}
+
+var dispatchedUUIDs []any
+
+func dispatchedWithUUIDs(id uuid.UUID, array [16]byte, text string, raw []byte) {
+	dispatchedUUIDs = append(dispatchedUUIDs, id, array, text, raw)
+}
+
+func TestGoMSSQLDispatcherUUID(t *testing.T) {
+	dispatchedUUIDs = nil
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedWithUUIDs}).Dispatcher()
+	id := uuid.MustParse("fdbd3b3a-1c3b-4e66-a4d0-8f4b3c0cb7ec")
+	idBytes := []byte{0x3a, 0x3b, 0xbd, 0xfd, 0x3b, 0x1c, 0x66, 0x4e, 0xa4, 0xd0, 0x8f, 0x4b, 0x3c, 0x0c, 0xb7, 0xec}
+	set := &bufferedSet{
+		columns:       []string{"_function", "id", "array", "text", "raw"},
+		databaseTypes: []string{"NVARCHAR", "UNIQUEIDENTIFIER", "UNIQUEIDENTIFIER", "UNIQUEIDENTIFIER", "UNIQUEIDENTIFIER"},
+		rows:          [][]any{{"dispatchedWithUUIDs", idBytes, idBytes, idBytes, idBytes}},
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	require.NoError(t, dispatcher(rows))
+	assert.Equal(t, []any{id, [16]byte(id), "fdbd3b3a-1c3b-4e66-a4d0-8f4b3c0cb7ec", idBytes}, dispatchedUUIDs)
+}
+
+var dispatchedStored []any
+
+func dispatchedStore(key string, blob []byte) {
+	dispatchedStored = append(dispatchedStored, key, blob)
+}
+
+func TestGoMSSQLDispatcherLongValues(t *testing.T) {
+	key := strings.Repeat("k", 1<<20)
+	blob := bytes.Repeat([]byte{0, 1, 2, 255}, 1<<18)
+	for _, funcs := range []*DispatcherFuncs{NewDispatcherFuncs(dispatchedStore), NewDispatcherFuncs(dispatchedStore).StrictTypes()} {
+		dispatchedStored = nil
+		// some driver versions give NVARCHAR(MAX) as bytes
+		set := &bufferedSet{
+			columns:       []string{"_function", "key", "blob"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR", "VARBINARY"},
+			rows:          [][]any{{"dispatchedStore", []byte(key), blob}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		require.NoError(t, funcs.Dispatcher()(rows))
+		require.NoError(t, rows.Close())
+		require.Len(t, dispatchedStored, 2)
+		assert.Equal(t, key, dispatchedStored[0])
+		assert.Equal(t, blob, dispatchedStored[1])
+	}
+}
+
+var dispatchedToggles []any
+
+func dispatchedToggle(name string, enabled bool) {
+	dispatchedToggles = append(dispatchedToggles, name, enabled)
+}
+
+func dispatchedToggleNullable(name string, enabled *bool, n int64) {
+	dispatchedToggles = append(dispatchedToggles, name, enabled, n)
+}
+
+func TestGoMSSQLDispatcherBit(t *testing.T) {
+	dispatchedToggles = nil
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedToggle, dispatchedToggleNullable}).Dispatcher()
+	dispatch := func(row ...any) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "name", "enabled", "n"}[:len(row)],
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR", "BIT", "BIT"}[:len(row)],
+			rows:          [][]any{row},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(rows)
+	}
+
+	require.NoError(t, dispatch("dispatchedToggle", "a", int64(0)))
+	require.NoError(t, dispatch("dispatchedToggle", "b", true))
+	require.NoError(t, dispatch("dispatchedToggle", "c", []byte("1")))
+	assert.Equal(t, []any{"a", false, "b", true, "c", true}, dispatchedToggles)
+	assert.EqualError(t, dispatch("dispatchedToggle", "d", nil),
+		"parameter 'enabled' is NULL, but the function takes 'bool'; take a pointer to allow NULL")
+
+	dispatchedToggles = nil
+	require.NoError(t, dispatch("dispatchedToggleNullable", "e", nil, true))
+	assert.Equal(t, []any{"e", (*bool)(nil), int64(1)}, dispatchedToggles)
+}
+
+var dispatchedMoney []any
+
+func dispatchedWithMoney(amount SQLMoney, approximate float64, note sql.NullString) {
+	dispatchedMoney = append(dispatchedMoney, amount, approximate, note)
+}
+
+func TestGoMSSQLDispatcherMoney(t *testing.T) {
+	dispatcher := GoMSSQLDispatcher([]interface{}{dispatchedWithMoney}).Dispatcher()
+	for _, tc := range []struct {
+		value    string
+		expected SQLMoney
+		text     string
+	}{
+		{"0.0100", 100, "0.0100"},
+		{"922337203685477.5800", 9223372036854775800, "922337203685477.5800"},
+		{"-922337203685477.5808", -9223372036854775808, "-922337203685477.5808"},
+		{"-0.01", -100, "-0.0100"},
+	} {
+		dispatchedMoney = nil
+		set := &bufferedSet{
+			columns:       []string{"_function", "amount", "approximate", "note"},
+			databaseTypes: []string{"NVARCHAR", "MONEY", "MONEY", "NVARCHAR"},
+			rows:          [][]any{{"dispatchedWithMoney", []byte(tc.value), []byte(tc.value), nil}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		require.NoError(t, dispatcher(rows))
+		require.NoError(t, rows.Close())
+		approximate, err := strconv.ParseFloat(tc.value, 64)
+		require.NoError(t, err)
+		assert.Equal(t, []any{tc.expected, approximate, sql.NullString{}}, dispatchedMoney)
+		assert.Equal(t, tc.text, dispatchedMoney[0].(SQLMoney).String())
+	}
+}
+
+func TestDispatchErrorContinue(t *testing.T) {
+	methods := &dispatchedMethods{}
+	funcs := NewDispatcherFuncs(dispatchedWithError).OnError(DispatchErrorContinue)
+	var logged []string
+	logger := func(rows *sql.Rows) error {
+		set, err := readBufferedSet(rows)
+		require.NoError(t, err)
+		logged = append(logged, fmt.Sprint(set.rows))
+		return nil
+	}
+	for _, tc := range []struct {
+		fname    string
+		label    string
+		expected string
+	}{
+		{"dispatchedWithError", "", "result set 0: dispatchedWithError: invalid label"},
+		{"Missing", "x", "result set 0: could not find 'Missing'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'dispatchedWithError'"},
+	} {
+		logged = nil
+		set := &bufferedSet{
+			columns:       []string{"_function", "label"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+			rows:          [][]any{{tc.fname, tc.label}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		rs := &ResultSets{Rows: rows, Logger: logger, Dispatcher: funcs.Dispatcher()}
+		require.NoError(t, rs.processDispatcherSelect())
+		require.NoError(t, rows.Close())
+		assert.EqualError(t, rs.DispatchErrors(), tc.expected)
+		assert.Equal(t, []string{fmt.Sprintf("[[error dispatch_error %s]]", tc.expected)}, logged)
+	}
+
+	// not composed with a DispatcherFuncs that aborts
+	ctx := WithAdditionalDispatcher(context.Background(), funcs)
+	ctx = WithAdditionalDispatcher(ctx, NewDispatcherFuncs().Register("Record", methods.Record))
+	set := &bufferedSet{
+		columns:       []string{"_function", "label"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"Missing", "x"}},
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	rs := &ResultSets{Rows: rows, ctx: ctx, DispatcherCtx: DispatcherCtx(ctx)}
+	assert.Error(t, rs.processDispatcherSelect())
+	assert.NoError(t, rs.DispatchErrors())
+}
+
+func TestWithDispatchObserver(t *testing.T) {
+	type observation struct {
+		name string
+		err  error
+	}
+	var observed []observation
+	observer := func(name string, duration time.Duration, err error) {
+		assert.GreaterOrEqual(t, duration, time.Duration(0))
+		observed = append(observed, observation{name, err})
+	}
+	methods := &dispatchedMethods{}
+	dispatcher := NewDispatcherFuncs(dispatchedWithError).
+		WithDispatchObserver(observer).
+		Register("Record", methods.Record).
+		Dispatcher()
+	set := &bufferedSet{
+		columns:       []string{"_function", "label"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"Record", "x"}, {"dispatchedWithError", "y"}, {"dispatchedWithError", ""}},
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	assert.Error(t, dispatcher(rows))
+
+	require.Len(t, observed, 3)
+	assert.Equal(t, observation{"Record", nil}, observed[0])
+	assert.Equal(t, observation{"dispatchedWithError", nil}, observed[1])
+	assert.Equal(t, "dispatchedWithError", observed[2].name)
+	assert.ErrorIs(t, observed[2].err, errInvalidLabel)
+}
+
+var errPanicked = errors.New("out of range")
+
+func dispatchedPanic(label string, secret string, n int64) {
+	if n > 0 {
+		panic(errPanicked)
+	}
+	panic("no n")
+}
+
+func TestGoMSSQLDispatcherPanic(t *testing.T) {
+	dispatcher := GoMSSQLDispatcherCtx([]interface{}{dispatchedPanic})
+	ctx := WithLogRedaction(context.Background(), RedactColumns("secret"))
+	dispatch := func(n int64) error {
+		set := &bufferedSet{
+			columns:       []string{"_function", "label", "secret", "n"},
+			databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR", "BIGINT"},
+			rows:          [][]any{{"dispatchedPanic", "a b", "hunter2", n}},
+		}
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(ctx, rows)
+	}
+
+	err := dispatch(1)
+	assert.EqualError(t, err, `dispatch to 'dispatchedPanic' panicked: out of range (label="a b" secret=[REDACTED] n=1)`)
+	assert.ErrorIs(t, err, errPanicked)
+	assert.EqualError(t, dispatch(0), `dispatch to 'dispatchedPanic' panicked: no n (label="a b" secret=[REDACTED] n=0)`)
+}
+
+func TestDispatcherFuncsDescribe(t *testing.T) {
+	funcs := NewDispatcherFuncs(dispatchedWithCtx, dispatchedVariadic)
+	assert.Equal(t, []string{"dispatchedWithCtx", "dispatchedVariadic"}, funcs.Names())
+
+	numArgs, argTypes, ok := funcs.Describe("dispatchedWithCtx")
+	assert.True(t, ok)
+	assert.Equal(t, 1, numArgs)
+	assert.Equal(t, []reflect.Type{reflect.TypeOf("")}, argTypes)
+
+	numArgs, argTypes, ok = funcs.Describe("dispatchedVariadic")
+	assert.True(t, ok)
+	assert.Equal(t, 2, numArgs)
+	assert.Equal(t, []reflect.Type{reflect.TypeOf(""), reflect.TypeOf([]string{})}, argTypes)
+
+	_, _, ok = funcs.Describe("Missing")
+	assert.False(t, ok)
+}
@@ -0,0 +1,62 @@
+package querysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Lenient returns a Target that scans the rows of a result set with `inner`, but skips the rows
+// that fail to scan, e.g. because of a value that can not be converted, instead of failing the
+// result set; e.g. for auditing the quality of data. The rows that scanned are read into `inner`
+// as usual:
+//
+//	var users []User
+//	err := querysql.Next(rs, querysql.Lenient(querysql.SliceInto(&users), 100))
+//
+// If any rows failed, Next returns an error joining a RowError for each of them; use errors.As
+// to get at them. Only the first `maxErrors` are kept, the rest are just counted. Unlike other
+// errors, this does not close `rs`; it is positioned at the next result set as after a successful Next.
+// Errors other than RowError, e.g. ManyRowsExpectedOne, are returned as usual.
+func Lenient(inner Target, maxErrors int) Target {
+	return &lenientTarget{inner: inner, maxErrors: maxErrors}
+}
+
+type lenientTarget struct {
+	inner     Target
+	maxErrors int
+	rowErrors []error
+	// dropped is the number of RowErrors not kept because of maxErrors
+	dropped int
+}
+
+var _ boundTarget = &lenientTarget{}
+var _ setEnder = &lenientTarget{}
+
+func (t *lenientTarget) ScanRow(rows *sql.Rows) error {
+	err := t.inner.ScanRow(rows)
+	var rowErr RowError
+	if err == nil || !errors.As(err, &rowErr) {
+		return err
+	}
+	if len(t.rowErrors) < t.maxErrors {
+		t.rowErrors = append(t.rowErrors, rowErr)
+	} else {
+		t.dropped++
+	}
+	return nil
+}
+
+func (t *lenientTarget) bind(rs *ResultSets, index int) error {
+	if bound, ok := t.inner.(boundTarget); ok {
+		return bound.bind(rs, index)
+	}
+	return nil
+}
+
+func (t *lenientTarget) endSet() error {
+	if t.dropped > 0 {
+		return errors.Join(append(t.rowErrors, fmt.Errorf("%d more rows failed to scan", t.dropped))...)
+	}
+	return errors.Join(t.rowErrors...)
+}
@@ -0,0 +1,41 @@
+package querysql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLenient(t *testing.T) {
+	set := &bufferedSet{
+		columns:       []string{"x"},
+		databaseTypes: []string{"NVARCHAR"},
+		rows:          [][]any{{"1"}, {"a"}, {"3"}, {"b"}, {"c"}, {"6"}},
+	}
+
+	var values []int
+	rs := New(context.Background(), bufferedDB, "buffered set", set)
+	err := Next(rs, Lenient(SliceInto(&values), 2))
+	assert.Equal(t, []int{1, 3, 6}, values)
+	var rowErr RowError
+	require.ErrorAs(t, err, &rowErr)
+	assert.Equal(t, 1, rowErr.RowIndex)
+	assert.EqualError(t, err, `result set 0: row index 1: scanning into int: sql: Scan error on column index 0, name "x": converting driver.Value type string ("a") to a int: invalid syntax
+row index 3: scanning into int: sql: Scan error on column index 0, name "x": converting driver.Value type string ("b") to a int: invalid syntax
+1 more rows failed to scan`)
+	assert.True(t, rs.Done())
+
+	// No error if all rows scan
+	values = nil
+	set.rows = [][]any{{"1"}, {"2"}}
+	require.NoError(t, Next(New(context.Background(), bufferedDB, "buffered set", set), Lenient(SliceInto(&values), 2)))
+	assert.Equal(t, []int{1, 2}, values)
+
+	// Other errors are returned as usual
+	var value int
+	err = Next(New(context.Background(), bufferedDB, "buffered set", set), Lenient(SingleInto(&value), 2))
+	assert.True(t, errors.Is(err, ManyRowsExpectedOne))
+}
@@ -0,0 +1,65 @@
+package querysql
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// filterByLevel returns `set` without the rows with a level below `minLevel`, and whether
+// there is anything left to log. Only the names of the logrus levels are understood here, as the
+// RowsLogger may not know of the aliases and numeric levels of the loggers of this package; other
+// rows are kept, and the loggers of this package filter them by the levels they are configured
+// with, see logSetInfo.
+func filterByLevel(set *bufferedSet, minLevel logrus.Level) (*bufferedSet, bool) {
+	if len(set.rows) == 0 {
+		// Leave it to the logger to compare the minimum with its default level
+		return set, true
+	}
+
+	filtered := &bufferedSet{
+		columns:       set.columns,
+		databaseTypes: set.databaseTypes,
+	}
+	for _, row := range set.rows {
+		level, err := logrus.ParseLevel(fmt.Sprint(row[0]))
+		if err == nil && level > minLevel {
+			continue
+		}
+		filtered.rows = append(filtered.rows, row)
+	}
+	return filtered, len(filtered.rows) > 0
+}
+
+// sampleSet returns `set` with only every `everyN`th row, and the number of rows left out
+func sampleSet(set *bufferedSet, everyN int) (*bufferedSet, int) {
+	sampled := &bufferedSet{
+		columns:       set.columns,
+		databaseTypes: set.databaseTypes,
+	}
+	for i, row := range set.rows {
+		if i%everyN == 0 {
+			sampled.rows = append(sampled.rows, row)
+		}
+	}
+	return sampled, len(set.rows) - len(sampled.rows)
+}
+
+// moveColumnFirst returns `set` with column `i` moved first, keeping the order of the other columns
+func moveColumnFirst(set *bufferedSet, i int) *bufferedSet {
+	moved := &bufferedSet{
+		columns:       moveFirst(set.columns, i),
+		databaseTypes: moveFirst(set.databaseTypes, i),
+	}
+	for _, row := range set.rows {
+		moved.rows = append(moved.rows, moveFirst(row, i))
+	}
+	return moved
+}
+
+func moveFirst[T any](s []T, i int) []T {
+	moved := make([]T, 0, len(s))
+	moved = append(moved, s[i])
+	moved = append(moved, s[:i]...)
+	return append(moved, s[i+1:]...)
+}
@@ -0,0 +1,163 @@
+package querysql
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	rs := (&ResultSets{Logger: StdMSSQLLogger(log.New(&buf, "", 0))}).With(WithRowsMinLogLevel(logrus.InfoLevel))
+
+	logSet := func(defaultLevel string, set *bufferedSet, opts ...LoggerOption) {
+		rs.Logger = StdMSSQLLoggerWithLevel(log.New(&buf, "", 0), defaultLevel, opts...)
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		require.NoError(t, rs.logger()(rows))
+		require.NoError(t, rows.Close())
+	}
+	cols := []string{"_log", "x"}
+	types := []string{"NVARCHAR", "NVARCHAR"}
+
+	logSet("info", &bufferedSet{columns: cols, databaseTypes: types, rows: [][]any{
+		{"debug", "filtered"},
+		{"info", "info"},
+		{"10", "filtered numeric"},
+		{"error", "error"},
+		{"nonsense", "invalid"},
+	}})
+	// all rows filtered
+	logSet("info", &bufferedSet{columns: cols, databaseTypes: types, rows: [][]any{{"trace", "filtered"}}})
+	// empty sets are logged at the default level of the logger
+	logSet("info", &bufferedSet{columns: cols, databaseTypes: types})
+	logSet("debug", &bufferedSet{columns: cols, databaseTypes: types})
+	// the levels are those the logger is configured with
+	aliased := &bufferedSet{columns: cols, databaseTypes: types, rows: [][]any{
+		{"chatty", "filtered alias"},
+		{"5", "filtered numeric"},
+		{"loud", "alias"},
+	}}
+	logSet("info", aliased, WithLogLevelAliases(map[string]logrus.Level{"chatty": logrus.DebugLevel, "loud": logrus.WarnLevel}),
+		WithNumericLogLevels(map[int]logrus.Level{5: logrus.DebugLevel}))
+	// also when aggregating
+	logSet("info", aliased, WithAggregatedRows(10), WithLogLevelAliases(map[string]logrus.Level{"chatty": logrus.DebugLevel}))
+
+	assert.Equal(t, []string{
+		`level=info x=info`,
+		`level=error x=error`,
+		`level=error event=invalid.log.level invalid.level=nonsense`,
+		`level=info x=invalid`,
+		`level=info _norows=true x=""`,
+		`level=warning x=alias`,
+		`level=info rows=2`,
+		`_log  x`,
+		`5     filtered numeric`,
+		`loud  alias`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+
+	// Other loggers get the rows with the names of the logrus levels filtered
+	var levels []string
+	rs.Logger = func(rows *sql.Rows) error {
+		set, err := readBufferedSet(rows)
+		for _, row := range set.rows {
+			levels = append(levels, row[0].(string))
+		}
+		return err
+	}
+	rows, err := aliased.Rows()
+	require.NoError(t, err)
+	require.NoError(t, rs.logger()(rows))
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []string{"chatty", "5", "loud"}, levels)
+	levels = nil
+	rows, err = (&bufferedSet{columns: cols, databaseTypes: types, rows: [][]any{{"debug", "x"}, {"warning", "y"}}}).Rows()
+	require.NoError(t, err)
+	require.NoError(t, rs.logger()(rows))
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []string{"warning"}, levels)
+}
+
+func TestLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	rs := &ResultSets{Logger: StdMSSQLLogger(log.New(&buf, "", 0)), logSampling: 3}
+
+	set := &bufferedSet{columns: []string{"_log", "x", "y"}, databaseTypes: []string{"NVARCHAR", "BIGINT", "NVARCHAR"}}
+	for i := 0; i < 7; i++ {
+		set.rows = append(set.rows, []any{"info", int64(i), "row"})
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	require.NoError(t, rs.logger()(rows))
+	assert.False(t, rows.Next(), "all rows should be read")
+	require.NoError(t, rows.Close())
+
+	// A single row is not sampled
+	require.NoError(t, rs.logEntry("info", []string{"x"}, []any{"single"}))
+
+	assert.Equal(t, []string{
+		`level=info x=0 y=row`,
+		`level=info x=3 y=row`,
+		`level=info x=6 y=row`,
+		`level=warning event=log.sampled suppressed=4 columns=x,y`,
+		`level=info x=single`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
+
+func TestLogColumnPosition(t *testing.T) {
+	var buf bytes.Buffer
+	rs := &ResultSets{Logger: StdMSSQLLogger(log.New(&buf, "", 0)), LogKeyLowercase: "loglevel"}
+
+	for _, tc := range []struct {
+		cols     []string
+		expected int
+	}{
+		{[]string{"_log", "x"}, 0},
+		{[]string{"x", "_log", "y"}, 1},
+		{[]string{"x", "LogLevel"}, 1},
+		{[]string{"_function", "_log"}, -1},
+		{[]string{"x", "_other"}, -1},
+		{[]string{}, -1},
+	} {
+		assert.Equal(t, tc.expected, rs.logColumnIndex(tc.cols), "%v", tc.cols)
+	}
+
+	set := &bufferedSet{
+		columns:       []string{"msg", "_log", "n"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT"},
+		rows:          [][]any{{"hello", "warning", int64(1)}, {"world", "debug", int64(2)}},
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	rs.Rows = rows
+	require.NoError(t, rs.processLogSelect())
+	assert.Equal(t, []string{
+		`level=warning msg=hello n=1`,
+		`level=debug msg=world n=2`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
+
+func TestLogSelectError(t *testing.T) {
+	failing := errors.New("could not decode UUID from SQL")
+	rs := &ResultSets{Logger: func(*sql.Rows) error { return failing }, setIndex: 7}
+	set := &bufferedSet{columns: []string{"_log", "id"}, databaseTypes: []string{"NVARCHAR", "UNIQUEIDENTIFIER"}}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	rs.Rows = rows
+
+	err = rs.processLogSelect()
+	assert.Equal(t, "result set 7: log select with columns [_log id]: could not decode UUID from SQL", err.Error())
+	assert.ErrorIs(t, err, failing)
+	var rsErr *ResultSetError
+	require.ErrorAs(t, err, &rsErr)
+	assert.Equal(t, 7, rsErr.Index)
+}
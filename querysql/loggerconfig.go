@@ -0,0 +1,293 @@
+package querysql
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxLogValueLength is the default of WithMaxLogValueLength
+const DefaultMaxLogValueLength = 8192
+
+// DefaultMaxLogBinaryLength is the default of WithMaxLogBinaryLength
+const DefaultMaxLogBinaryLength = 64
+
+// DefaultLogTimeLayout is the default of WithLogTimeLayout; RFC 3339 with fractional
+// seconds when present
+const DefaultLogTimeLayout = time.RFC3339Nano
+
+// LoggerOption configures the RowsLoggers of this package, such as LogrusMSSQLLogger
+type LoggerOption func(*loggerConfig)
+
+// DefaultNumericLogLevels is the default of WithNumericLogLevels. 1 is info, so that the
+// dummy value in `select _log=1, ...` logs at info level; 10 to 50 are the levels of
+// e.g. Python's logging module.
+var DefaultNumericLogLevels = map[int]logrus.Level{
+	1:  logrus.InfoLevel,
+	10: logrus.DebugLevel,
+	20: logrus.InfoLevel,
+	30: logrus.WarnLevel,
+	40: logrus.ErrorLevel,
+	50: logrus.ErrorLevel,
+}
+
+// DefaultLogLevelAliases are the alternative names for log levels understood by the loggers,
+// in addition to the names of the logrus levels; see WithLogLevelAliases
+var DefaultLogLevelAliases = map[string]logrus.Level{
+	"err":         logrus.ErrorLevel,
+	"information": logrus.InfoLevel,
+	"dbg":         logrus.DebugLevel,
+	"critical":    logrus.ErrorLevel,
+}
+
+// NoRowsBehavior tells what a logger does with an empty log select, see WithNoRowsBehavior
+type NoRowsBehavior int
+
+const (
+	// NoRowsLogAtDefault logs an entry with the field `_norows` at the default level of the logger
+	NoRowsLogAtDefault NoRowsBehavior = iota
+	// NoRowsLogAtDebug logs the `_norows` entry at debug level
+	NoRowsLogAtDebug
+	// NoRowsSuppress logs nothing for empty log selects
+	NoRowsSuppress
+)
+
+type loggerConfig struct {
+	maxValueLength int
+	// maxBinaryLength is the number of bytes of binary values to hex-encode
+	maxBinaryLength int
+	timeLayout      string
+	numericLevels   map[int]logrus.Level
+	levelAliases    map[string]logrus.Level
+	lethalLevels    bool
+	noRows          NoRowsBehavior
+	// maxAggregatedRows is the number of rows rendered when aggregating, see WithAggregatedRows
+	maxAggregatedRows int
+	omitNulls         bool
+}
+
+func newLoggerConfig(opts []LoggerOption) *loggerConfig {
+	cfg := &loggerConfig{
+		maxValueLength:  DefaultMaxLogValueLength,
+		maxBinaryLength: DefaultMaxLogBinaryLength,
+		timeLayout:      DefaultLogTimeLayout,
+		numericLevels:   DefaultNumericLogLevels,
+		levelAliases:    make(map[string]logrus.Level, len(DefaultLogLevelAliases)),
+	}
+	for alias, level := range DefaultLogLevelAliases {
+		cfg.levelAliases[alias] = level
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithMaxLogValueLength makes the logger truncate string values longer than `n` bytes. A suffix
+// with the length of the value is added to truncated values. `n` <= 0 disables truncation.
+func WithMaxLogValueLength(n int) LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.maxValueLength = n
+	}
+}
+
+// WithMaxLogBinaryLength makes the logger only hex-encode the first `n` bytes of binary values,
+// such as VARBINARY columns, followed by a suffix with the length of the value. Binary values
+// are capped separately from strings since the hex encoding doubles their size.
+// `n` <= 0 disables truncation.
+func WithMaxLogBinaryLength(n int) LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.maxBinaryLength = n
+	}
+}
+
+// WithLogTimeLayout makes the logger format DATETIME, DATETIME2, DATETIMEOFFSET and other
+// time values with `layout`, see time.Time.Format
+func WithLogTimeLayout(layout string) LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.timeLayout = layout
+	}
+}
+
+// WithNumericLogLevels sets the levels used for numeric values in the log level column,
+// instead of DefaultNumericLogLevels. Numbers not in `levels` are invalid levels.
+func WithNumericLogLevels(levels map[int]logrus.Level) LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.numericLevels = levels
+	}
+}
+
+// WithLogLevelAliases adds alternative names for log levels, in addition to
+// DefaultLogLevelAliases. The aliases are case-insensitive.
+func WithLogLevelAliases(aliases map[string]logrus.Level) LoggerOption {
+	return func(cfg *loggerConfig) {
+		for alias, level := range aliases {
+			cfg.levelAliases[strings.ToLower(alias)] = level
+		}
+	}
+}
+
+// WithLethalLogLevels makes the panic and fatal levels panic and exit the process, as logrus does.
+// By default they are logged at error level instead, with the requested level in the field
+// `requested_level`, so that a log select can not bring down the process.
+func WithLethalLogLevels() LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.lethalLevels = true
+	}
+}
+
+// WithNoRowsBehavior sets what the logger does with log selects that return no rows. By default
+// (NoRowsLogAtDefault) an entry with the field `_norows` and the columns of the select is
+// logged at the default level of the logger, so that the log select does not go unnoticed.
+func WithNoRowsBehavior(behavior NoRowsBehavior) LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.noRows = behavior
+	}
+}
+
+// WithOmitNullLogValues makes the logger leave out the columns that are NULL, instead of
+// logging them as null
+func WithOmitNullLogValues() LoggerOption {
+	return func(cfg *loggerConfig) {
+		cfg.omitNulls = true
+	}
+}
+
+// noRowsLevel returns the level to log the `_norows` entry at, given the default level of the
+// logger, and false if it should not be logged
+func (cfg *loggerConfig) noRowsLevel(defaultLevel logrus.Level, info *logSetInfo) (logrus.Level, bool) {
+	level := defaultLevel
+	switch cfg.noRows {
+	case NoRowsSuppress:
+		return 0, false
+	case NoRowsLogAtDebug:
+		level = logrus.DebugLevel
+	}
+	if info.belowMinLevel(level) {
+		return 0, false
+	}
+	return level, true
+}
+
+// nonLethalLevel returns the level to log at instead of `level`, and the level to put in the
+// `requested_level` field if it is not the same, see WithLethalLogLevels
+func (cfg *loggerConfig) nonLethalLevel(level logrus.Level) (logrus.Level, string) {
+	if cfg.lethalLevels || level > logrus.FatalLevel {
+		return level, ""
+	}
+	return logrus.ErrorLevel, level.String()
+}
+
+// parseLevel parses the value of the log level column; either the name of a logrus level,
+// an alias in levelAliases or a number in numericLevels
+func (cfg *loggerConfig) parseLevel(level string) (logrus.Level, error) {
+	if parsed, ok := cfg.levelAliases[strings.ToLower(level)]; ok {
+		return parsed, nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(level)); err == nil {
+		if parsed, ok := cfg.numericLevels[n]; ok {
+			return parsed, nil
+		}
+		return 0, fmt.Errorf("not a valid numeric log level: %d", n)
+	}
+	return logrus.ParseLevel(level)
+}
+
+// logValue post-processes the types of the values a bit to make some types more readable in logs.
+// NULL values are returned as nil whatever the type of the column.
+func (cfg *loggerConfig) logValue(value any, databaseTypeName string) (any, error) {
+	if b, ok := value.([]uint8); value == nil || (ok && b == nil) {
+		return nil, nil
+	}
+	if databaseTypeName == "BIT" {
+		return bitLogValue(value)
+	}
+	switch typedValue := value.(type) {
+	case []uint8:
+		if databaseTypeName == "MONEY" || databaseTypeName == "DECIMAL" || databaseTypeName == "NUMERIC" {
+			// the driver gives these as the decimal number in ASCII, which is logged as it is
+			// rather than rounded to a float64
+			return string(typedValue), nil
+		}
+		converted, err := ConvertSQLBytes(typedValue, databaseTypeName)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode %s from SQL: %w", databaseTypeName, err)
+		}
+		if text, ok := converted.(string); ok {
+			return cfg.logValue(text, "")
+		}
+		if _, ok := converted.([]uint8); !ok {
+			return converted, nil
+		}
+		if cfg.maxBinaryLength > 0 && len(typedValue) > cfg.maxBinaryLength {
+			return "0x" + hex.EncodeToString(typedValue[:cfg.maxBinaryLength]) + truncatedSuffix(len(typedValue)), nil
+		}
+		return "0x" + hex.EncodeToString(typedValue), nil
+	case time.Time:
+		return typedValue.Format(cfg.timeLayout), nil
+	case string:
+		if cfg.truncates(len(typedValue)) {
+			// avoid cutting a multi-byte character in half
+			cut := cfg.maxValueLength
+			for cut > 0 && !isRuneStart(typedValue[cut]) {
+				cut--
+			}
+			return typedValue[:cut] + truncatedSuffix(len(typedValue)), nil
+		}
+	}
+	return value, nil
+}
+
+// bitLogValue normalizes the value of a BIT column to a bool, whichever type the driver gives it
+// as. NULL stays nil.
+func bitLogValue(value any) (any, error) {
+	switch typedValue := value.(type) {
+	case nil, bool:
+		return typedValue, nil
+	case int64:
+		return typedValue != 0, nil
+	case []uint8:
+		return strconv.ParseBool(string(typedValue))
+	case string:
+		return strconv.ParseBool(typedValue)
+	default:
+		return nil, fmt.Errorf("unexpected type %T for BIT value", value)
+	}
+}
+
+func (cfg *loggerConfig) truncates(length int) bool {
+	return cfg.maxValueLength > 0 && length > cfg.maxValueLength
+}
+
+func truncatedSuffix(length int) string {
+	return fmt.Sprintf("…(truncated, %d bytes)", length)
+}
+
+// eventColumn is the reserved column of log selects whose value is the message of the entry,
+// e.g. `select _log='info', _event='payment.captured', amount=@amount`
+const eventColumn = "_event"
+
+// eventIndex returns the index of the event column in `cols`, or -1 if there is none
+func eventIndex(cols []string) int {
+	for i, col := range cols {
+		if i > 0 && col == eventColumn {
+			return i
+		}
+	}
+	return -1
+}
+
+// eventMessage returns the value of the event column at index `i` of a row, or "" if there is none
+func eventMessage(fields []any, i int) string {
+	if i == -1 || fields[i] == nil {
+		return ""
+	}
+	if b, ok := fields[i].([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(fields[i])
+}
@@ -0,0 +1,247 @@
+package querysql
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogValueTruncation(t *testing.T) {
+	cfg := newLoggerConfig([]LoggerOption{WithMaxLogValueLength(4), WithMaxLogBinaryLength(4)})
+	for _, tc := range []struct {
+		value    any
+		typ      string
+		expected any
+	}{
+		{"abc", "NVARCHAR", "abc"},
+		{"abcd", "NVARCHAR", "abcd"},
+		{"abcde", "NVARCHAR", "abcd…(truncated, 5 bytes)"},
+		// "æ" is two bytes; do not cut it in half
+		{"abcæ", "NVARCHAR", "abc…(truncated, 5 bytes)"},
+		{[]byte{1, 2, 3, 4}, "VARBINARY", "0x01020304"},
+		{[]byte{1, 2, 3, 4, 5}, "VARBINARY", "0x01020304…(truncated, 5 bytes)"},
+		{int64(123456), "BIGINT", int64(123456)},
+	} {
+		value, err := cfg.logValue(tc.value, tc.typ)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, value)
+	}
+
+	long := strings.Repeat("x", DefaultMaxLogValueLength+1)
+	value, err := newLoggerConfig(nil).logValue(long, "NVARCHAR")
+	require.NoError(t, err)
+	assert.Equal(t, long[:DefaultMaxLogValueLength]+"…(truncated, 8193 bytes)", value)
+
+	value, err = newLoggerConfig([]LoggerOption{WithMaxLogValueLength(0)}).logValue(long, "NVARCHAR")
+	require.NoError(t, err)
+	assert.Equal(t, long, value)
+}
+
+func TestLogValueBinaryTruncation(t *testing.T) {
+	large := bytes.Repeat([]byte{0xab}, 1<<20)
+	value, err := newLoggerConfig(nil).logValue(large, "VARBINARY")
+	require.NoError(t, err)
+	assert.Equal(t, "0x"+strings.Repeat("ab", DefaultMaxLogBinaryLength)+"…(truncated, 1048576 bytes)", value)
+
+	// independent of the limit for strings
+	value, err = newLoggerConfig([]LoggerOption{WithMaxLogValueLength(0), WithMaxLogBinaryLength(2)}).logValue(large, "VARBINARY")
+	require.NoError(t, err)
+	assert.Equal(t, "0xabab…(truncated, 1048576 bytes)", value)
+
+	value, err = newLoggerConfig([]LoggerOption{WithMaxLogBinaryLength(0)}).logValue(large[:100], "VARBINARY")
+	require.NoError(t, err)
+	assert.Equal(t, "0x"+strings.Repeat("ab", 100), value)
+}
+
+func TestLogValueTime(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	value, err := newLoggerConfig(nil).logValue(at, "DATETIME2")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-02T03:04:05.6Z", value)
+
+	value, err = newLoggerConfig(nil).logValue(at.In(time.FixedZone("", 2*60*60)), "DATETIMEOFFSET")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-02T05:04:05.6+02:00", value)
+
+	value, err = newLoggerConfig([]LoggerOption{WithLogTimeLayout(time.DateOnly)}).logValue(at, "DATE")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-02", value)
+}
+
+func TestLogValueDecimal(t *testing.T) {
+	for _, typ := range []string{"MONEY", "DECIMAL", "NUMERIC"} {
+		value, err := newLoggerConfig(nil).logValue([]byte("0.2500"), typ)
+		require.NoError(t, err)
+		assert.Equal(t, "0.2500", value)
+	}
+}
+
+func TestLogValueBit(t *testing.T) {
+	for _, tc := range []struct {
+		value    any
+		expected any
+	}{
+		{true, true},
+		{false, false},
+		{int64(1), true},
+		{int64(0), false},
+		{[]byte("1"), true},
+		{"0", false},
+		{nil, nil},
+	} {
+		value, err := newLoggerConfig(nil).logValue(tc.value, "BIT")
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, value)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cfg := newLoggerConfig(nil)
+	for level, expected := range map[string]logrus.Level{
+		"info": logrus.InfoLevel,
+		"1":    logrus.InfoLevel,
+		" 10 ": logrus.DebugLevel,
+		"30":   logrus.WarnLevel,
+		"40":   logrus.ErrorLevel,
+	} {
+		parsed, err := cfg.parseLevel(level)
+		require.NoError(t, err)
+		assert.Equal(t, expected, parsed, level)
+	}
+	_, err := cfg.parseLevel("7")
+	assert.EqualError(t, err, "not a valid numeric log level: 7")
+	_, err = cfg.parseLevel("garbage")
+	assert.Error(t, err)
+
+	cfg = newLoggerConfig([]LoggerOption{WithNumericLogLevels(map[int]logrus.Level{7: logrus.WarnLevel})})
+	parsed, err := cfg.parseLevel("7")
+	require.NoError(t, err)
+	assert.Equal(t, logrus.WarnLevel, parsed)
+	_, err = cfg.parseLevel("1")
+	assert.Error(t, err)
+}
+
+func TestParseLevelAliases(t *testing.T) {
+	cfg := newLoggerConfig([]LoggerOption{WithLogLevelAliases(map[string]logrus.Level{"Loud": logrus.WarnLevel})})
+	for level, expected := range map[string]logrus.Level{
+		"err":         logrus.ErrorLevel,
+		"ERR":         logrus.ErrorLevel,
+		"warning":     logrus.WarnLevel,
+		"warn":        logrus.WarnLevel,
+		"information": logrus.InfoLevel,
+		"dbg":         logrus.DebugLevel,
+		"critical":    logrus.ErrorLevel,
+		"loud":        logrus.WarnLevel,
+	} {
+		parsed, err := cfg.parseLevel(level)
+		require.NoError(t, err)
+		assert.Equal(t, expected, parsed, level)
+	}
+
+	// The aliases of one logger do not affect others
+	_, err := newLoggerConfig(nil).parseLevel("loud")
+	assert.Error(t, err)
+}
+
+func TestNoRowsBehavior(t *testing.T) {
+	emptyRows := func() *sql.Rows {
+		empty := &bufferedSet{columns: []string{"_log", "x"}, databaseTypes: []string{"NVARCHAR", "NVARCHAR"}}
+		rows, err := empty.Rows()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = rows.Close() })
+		return rows
+	}
+
+	for _, tc := range []struct {
+		behavior      NoRowsBehavior
+		expectedLevel logrus.Level
+		expectedLine  string
+	}{
+		{NoRowsLogAtDefault, logrus.WarnLevel, `level=warning _norows=true x=""`},
+		{NoRowsLogAtDebug, logrus.DebugLevel, `level=debug _norows=true x=""`},
+		{NoRowsSuppress, 0, ""},
+	} {
+		logger, hook := test.NewNullLogger()
+		logger.SetLevel(logrus.DebugLevel)
+		require.NoError(t, LogrusMSSQLLogger(logger, logrus.WarnLevel, WithNoRowsBehavior(tc.behavior))(emptyRows()))
+
+		var buf bytes.Buffer
+		require.NoError(t, StdMSSQLLoggerWithLevel(log.New(&buf, "", 0), "warning", WithNoRowsBehavior(tc.behavior))(emptyRows()))
+
+		if tc.behavior == NoRowsSuppress {
+			assert.Empty(t, hook.Entries)
+			assert.Empty(t, buf.String())
+			continue
+		}
+		require.Len(t, hook.Entries, 1)
+		assert.Equal(t, tc.expectedLevel, hook.Entries[0].Level)
+		assert.Equal(t, logrus.Fields{"_norows": true, "x": ""}, hook.Entries[0].Data)
+		assert.Equal(t, tc.expectedLine, strings.TrimSpace(buf.String()))
+	}
+}
+
+func TestEventColumn(t *testing.T) {
+	logSet := func(logger RowsLogger, set *bufferedSet) {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		require.NoError(t, logger(rows))
+		require.NoError(t, rows.Close())
+	}
+	cols := []string{"_log", "_event", "amount"}
+	types := []string{"NVARCHAR", "NVARCHAR", "INT"}
+	withEvent := &bufferedSet{columns: cols, databaseTypes: types, rows: [][]any{{"info", "payment.captured", int64(100)}}}
+	empty := &bufferedSet{columns: cols, databaseTypes: types}
+
+	logger, hook := test.NewNullLogger()
+	logSet(LogrusMSSQLLogger(logger, logrus.InfoLevel), withEvent)
+	logSet(LogrusMSSQLLogger(logger, logrus.InfoLevel), empty)
+	require.Len(t, hook.Entries, 2)
+	assert.Equal(t, "payment.captured", hook.Entries[0].Message)
+	assert.Equal(t, logrus.Fields{"amount": int64(100)}, hook.Entries[0].Data)
+	assert.Equal(t, "", hook.Entries[1].Message)
+	assert.Equal(t, logrus.Fields{"_norows": true, "amount": ""}, hook.Entries[1].Data)
+
+	var buf bytes.Buffer
+	logSet(StdMSSQLLogger(log.New(&buf, "", 0)), withEvent)
+	logSet(StdMSSQLLogger(log.New(&buf, "", 0)), empty)
+	assert.Equal(t, []string{
+		`level=info event=payment.captured amount=100`,
+		`level=info _norows=true amount=""`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
+
+func TestLogValueNull(t *testing.T) {
+	for _, typ := range []string{"NVARCHAR", "MONEY", "UNIQUEIDENTIFIER", "VARBINARY", "BIT", "DATETIME2"} {
+		value, err := newLoggerConfig(nil).logValue(nil, typ)
+		require.NoError(t, err)
+		assert.Nil(t, value, typ)
+		value, err = newLoggerConfig(nil).logValue([]byte(nil), typ)
+		require.NoError(t, err)
+		assert.Nil(t, value, typ)
+	}
+
+	set := &bufferedSet{
+		columns:       []string{"_log", "a", "b"},
+		databaseTypes: []string{"NVARCHAR", "UNIQUEIDENTIFIER", "INT"},
+		rows:          [][]any{{"info", nil, int64(1)}},
+	}
+	var buf bytes.Buffer
+	for _, opts := range [][]LoggerOption{nil, {WithOmitNullLogValues()}} {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		require.NoError(t, StdMSSQLLogger(log.New(&buf, "", 0), opts...)(rows))
+		require.NoError(t, rows.Close())
+	}
+	assert.Equal(t, []string{
+		`level=info a=null b=1`,
+		`level=info b=1`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
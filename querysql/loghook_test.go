@@ -5,7 +5,8 @@ import (
 )
 
 type LogHook struct {
-	lines []logrus.Fields
+	lines  []logrus.Fields
+	levels []logrus.Level
 }
 
 func (hook *LogHook) Levels() []logrus.Level {
@@ -14,5 +15,6 @@ func (hook *LogHook) Levels() []logrus.Level {
 
 func (hook *LogHook) Fire(entry *logrus.Entry) error {
 	hook.lines = append(hook.lines, entry.Data)
+	hook.levels = append(hook.levels, entry.Level)
 	return nil
 }
@@ -1,17 +1,21 @@
 package querysql
 
 import (
+	"context"
 	"database/sql"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
-// LogrusMSSQLLogger returns a basic RowsLogger suitable for the combination of MS SQL and logrus
-func LogrusMSSQLLogger(logger logrus.FieldLogger, defaultLogLevel logrus.Level) RowsLogger {
+// LogrusMSSQLLogger returns a basic RowsLogger suitable for the combination of MS SQL and logrus.
+// The value of a column named `_event` is used as the message of the entry, the other
+// columns become fields.
+func LogrusMSSQLLogger(logger logrus.FieldLogger, defaultLogLevel logrus.Level, opts ...LoggerOption) RowsLogger {
+	cfg := newLoggerConfig(opts)
 	return func(rows *sql.Rows) error {
 		var logLevel string
 
@@ -23,6 +27,7 @@ func LogrusMSSQLLogger(logger logrus.FieldLogger, defaultLogLevel logrus.Level)
 		if err != nil {
 			return err
 		}
+		info := logSetInfoOf(rows)
 
 		// For logging just scan *everything* into a string type straight from SQL driver to make things simple here...
 		// The first column is the log level by protocol of RowsLogger.
@@ -33,78 +38,115 @@ func LogrusMSSQLLogger(logger logrus.FieldLogger, defaultLogLevel logrus.Level)
 			scanPointers[i] = &fields[i]
 		}
 
+		eventCol := eventIndex(cols)
 		hadRow := false
+		if cfg.maxAggregatedRows > 0 {
+			entry, read, err := cfg.aggregateRows(rows, info, cols, colTypes)
+			if err != nil {
+				return err
+			}
+			hadRow = read
+			if entry != nil {
+				l := logger.WithField("rows", entry.rows)
+				for i, col := range entry.tagColumns {
+					l = l.WithField(col, entry.tagValues[i])
+				}
+				level := defaultLogLevel
+				if entry.levelOK {
+					level = entry.level
+				}
+				cfg.logrusEmitLogEntry(l, level, entry.table)
+			}
+		}
+		// when aggregating the rows have been read above
 		for rows.Next() {
 			hadRow = true
 			if err = rows.Scan(scanPointers...); err != nil {
 				return err
 			}
-			parsedLogLevel, err := logrus.ParseLevel(logLevel)
+			parsedLogLevel, err := cfg.parseLevel(logLevel)
 			if err != nil {
-				logrusEmitLogEntry(logger.WithFields(logrus.Fields{
+				invalidLevelFields := logrus.Fields{
 					"event":         "invalid.log.level",
 					"invalid.level": logLevel,
-				}), logrus.ErrorLevel)
+				}
+				for _, col := range cols {
+					if tag, ok := info.tagValue(col); ok {
+						invalidLevelFields[col] = tag
+					}
+				}
+				cfg.logrusEmitLogEntry(logger.WithFields(invalidLevelFields), logrus.ErrorLevel)
 				parsedLogLevel = defaultLogLevel
+			} else if info.belowMinLevel(parsedLogLevel) {
+				continue
 			}
 
 			sublogger := logger
 			for i, value := range fields {
-				if i == 0 {
+				if i == 0 || i == eventCol {
 					continue
 				}
-				// we post-process the types of the values a bit to make some types more readable in logs
-				switch typedValue := value.(type) {
-				case []uint8:
-					switch colTypes[i].DatabaseTypeName() {
-					case "MONEY":
-						value = string(typedValue)
-					case "UNIQUEIDENTIFIER":
-						value, err = ParseSQLUUIDBytes(typedValue)
-						if err != nil {
-							return fmt.Errorf("could not decode UUID from SQL: %w", err)
-						}
-					default:
-						value = "0x" + hex.EncodeToString(typedValue)
+				if !info.isRedacted(cols[i]) {
+					value, err = cfg.logValue(value, colTypes[i].DatabaseTypeName())
+					if err != nil {
+						return err
 					}
 				}
+				if value == nil && cfg.omitNulls {
+					continue
+				}
 				sublogger = sublogger.WithField(cols[i], value)
 			}
-			logrusEmitLogEntry(sublogger, parsedLogLevel)
+			cfg.logrusEmitLogEntry(sublogger, parsedLogLevel, eventMessage(fields, eventCol))
 		}
 		if err = rows.Err(); err != nil {
 			return err
 		}
-		if !hadRow {
+		if noRowsLevel, ok := cfg.noRowsLevel(defaultLogLevel, info); !hadRow && ok {
 			// it can be quite annoying to have logging of empty tables turn into nothing, so log
 			// an indication that the log statement was there, with an empty table
 			// in this case loglevel is unreachable, and we really can only log the keys,
 			// but let's hope INFO isn't overboard
 			l := logger.WithField("_norows", true)
-			for _, col := range cols[1:] {
-				l = l.WithField(col, "")
+			for i, col := range cols {
+				if i == 0 || i == eventCol {
+					continue
+				}
+				l = l.WithField(col, info.noRowsValue(col))
 			}
-			logrusEmitLogEntry(l, defaultLogLevel)
+			cfg.logrusEmitLogEntry(l, noRowsLevel)
 		}
 		return nil
 	}
 }
 
-func logrusEmitLogEntry(logger logrus.FieldLogger, level logrus.Level) {
+// LogrusMSSQLLoggerCtx is like LogrusMSSQLLogger, but adds the fields returned by `fields`
+// for the context passed to New to every entry; e.g. the ID of the current trace.
+func LogrusMSSQLLoggerCtx(logger logrus.FieldLogger, defaultLogLevel logrus.Level, fields func(ctx context.Context) logrus.Fields, opts ...LoggerOption) RowsLoggerCtx {
+	return func(ctx context.Context, rows *sql.Rows) error {
+		return LogrusMSSQLLogger(logger.WithFields(fields(ctx)), defaultLogLevel, opts...)(rows)
+	}
+}
+
+// logrusEmitLogEntry logs an entry at `level`, with `args` as the message like logrus.Info
+func (cfg *loggerConfig) logrusEmitLogEntry(logger logrus.FieldLogger, level logrus.Level, args ...any) {
+	level, requestedLevel := cfg.nonLethalLevel(level)
+	if requestedLevel != "" {
+		logger = logger.WithField("requested_level", requestedLevel)
+	}
 	switch level {
 	case logrus.PanicLevel:
-		logger.Panic()
+		logger.Panic(args...)
 	case logrus.FatalLevel:
-		logger.Fatal()
+		logger.Fatal(args...)
 	case logrus.ErrorLevel:
-		logger.Error()
+		logger.Error(args...)
 	case logrus.WarnLevel:
-		logger.Warning()
+		logger.Warning(args...)
 	case logrus.InfoLevel:
-		logger.Info()
-	case logrus.DebugLevel:
-	case logrus.TraceLevel:
-		logger.Debug()
+		logger.Info(args...)
+	case logrus.DebugLevel, logrus.TraceLevel:
+		logger.Debug(args...)
 	default:
 		panic(fmt.Sprintf("Log level %d not handled in logrusEmitLogEntry", level))
 	}
@@ -143,3 +185,28 @@ func ParseSQLUUIDBytes(v []uint8) (uuid.UUID, error) {
 
 	return uuid.FromBytes(shuffled[:])
 }
+
+// ConvertSQLBytes converts a value that go-mssqldb gives as []byte for a column of the type
+// `databaseTypeName` to the Go type it stands for: UNIQUEIDENTIFIER to uuid.UUID, see
+// ParseSQLUUIDBytes, MONEY, DECIMAL and NUMERIC to float64, and the text types, which some
+// driver versions give as bytes for e.g. NVARCHAR(MAX), to string. A nil []byte, i.e. NULL,
+// gives nil. Other values, and the bytes of other types such as VARBINARY, are returned as they are.
+func ConvertSQLBytes(value any, databaseTypeName string) (any, error) {
+	b, ok := value.([]byte)
+	if !ok {
+		return value, nil
+	}
+	if b == nil {
+		return nil, nil
+	}
+	switch databaseTypeName {
+	case "UNIQUEIDENTIFIER":
+		return ParseSQLUUIDBytes(b)
+	case "MONEY", "DECIMAL", "NUMERIC":
+		return strconv.ParseFloat(string(b), 64)
+	case "NVARCHAR", "VARCHAR", "NCHAR", "CHAR", "NTEXT", "TEXT":
+		return string(b), nil
+	default:
+		return b, nil
+	}
+}
@@ -0,0 +1,99 @@
+package querysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLethalLogLevels(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	exited := false
+	logger.ExitFunc = func(int) { exited = true }
+
+	// By default the process survives
+	rs := &ResultSets{Logger: LogrusMSSQLLogger(logger, logrus.InfoLevel)}
+	require.NoError(t, rs.logEntry("fatal", []string{"x"}, []any{"fatal"}))
+	require.NotPanics(t, func() {
+		require.NoError(t, rs.logEntry("panic", []string{"x"}, []any{"panic"}))
+	})
+	assert.False(t, exited)
+	require.Len(t, hook.Entries, 2)
+	assert.Equal(t, logrus.ErrorLevel, hook.Entries[0].Level)
+	assert.Equal(t, logrus.Fields{"x": "fatal", "requested_level": "fatal"}, hook.Entries[0].Data)
+	assert.Equal(t, logrus.ErrorLevel, hook.Entries[1].Level)
+	assert.Equal(t, logrus.Fields{"x": "panic", "requested_level": "panic"}, hook.Entries[1].Data)
+
+	// Unless asked not to
+	hook.Reset()
+	rs = &ResultSets{Logger: LogrusMSSQLLogger(logger, logrus.InfoLevel, WithLethalLogLevels())}
+	require.NoError(t, rs.logEntry("fatal", []string{"x"}, []any{"fatal"}))
+	assert.True(t, exited)
+	assert.Panics(t, func() {
+		_ = rs.logEntry("panic", []string{"x"}, []any{"panic"})
+	})
+	require.Len(t, hook.Entries, 2)
+	assert.Equal(t, logrus.FatalLevel, hook.Entries[0].Level)
+	assert.Equal(t, logrus.PanicLevel, hook.Entries[1].Level)
+}
+
+func TestLogrusMSSQLLoggerCtx(t *testing.T) {
+	type traceKey struct{}
+	logger, hook := test.NewNullLogger()
+	ctx := context.WithValue(context.Background(), traceKey{}, "abc")
+	fields := func(ctx context.Context) logrus.Fields {
+		return logrus.Fields{"trace_id": ctx.Value(traceKey{})}
+	}
+
+	// LoggerCtx is preferred over Logger, and is passed the context of the ResultSets
+	unused, unusedHook := test.NewNullLogger()
+	rs := &ResultSets{
+		ctx:       ctx,
+		Logger:    LogrusMSSQLLogger(unused, logrus.InfoLevel),
+		LoggerCtx: LogrusMSSQLLoggerCtx(logger, logrus.InfoLevel, fields),
+	}
+	require.NoError(t, rs.logEntry("info", []string{"x"}, []any{1}))
+	assert.Empty(t, unusedHook.Entries)
+	require.Len(t, hook.Entries, 1)
+	assert.Equal(t, logrus.Fields{"x": int64(1), "trace_id": "abc"}, hook.Entries[0].Data)
+
+	// Plain RowsLoggers can be adapted
+	hook.Reset()
+	rs = &ResultSets{LoggerCtx: ToRowsLoggerCtx(LogrusMSSQLLogger(logger, logrus.InfoLevel))}
+	require.NoError(t, rs.logEntry("info", []string{"x"}, []any{2}))
+	require.Len(t, hook.Entries, 1)
+	assert.Equal(t, logrus.Fields{"x": int64(2)}, hook.Entries[0].Data)
+}
+
+func TestConvertSQLBytes(t *testing.T) {
+	id := []byte{3, 2, 1, 0, 5, 4, 7, 6, 8, 9, 10, 11, 12, 13, 14, 15}
+	for _, tc := range []struct {
+		value    any
+		typeName string
+		expected any
+	}{
+		{id, "UNIQUEIDENTIFIER", uuid.MustParse("00010203-0405-0607-0809-0a0b0c0d0e0f")},
+		{[]byte("12.50"), "MONEY", 12.5},
+		{[]byte("-0.125"), "DECIMAL", -0.125},
+		{[]byte("7"), "NUMERIC", 7.0},
+		{[]byte("text"), "NVARCHAR", "text"},
+		{[]byte("text"), "VARCHAR", "text"},
+		{[]byte{1, 2}, "VARBINARY", []byte{1, 2}},
+		{[]byte(nil), "NVARCHAR", nil},
+		{int64(1), "INT", int64(1)},
+		{nil, "MONEY", nil},
+	} {
+		value, err := ConvertSQLBytes(tc.value, tc.typeName)
+		require.NoError(t, err, tc.typeName)
+		assert.Equal(t, tc.expected, value, tc.typeName)
+	}
+	_, err := ConvertSQLBytes([]byte("abc"), "MONEY")
+	assert.Error(t, err)
+	_, err = ConvertSQLBytes([]byte{1}, "UNIQUEIDENTIFIER")
+	assert.EqualError(t, err, "ParseSQLUUIDBytes: did not get 16 bytes")
+}
@@ -0,0 +1,52 @@
+package querysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SQLMoney is an exact MONEY value, in units of 1/10000 which is the precision of MONEY. It can
+// be scanned into, and be the parameter of functions called by GoMSSQLDispatcher, unlike
+// float64 which can not represent e.g. 0.01 exactly.
+type SQLMoney int64
+
+// sqlMoneyScale is the number of decimals of MONEY
+const sqlMoneyScale = 4
+
+// Scan implements sql.Scanner; the driver gives MONEY as the decimal number in ASCII
+func (m *SQLMoney) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return m.parse(string(v))
+	case string:
+		return m.parse(v)
+	case int64:
+		*m = SQLMoney(v * 10000)
+		return nil
+	default:
+		return fmt.Errorf("not valid money: %v", value)
+	}
+}
+
+func (m *SQLMoney) parse(value string) error {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if len(frac) > sqlMoneyScale {
+		return fmt.Errorf("not valid money: %s, has more than %d decimals", value, sqlMoneyScale)
+	}
+	units, err := strconv.ParseInt(whole+frac+strings.Repeat("0", sqlMoneyScale-len(frac)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("not valid money: %s", value)
+	}
+	*m = SQLMoney(units)
+	return nil
+}
+
+// String formats the money with 4 decimals like MS SQL, e.g. 12.3400
+func (m SQLMoney) String() string {
+	sign, units := "", uint64(m)
+	if m < 0 {
+		sign, units = "-", uint64(-m)
+	}
+	return fmt.Sprintf("%s%d.%04d", sign, units/10000, units%10000)
+}
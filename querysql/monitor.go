@@ -0,0 +1,77 @@
+package querysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RowsMonitor takes the rows of a metric select and records the metrics, e.g.
+//
+//	select _metric='orders_processed_total', labels='region=eu', value=42
+//
+// The first column is the name of the metric. See the queryprom package for an implementation
+// for Prometheus.
+type RowsMonitor func(rows *sql.Rows) error
+
+func (rs *ResultSets) hasMetricColumn(cols []string) bool {
+	return len(cols) > 0 && cols[0] == "_metric"
+}
+
+// processMetricSelect passes a metric select to rs.Monitor. Like log selects without a logger,
+// metric selects are discarded if there is no monitor.
+func (rs *ResultSets) processMetricSelect() error {
+	if rs.Monitor == nil {
+		return nil
+	}
+	if err := rs.ctxErr(); err != nil {
+		return err
+	}
+	if err := rs.Monitor(rs.Rows); err != nil {
+		return &ResultSetError{Index: rs.setIndex, Err: err}
+	}
+	return rs.Rows.Err()
+}
+
+// ParseMetricLabels parses the `labels` column of a metric select, in the format
+// `name=value,name=value`, for implementations of RowsMonitor. Spaces around the names and
+// values are ignored.
+func ParseMetricLabels(labels string) (map[string]string, error) {
+	parsed := map[string]string{}
+	if strings.TrimSpace(labels) == "" {
+		return parsed, nil
+	}
+	for _, label := range strings.Split(labels, ",") {
+		name, value, ok := strings.Cut(label, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid metric label '%s' in '%s', expected name=value", label, labels)
+		}
+		parsed[name] = strings.TrimSpace(value)
+	}
+	return parsed, nil
+}
+
+// ParseMetricValue converts the `value` column of a metric select to a float64, for
+// implementations of RowsMonitor
+func ParseMetricValue(value any) (float64, error) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case []byte:
+		// DECIMAL, NUMERIC and MONEY
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("not a number: %v", value)
+	}
+}
@@ -0,0 +1,50 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricSelect(t *testing.T) {
+	var recorded [][]any
+	monitor := func(rows *sql.Rows) error {
+		set, err := readBufferedSet(rows)
+		recorded = append(recorded, set.rows...)
+		return err
+	}
+	set := &bufferedSet{
+		columns:       []string{"_metric", "labels", "value"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT"},
+		rows:          [][]any{{"orders_processed_total", "region=eu", int64(42)}},
+	}
+	ctx := WithMonitor(context.Background(), monitor)
+	require.NoError(t, DrainAll(New(ctx, bufferedDB, "buffered set", set)))
+	assert.Equal(t, [][]any{{"orders_processed_total", "region=eu", int64(42)}}, recorded)
+
+	// discarded without a monitor
+	require.NoError(t, DrainAll(New(context.Background(), bufferedDB, "buffered set", set)))
+
+	errFailed := errors.New("failed")
+	failing := func(rows *sql.Rows) error { return errFailed }
+	err := DrainAll(New(context.Background(), bufferedDB, "buffered set", set).With(WithRowsMonitor(failing)))
+	assert.ErrorIs(t, err, errFailed)
+	assert.EqualError(t, err, "result set 0: failed")
+}
+
+func TestParseMetricLabels(t *testing.T) {
+	labels, err := ParseMetricLabels(" region = eu,kind=card ")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "eu", "kind": "card"}, labels)
+
+	labels, err = ParseMetricLabels("")
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+
+	_, err = ParseMetricLabels("region")
+	assert.EqualError(t, err, "invalid metric label 'region' in 'region', expected name=value")
+}
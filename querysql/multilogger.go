@@ -0,0 +1,45 @@
+package querysql
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// MultiLogger returns a RowsLogger that passes each log select to all of `loggers`, e.g. to
+// log both for humans and to an audit sink. Since a *sql.Rows can only be read once, the
+// rows are read into memory first and replayed to each logger. All loggers are called
+// even if some of them fail; the errors are combined with errors.Join.
+func MultiLogger(loggers ...RowsLogger) RowsLogger {
+	return func(rows *sql.Rows) error {
+		info := logSetInfoOf(rows)
+		set, err := readBufferedSet(rows)
+		if err != nil {
+			return err
+		}
+		var errs []error
+		for _, logger := range loggers {
+			if err := replayToLogger(set, info, logger); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// replayToLogger passes `set` to `logger` as a *sql.Rows, with `info` for the loggers of this
+// package if it is not nil
+func replayToLogger(set *bufferedSet, info *logSetInfo, logger RowsLogger) error {
+	rows, err := set.Rows()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	if info != nil {
+		replayedLogSets.Store(rows, info)
+		defer replayedLogSets.Delete(rows)
+	}
+	if err = logger(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
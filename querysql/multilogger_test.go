@@ -0,0 +1,39 @@
+package querysql
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiLogger(t *testing.T) {
+	var first, second [][]any
+	collect := func(into *[][]any) RowsLogger {
+		return func(rows *sql.Rows) error {
+			set, err := readBufferedSet(rows)
+			*into = append(*into, set.rows...)
+			return err
+		}
+	}
+	failing := func(err error) RowsLogger {
+		return func(rows *sql.Rows) error {
+			return err
+		}
+	}
+	errFirst := errors.New("first failed")
+	errSecond := errors.New("second failed")
+
+	logger := MultiLogger(collect(&first), failing(errFirst), collect(&second), failing(errSecond))
+	rows, err := newLogEntrySet("info", []string{"x"}, []any{"hello"}).Rows()
+	require.NoError(t, err)
+	defer rows.Close()
+
+	err = logger(rows)
+	assert.ErrorIs(t, err, errFirst)
+	assert.ErrorIs(t, err, errSecond)
+	assert.Equal(t, [][]any{{"info", "hello"}}, first)
+	assert.Equal(t, [][]any{{"info", "hello"}}, second)
+}
@@ -0,0 +1,135 @@
+package querysql
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configures a ResultSets, see New and ResultSets.With
+type Option func(rs *ResultSets)
+
+// With applies `opts` to `rs`, taking precedence over the configuration New took from the
+// context. Since New does not process any result sets, the options apply to all of them
+// as long as With is called before the first Next:
+//
+//	rs := querysql.New(ctx, db, qry).With(querysql.WithRowsLogger(logger), querysql.WithDoneAfterNext())
+//
+// The query has already been started by New, though, so the entry logged by WithQueryEcho when
+// it starts goes to the logger on the context; to configure that too, pass the options to New.
+// The receiver rs is returned for syntactical brevity, a copy is not made.
+func (rs *ResultSets) With(opts ...Option) *ResultSets {
+	for _, opt := range opts {
+		opt(rs)
+	}
+	return rs
+}
+
+// splitOptions separates the Options passed to New among the parameters of the query
+func splitOptions(args []any) ([]Option, []any) {
+	var opts []Option
+	var params []any
+	for _, arg := range args {
+		if opt, ok := arg.(Option); ok {
+			opts = append(opts, opt)
+		} else {
+			params = append(params, arg)
+		}
+	}
+	if opts == nil {
+		return nil, args
+	}
+	return opts, params
+}
+
+// WithLogger sets the RowsLogger used for log selects, taking precedence over the logger on the
+// context; passing nil silences them. Since New does not process any result sets, this applies to
+// all of them, including the log selects before the first result set:
+//
+//	rows, err := querysql.NextResult(querysql.New(ctx, db, qry).WithLogger(nil), querysql.SliceOf[int])
+//
+// It is the same as With(WithRowsLogger(logger)); see With for the entries logged by New itself. The receiver rs is returned for syntactical
+// brevity, a copy is not made.
+func (rs *ResultSets) WithLogger(logger RowsLogger) *ResultSets {
+	return rs.With(WithRowsLogger(logger))
+}
+
+// WithDispatcher sets the RowsGoDispatcher used for dispatcher selects, like WithLogger, replacing
+// any RowsGoDispatcherCtx.
+// It is the same as With(WithRowsDispatcher(dispatcher)).
+func (rs *ResultSets) WithDispatcher(dispatcher RowsGoDispatcher) *ResultSets {
+	return rs.With(WithRowsDispatcher(dispatcher))
+}
+
+// WithRowsLogger sets the RowsLogger used for log selects, replacing any RowsLoggerCtx.
+// Passing nil silences them.
+func WithRowsLogger(logger RowsLogger) Option {
+	return func(rs *ResultSets) {
+		rs.Logger = logger
+		rs.LoggerCtx = nil
+		rs.warnDiscarded = false
+	}
+}
+
+// WithRowsLoggerCtx sets the RowsLoggerCtx used for log selects, see ResultSets.LoggerCtx
+func WithRowsLoggerCtx(logger RowsLoggerCtx) Option {
+	return func(rs *ResultSets) {
+		rs.LoggerCtx = logger
+	}
+}
+
+// WithRowsDispatcher sets the RowsGoDispatcher used for dispatcher selects, replacing any
+// RowsGoDispatcherCtx
+func WithRowsDispatcher(dispatcher RowsGoDispatcher) Option {
+	return func(rs *ResultSets) {
+		rs.Dispatcher = dispatcher
+		rs.DispatcherCtx = nil
+	}
+}
+
+// WithRowsDispatcherCtx sets the RowsGoDispatcherCtx used for dispatcher selects, see
+// ResultSets.DispatcherCtx
+func WithRowsDispatcherCtx(dispatcher RowsGoDispatcherCtx) Option {
+	return func(rs *ResultSets) {
+		rs.DispatcherCtx = dispatcher
+	}
+}
+
+// WithRowsLogKey sets a custom column name that triggers logging in addition to "_log",
+// see ResultSets.LogKeyLowercase. The key is compared case-insensitively.
+func WithRowsLogKey(key string) Option {
+	return func(rs *ResultSets) {
+		rs.LogKeyLowercase = strings.ToLower(key)
+	}
+}
+
+// WithRowsDispatchKey sets a custom name of the first column that triggers the dispatcher in
+// addition to "_function", see ResultSets.DispatchKeyLowercase. The key is compared
+// case-insensitively.
+func WithRowsDispatchKey(key string) Option {
+	return func(rs *ResultSets) {
+		rs.DispatchKeyLowercase = strings.ToLower(key)
+	}
+}
+
+// WithRowsMonitor sets the RowsMonitor used for metric selects, see ResultSets.Monitor
+func WithRowsMonitor(monitor RowsMonitor) Option {
+	return func(rs *ResultSets) {
+		rs.Monitor = monitor
+	}
+}
+
+// WithDoneAfterNext is the same as calling EnsureDoneAfterNext
+func WithDoneAfterNext() Option {
+	return func(rs *ResultSets) {
+		rs.DoneAfterNext = true
+	}
+}
+
+// WithRowsMinLogLevel only logs the rows of log selects with a level of at least `level`,
+// see WithMinLogLevel
+func WithRowsMinLogLevel(level logrus.Level) Option {
+	return func(rs *ResultSets) {
+		rs.minLogLevel = &level
+	}
+}
@@ -0,0 +1,214 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The kinds of instruments understood by OTelMetricsDispatcher, given by the first column
+const (
+	OTelCounter       = "otel.counter"
+	OTelUpDownCounter = "otel.updowncounter"
+	OTelHistogram     = "otel.histogram"
+)
+
+// OTelMetricsDispatcher returns a RowsGoDispatcher recording dispatcher selects as
+// OpenTelemetry metrics on `meter`, e.g.
+//
+//	select _function='otel.counter', name='payments.captured', value=1, attr_region='eu'
+//
+// The first column is the kind of instrument, one of OTelCounter, OTelUpDownCounter and
+// OTelHistogram. The float64 instrument named by the `name` column is created on first use and
+// cached; using the same name with another kind is an error. The `value` column is added to
+// counters and up-down counters and recorded by histograms; for counters it defaults to 1 if the
+// column is left out or NULL. The `attr_*`
+// columns become attributes with the prefix removed, converted like the columns of log selects;
+// NULL attributes are left out. Use OTelMetricsDispatcherCtx to record the measurements with
+// the context passed to New.
+func OTelMetricsDispatcher(meter metric.Meter) RowsGoDispatcher {
+	dispatcherCtx := OTelMetricsDispatcherCtx(meter)
+	return func(rows *sql.Rows) error {
+		return dispatcherCtx(context.Background(), rows)
+	}
+}
+
+// OTelMetricsDispatcherCtx is like OTelMetricsDispatcher, but records the measurements with the
+// context passed to New, so that exemplars are correlated with the span active in it; see
+// WithDispatcherCtx
+func OTelMetricsDispatcherCtx(meter metric.Meter) RowsGoDispatcherCtx {
+	d := &otelMetricsDispatcher{meter: meter, cfg: newLoggerConfig(nil), instruments: map[string]otelInstrument{}}
+	return d.dispatch
+}
+
+type otelMetricsDispatcher struct {
+	meter metric.Meter
+	cfg   *loggerConfig
+
+	mu          sync.Mutex
+	instruments map[string]otelInstrument
+}
+
+// otelInstrument is a cached instrument; one of the instruments is set
+type otelInstrument struct {
+	kind          string
+	counter       metric.Float64Counter
+	upDownCounter metric.Float64UpDownCounter
+	histogram     metric.Float64Histogram
+}
+
+func (d *otelMetricsDispatcher) dispatch(ctx context.Context, rows *sql.Rows) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	var kind, name any
+	fields := make([]any, len(cols))
+	scanPointers := make([]any, len(cols))
+	nameCol, valueCol := -1, -1
+	for i := range cols {
+		scanPointers[i] = &fields[i]
+		lowerCol := strings.ToLower(cols[i])
+		switch {
+		case i == 0:
+			scanPointers[i] = &kind
+		case lowerCol == "name":
+			nameCol = i
+			scanPointers[i] = &name
+		case lowerCol == "value":
+			valueCol = i
+		case strings.HasPrefix(lowerCol, "attr_"):
+		default:
+			return fmt.Errorf("unexpected column '%s' in OpenTelemetry metric select, expected 'name', 'value' and 'attr_*'", cols[i])
+		}
+	}
+	if nameCol == -1 {
+		return fmt.Errorf("missing column 'name' in OpenTelemetry metric select")
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(scanPointers...); err != nil {
+			return err
+		}
+		// See dispatchRow; `select _function=... where 1=2` is not an error
+		if kind == nil {
+			continue
+		}
+		kindName, ok := kind.(string)
+		if !ok {
+			return fmt.Errorf("first argument to 'select' is expected to be a string. Got '%v' of type '%T' instead", kind, kind)
+		}
+		metricName, ok := name.(string)
+		if !ok {
+			return fmt.Errorf("%s: column 'name' is expected to be a string. Got '%v' of type '%T' instead", kindName, name, name)
+		}
+		switch kindName {
+		case OTelCounter, OTelUpDownCounter, OTelHistogram:
+		default:
+			return fmt.Errorf("%s '%s': unknown instrument kind; expected one of '%s', '%s', '%s'", kindName, metricName, OTelCounter, OTelUpDownCounter, OTelHistogram)
+		}
+		value := 1.0
+		if valueCol != -1 && fields[valueCol] != nil {
+			if value, err = ParseMetricValue(fields[valueCol]); err != nil {
+				return fmt.Errorf("%s '%s': %w", kindName, metricName, err)
+			}
+		} else if kindName != OTelCounter {
+			return fmt.Errorf("%s '%s': missing value", kindName, metricName)
+		}
+		var attrs []attribute.KeyValue
+		for i, col := range cols {
+			if i == 0 || i == nameCol || i == valueCol {
+				continue
+			}
+			attrValue, err := d.cfg.logValue(fields[i], colTypes[i].DatabaseTypeName())
+			if err != nil {
+				return fmt.Errorf("%s '%s': %w", kindName, metricName, err)
+			}
+			if attrValue == nil {
+				continue
+			}
+			attrs = append(attrs, otelAttribute(col[len("attr_"):], attrValue))
+		}
+		if err = d.record(ctx, kindName, metricName, value, attrs); err != nil {
+			return fmt.Errorf("%s '%s': %w", kindName, metricName, err)
+		}
+	}
+	return rows.Err()
+}
+
+func (d *otelMetricsDispatcher) record(ctx context.Context, kind, name string, value float64, attrs []attribute.KeyValue) error {
+	instrument, err := d.instrument(kind, name)
+	if err != nil {
+		return err
+	}
+	opt := metric.WithAttributes(attrs...)
+	switch kind {
+	case OTelCounter:
+		if value < 0 {
+			return fmt.Errorf("counters can not decrease, got %v", value)
+		}
+		instrument.counter.Add(ctx, value, opt)
+	case OTelUpDownCounter:
+		instrument.upDownCounter.Add(ctx, value, opt)
+	case OTelHistogram:
+		instrument.histogram.Record(ctx, value, opt)
+	}
+	return nil
+}
+
+// instrument returns the cached instrument named `name`, creating it if needed
+func (d *otelMetricsDispatcher) instrument(kind, name string) (otelInstrument, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if instrument, ok := d.instruments[name]; ok {
+		if instrument.kind != kind {
+			return otelInstrument{}, fmt.Errorf("already created as %s", instrument.kind)
+		}
+		return instrument, nil
+	}
+
+	instrument := otelInstrument{kind: kind}
+	var err error
+	switch kind {
+	case OTelCounter:
+		instrument.counter, err = d.meter.Float64Counter(name)
+	case OTelUpDownCounter:
+		instrument.upDownCounter, err = d.meter.Float64UpDownCounter(name)
+	case OTelHistogram:
+		instrument.histogram, err = d.meter.Float64Histogram(name)
+	}
+	if err != nil {
+		return otelInstrument{}, err
+	}
+	d.instruments[name] = instrument
+	return instrument, nil
+}
+
+// otelAttribute converts a value returned by loggerConfig.logValue to an OpenTelemetry attribute
+func otelAttribute(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case uuid.UUID:
+		return attribute.String(key, v.String())
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
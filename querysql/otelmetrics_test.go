@@ -0,0 +1,126 @@
+package querysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+type otelMeasurement struct {
+	instrument string
+	value      float64
+	attrs      attribute.Set
+}
+
+type otelMeterRecorder struct {
+	noop.Meter
+	created      []string
+	measurements []otelMeasurement
+}
+
+type otelCounterRecorder struct {
+	noop.Float64Counter
+	name  string
+	meter *otelMeterRecorder
+}
+
+func (c otelCounterRecorder) Add(_ context.Context, value float64, opts ...metric.AddOption) {
+	c.meter.measurements = append(c.meter.measurements, otelMeasurement{c.name, value, metric.NewAddConfig(opts).Attributes()})
+}
+
+type otelUpDownCounterRecorder struct {
+	noop.Float64UpDownCounter
+	name  string
+	meter *otelMeterRecorder
+}
+
+func (c otelUpDownCounterRecorder) Add(_ context.Context, value float64, opts ...metric.AddOption) {
+	c.meter.measurements = append(c.meter.measurements, otelMeasurement{c.name, value, metric.NewAddConfig(opts).Attributes()})
+}
+
+type otelHistogramRecorder struct {
+	noop.Float64Histogram
+	name  string
+	meter *otelMeterRecorder
+}
+
+func (h otelHistogramRecorder) Record(_ context.Context, value float64, opts ...metric.RecordOption) {
+	h.meter.measurements = append(h.meter.measurements, otelMeasurement{h.name, value, metric.NewRecordConfig(opts).Attributes()})
+}
+
+func (m *otelMeterRecorder) Float64Counter(name string, _ ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	m.created = append(m.created, name)
+	return otelCounterRecorder{name: name, meter: m}, nil
+}
+
+func (m *otelMeterRecorder) Float64UpDownCounter(name string, _ ...metric.Float64UpDownCounterOption) (metric.Float64UpDownCounter, error) {
+	m.created = append(m.created, name)
+	return otelUpDownCounterRecorder{name: name, meter: m}, nil
+}
+
+func (m *otelMeterRecorder) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	m.created = append(m.created, name)
+	return otelHistogramRecorder{name: name, meter: m}, nil
+}
+
+func TestOTelMetricsDispatcher(t *testing.T) {
+	meter := &otelMeterRecorder{}
+	dispatcher := OTelMetricsDispatcher(meter)
+	dispatchSet := func(set *bufferedSet) error {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		return dispatcher(rows)
+	}
+
+	require.NoError(t, dispatchSet(&bufferedSet{
+		columns:       []string{"_function", "name", "value", "attr_region", "attr_retry", "attr_note"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT", "NVARCHAR", "BIT", "NVARCHAR"},
+		rows: [][]any{
+			{"otel.counter", "payments.captured", int64(2), "eu", false, nil},
+			{"otel.counter", "payments.captured", nil, "eu", true, nil},
+			{"otel.updowncounter", "payments.pending", int64(-3), "no", nil, nil},
+			{"otel.histogram", "payments.amount", int64(7), nil, nil, "x"},
+		},
+	}))
+	require.NoError(t, dispatchSet(&bufferedSet{
+		columns:       []string{"_function", "name", "value"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "DECIMAL"},
+		rows:          [][]any{{"otel.histogram", "payments.amount", []byte("12.50")}},
+	}))
+
+	assert.Equal(t, []string{"payments.captured", "payments.pending", "payments.amount"}, meter.created)
+	assert.Equal(t, []otelMeasurement{
+		{"payments.captured", 2, attribute.NewSet(attribute.String("region", "eu"), attribute.Bool("retry", false))},
+		{"payments.captured", 1, attribute.NewSet(attribute.String("region", "eu"), attribute.Bool("retry", true))},
+		{"payments.pending", -3, attribute.NewSet(attribute.String("region", "no"))},
+		{"payments.amount", 7, attribute.NewSet(attribute.String("note", "x"))},
+		{"payments.amount", 12.5, attribute.NewSet()},
+	}, meter.measurements)
+
+	assert.EqualError(t, dispatchSet(&bufferedSet{
+		columns:       []string{"_function", "name", "value"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT"},
+		rows:          [][]any{{"otel.gauge", "payments.pending", int64(1)}},
+	}), "otel.gauge 'payments.pending': unknown instrument kind; expected one of 'otel.counter', 'otel.updowncounter', 'otel.histogram'")
+	assert.EqualError(t, dispatchSet(&bufferedSet{
+		columns:       []string{"_function", "name", "value"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT"},
+		rows:          [][]any{{"otel.histogram", "payments.pending", int64(1)}},
+	}), "otel.histogram 'payments.pending': already created as otel.updowncounter")
+	assert.EqualError(t, dispatchSet(&bufferedSet{
+		columns:       []string{"_function", "name", "value"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT"},
+		rows:          [][]any{{"otel.counter", "payments.captured", int64(-1)}},
+	}), "otel.counter 'payments.captured': counters can not decrease, got -1")
+	assert.EqualError(t, dispatchSet(&bufferedSet{
+		columns:       []string{"_function", "name", "region"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"otel.counter", "payments.captured", "eu"}},
+	}), "unexpected column 'region' in OpenTelemetry metric select, expected 'name', 'value' and 'attr_*'")
+}
@@ -0,0 +1,184 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	otellog "go.opentelemetry.io/otel/log"
+)
+
+// OTelMSSQLLogger returns a basic RowsLogger suitable for the combination of MS SQL and the
+// OpenTelemetry logs API. It follows the same conventions as LogrusMSSQLLogger; each row is
+// emitted as a record with the columns as attributes and the `_event` column as the body, and
+// the level names of logrus are mapped to the corresponding severity. Rows with an unknown level
+// are emitted at otellog.SeverityError with the unknown level in the `invalid.level` attribute.
+// Use OTelMSSQLLoggerCtx to correlate the records with the active span.
+func OTelMSSQLLogger(logger otellog.Logger, defaultSeverity otellog.Severity, opts ...LoggerOption) RowsLogger {
+	loggerCtx := OTelMSSQLLoggerCtx(logger, defaultSeverity, opts...)
+	return func(rows *sql.Rows) error {
+		return loggerCtx(context.Background(), rows)
+	}
+}
+
+// OTelMSSQLLoggerCtx is like OTelMSSQLLogger, but emits the records with the context passed to
+// New, so that they are correlated with the span active in it; see WithLoggerCtx
+func OTelMSSQLLoggerCtx(logger otellog.Logger, defaultSeverity otellog.Severity, opts ...LoggerOption) RowsLoggerCtx {
+	cfg := newLoggerConfig(opts)
+	return func(ctx context.Context, rows *sql.Rows) error {
+		var logLevel string
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		colTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		info := logSetInfoOf(rows)
+
+		// The first column is the log level by protocol of RowsLogger.
+		fields := make([]interface{}, len(cols))
+		scanPointers := make([]interface{}, len(cols))
+		scanPointers[0] = &logLevel
+		for i := 1; i < len(cols); i++ {
+			scanPointers[i] = &fields[i]
+		}
+
+		eventCol := eventIndex(cols)
+		hadRow := false
+		if cfg.maxAggregatedRows > 0 {
+			entry, read, err := cfg.aggregateRows(rows, info, cols, colTypes)
+			if err != nil {
+				return err
+			}
+			hadRow = read
+			if entry != nil {
+				attrs := []otellog.KeyValue{otellog.Int("rows", entry.rows)}
+				for i, col := range entry.tagColumns {
+					attrs = append(attrs, otellog.String(col, entry.tagValues[i]))
+				}
+				severity := defaultSeverity
+				if entry.levelOK {
+					severity = otelSeverity(entry.level)
+				}
+				emitOTelRecord(ctx, logger, severity, entry.table, attrs)
+			}
+		}
+		// when aggregating the rows have been read above
+		for rows.Next() {
+			hadRow = true
+			if err = rows.Scan(scanPointers...); err != nil {
+				return err
+			}
+
+			attrs := make([]otellog.KeyValue, 0, len(cols))
+			severity := otellog.SeverityError
+			if parsed, err := cfg.parseLevel(logLevel); err == nil {
+				if info.belowMinLevel(parsed) {
+					continue
+				}
+				// OpenTelemetry has no lethal levels, but mark them as for the other loggers
+				parsed, requestedLevel := cfg.nonLethalLevel(parsed)
+				if requestedLevel != "" {
+					attrs = append(attrs, otellog.String("requested_level", requestedLevel))
+				}
+				severity = otelSeverity(parsed)
+			} else {
+				attrs = append(attrs, otellog.String("invalid.level", logLevel))
+			}
+			for i, value := range fields {
+				if i == 0 || i == eventCol {
+					continue
+				}
+				if !info.isRedacted(cols[i]) {
+					value, err = cfg.logValue(value, colTypes[i].DatabaseTypeName())
+					if err != nil {
+						return err
+					}
+				}
+				if value == nil && cfg.omitNulls {
+					continue
+				}
+				attrs = append(attrs, otellog.KeyValue{Key: cols[i], Value: otelValue(value)})
+			}
+			emitOTelRecord(ctx, logger, severity, eventMessage(fields, eventCol), attrs)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		noRowsSeverity := defaultSeverity
+		if cfg.noRows == NoRowsLogAtDebug {
+			noRowsSeverity = otellog.SeverityDebug
+		}
+		minLevel, hasMinLevel := info.minLogLevel()
+		if !hadRow && cfg.noRows != NoRowsSuppress && (!hasMinLevel || noRowsSeverity >= otelSeverity(minLevel)) {
+			// See LogrusMSSQLLogger
+			attrs := []otellog.KeyValue{otellog.Bool("_norows", true)}
+			for i, col := range cols {
+				if i == 0 || i == eventCol {
+					continue
+				}
+				attrs = append(attrs, otellog.String(col, info.noRowsValue(col)))
+			}
+			emitOTelRecord(ctx, logger, noRowsSeverity, "", attrs)
+		}
+		return nil
+	}
+}
+
+func emitOTelRecord(ctx context.Context, logger otellog.Logger, severity otellog.Severity, body string, attrs []otellog.KeyValue) {
+	var record otellog.Record
+	record.SetTimestamp(time.Now())
+	record.SetSeverity(severity)
+	record.SetSeverityText(severity.String())
+	if body != "" {
+		record.SetBody(otellog.StringValue(body))
+	}
+	record.AddAttributes(attrs...)
+	logger.Emit(ctx, record)
+}
+
+// otelSeverity maps a logrus level onto the corresponding OpenTelemetry severity
+func otelSeverity(level logrus.Level) otellog.Severity {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return otellog.SeverityFatal
+	case logrus.ErrorLevel:
+		return otellog.SeverityError
+	case logrus.WarnLevel:
+		return otellog.SeverityWarn
+	case logrus.InfoLevel:
+		return otellog.SeverityInfo
+	case logrus.DebugLevel:
+		return otellog.SeverityDebug
+	default:
+		return otellog.SeverityTrace
+	}
+}
+
+// otelValue converts a value returned by loggerConfig.logValue to an OpenTelemetry value
+func otelValue(value any) otellog.Value {
+	switch v := value.(type) {
+	case nil:
+		return otellog.Value{}
+	case string:
+		return otellog.StringValue(v)
+	case int64:
+		return otellog.Int64Value(v)
+	case float64:
+		return otellog.Float64Value(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case []byte:
+		return otellog.BytesValue(v)
+	case uuid.UUID:
+		return otellog.StringValue(v.String())
+	default:
+		return otellog.StringValue(fmt.Sprint(v))
+	}
+}
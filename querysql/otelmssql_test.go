@@ -0,0 +1,85 @@
+package querysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/embedded"
+)
+
+type otelRecorder struct {
+	embedded.Logger
+	records []otellog.Record
+	ctxs    []context.Context
+}
+
+func (r *otelRecorder) Emit(ctx context.Context, record otellog.Record) {
+	r.records = append(r.records, record)
+	r.ctxs = append(r.ctxs, ctx)
+}
+
+func (r *otelRecorder) Enabled(context.Context, otellog.Record) bool {
+	return true
+}
+
+func otelAttributes(record otellog.Record) map[string]otellog.Value {
+	attrs := map[string]otellog.Value{}
+	record.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	return attrs
+}
+
+func TestOTelMSSQLLogger(t *testing.T) {
+	type traceKey struct{}
+	ctx := context.WithValue(context.Background(), traceKey{}, "span")
+	recorder := &otelRecorder{}
+	rs := &ResultSets{ctx: ctx, LoggerCtx: OTelMSSQLLoggerCtx(recorder, otellog.SeverityInfo)}
+
+	id := uuid.MustParse("00010203-0405-0607-0809-0a0b0c0d0e0f")
+	set := &bufferedSet{
+		columns:       []string{"_log", "_event", "id", "amount", "n"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "UNIQUEIDENTIFIER", "MONEY", "INT"},
+		rows: [][]any{
+			{"warning", "payment.captured", []byte{3, 2, 1, 0, 5, 4, 7, 6, 8, 9, 10, 11, 12, 13, 14, 15}, []byte("12.5000"), int64(1)},
+			{"nonsense", nil, nil, nil, int64(2)},
+		},
+	}
+	rows, err := set.Rows()
+	require.NoError(t, err)
+	defer func() { _ = rows.Close() }()
+	rs.Rows = rows
+	require.NoError(t, rs.processLogSelect())
+	require.NoError(t, rs.logEntry("fatal", []string{"x"}, []any{"y"}))
+
+	require.Len(t, recorder.records, 3)
+	for _, recordCtx := range recorder.ctxs {
+		assert.Equal(t, "span", recordCtx.Value(traceKey{}))
+	}
+
+	record := recorder.records[0]
+	assert.Equal(t, otellog.SeverityWarn, record.Severity())
+	assert.Equal(t, "payment.captured", record.Body().AsString())
+	assert.Equal(t, map[string]otellog.Value{
+		"id":     otellog.StringValue(id.String()),
+		"amount": otellog.StringValue("12.5000"),
+		"n":      otellog.Int64Value(1),
+	}, otelAttributes(record))
+
+	record = recorder.records[1]
+	assert.Equal(t, otellog.SeverityError, record.Severity())
+	assert.True(t, record.Body().Empty())
+	assert.Equal(t, otellog.StringValue("nonsense"), otelAttributes(record)["invalid.level"])
+
+	record = recorder.records[2]
+	assert.Equal(t, otellog.SeverityError, record.Severity())
+	assert.Equal(t, map[string]otellog.Value{
+		"requested_level": otellog.StringValue("fatal"),
+		"x":               otellog.StringValue("y"),
+	}, otelAttributes(record))
+}
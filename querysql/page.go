@@ -0,0 +1,45 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// PageRequest specifies which page of rows to fetch with Page. Offset and Limit
+// are passed to the query as the named parameters @offset and @limit.
+type PageRequest struct {
+	Offset int
+	Limit  int
+}
+
+// PageResult is the result of Page
+type PageResult[T any] struct {
+	Items []T
+	// Total is the total number of rows across all pages, as returned by the query
+	Total int64
+	// HasMore is true if there are rows after the ones in Items
+	HasMore bool
+}
+
+// Page executes a query that by convention returns two result sets; first the rows
+// of the requested page, then a single row with the total number of rows. Example:
+//
+//	select ID, Name from Users order by ID offset @offset rows fetch next @limit rows only;
+//	select count(*) from Users;
+//
+// The @offset and @limit parameters are appended to `args`.
+func Page[T any](ctx context.Context, querier CtxQuerier, qry string, pageReq PageRequest, args ...any) (PageResult[T], error) {
+	pageArgs := make([]any, 0, len(args)+2)
+	pageArgs = append(pageArgs, args...)
+	pageArgs = append(pageArgs, sql.Named("offset", pageReq.Offset), sql.Named("limit", pageReq.Limit))
+
+	items, total, err := Query2(SliceOf[T], SingleOf[int64], ctx, querier, qry, pageArgs...)
+	if err != nil {
+		return PageResult[T]{}, err
+	}
+	return PageResult[T]{
+		Items:   items,
+		Total:   total,
+		HasMore: int64(pageReq.Offset+len(items)) < total,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ReturnStatusKey is the key in the `out` map of ExecProc that receives the
+// return status of the procedure
+const ReturnStatusKey = "_return"
+
+// returnStatusParam is the name of the parameter receiving the return status; database/sql
+// requires parameter names to start with a letter
+const returnStatusParam = "querysql_return"
+
+var procNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_#.\[\]]+$`)
+
+// ExecProc executes the stored procedure `proc`, passing each entry of `in` as a named input
+// parameter and each entry of `out` as an output parameter. The values of `out` are pointers
+// that receive the output values (a sql.Out is used as is, e.g. to pass In: true). The return
+// status of the procedure is stored in `out[ReturnStatusKey]`, if present. Example:
+//
+//	var count, status int
+//	err := querysql.ExecProc(ctx, db, "dbo.CountUsers",
+//		map[string]any{"minAge": 18},
+//		map[string]any{"count": &count, querysql.ReturnStatusKey: &status})
+//
+// executes `exec @querysql_return = dbo.CountUsers @count = @count output, @minAge = @minAge`.
+// Parameter names may be given with or without the leading '@'. As with ExecContext,
+// logging and dispatcher selects done by the procedure are processed.
+func ExecProc(ctx context.Context, querier CtxQuerier, proc string, in map[string]any, out map[string]any) error {
+	qry, args, err := procStatement(proc, in, out)
+	if err != nil {
+		return err
+	}
+	return DrainAll(New(ctx, querier, qry, args...))
+}
+
+func procStatement(proc string, in map[string]any, out map[string]any) (string, []any, error) {
+	if !procNameRegexp.MatchString(proc) {
+		return "", nil, fmt.Errorf("invalid procedure name '%s'", proc)
+	}
+
+	params := make(map[string]any, len(in)+len(out))
+	isOut := make(map[string]bool, len(out))
+	for _, m := range []map[string]any{in, out} {
+		for key, value := range m {
+			name := strings.TrimPrefix(key, "@")
+			if _, ok := params[name]; ok {
+				return "", nil, fmt.Errorf("parameter '%s' given more than once", name)
+			}
+			params[name] = value
+		}
+	}
+	for key := range out {
+		isOut[strings.TrimPrefix(key, "@")] = true
+	}
+	if _, ok := params[ReturnStatusKey]; ok && !isOut[ReturnStatusKey] {
+		return "", nil, fmt.Errorf("'%s' can only be used as an output parameter", ReturnStatusKey)
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		if name != ReturnStatusKey && !parameterNameRegexp.MatchString(name) {
+			return "", nil, fmt.Errorf("invalid parameter name '%s'; must be a letter followed by letters, digits or underscores", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var qry strings.Builder
+	qry.WriteString("exec ")
+	if isOut[ReturnStatusKey] {
+		qry.WriteString("@" + returnStatusParam + " = ")
+	}
+	qry.WriteString(proc)
+	args := make([]any, 0, len(names))
+	first := true
+	for _, name := range names {
+		value := params[name]
+		if isOut[name] {
+			if _, ok := value.(sql.Out); !ok {
+				value = sql.Out{Dest: value}
+			}
+		}
+		if name == ReturnStatusKey {
+			args = append(args, sql.Named(returnStatusParam, value))
+			continue
+		}
+		args = append(args, sql.Named(name, value))
+		if !first {
+			qry.WriteString(",")
+		}
+		first = false
+		qry.WriteString(" @" + name + " = @" + name)
+		if isOut[name] {
+			qry.WriteString(" output")
+		}
+	}
+	return qry.String(), args, nil
+}
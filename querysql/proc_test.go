@@ -0,0 +1,72 @@
+package querysql_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+func TestExecProc(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+
+	err := querysql.OnConn(ctx, sqldb, func(q querysql.CtxQuerier) error {
+		_, err := querysql.ExecContext(ctx, q, `
+create procedure #ExecProcTest(@a int, @b nvarchar(max), @sum int output, @doubled int output) as
+begin
+	select _log='info', b = @b;
+	set @sum = @a + @doubled;
+	set @doubled = 2 * @doubled;
+	return 42;
+end
+`)
+		require.NoError(t, err)
+
+		var sum, status int
+		doubled := 10
+		err = querysql.ExecProc(ctx, q, "#ExecProcTest",
+			map[string]any{"a": 1, "@b": "hello"},
+			map[string]any{
+				"sum":                    &sum,
+				"doubled":                sql.Out{Dest: &doubled, In: true},
+				querysql.ReturnStatusKey: &status,
+			})
+		require.NoError(t, err)
+		assert.Equal(t, 11, sum)
+		assert.Equal(t, 20, doubled)
+		assert.Equal(t, 42, status)
+		assert.Equal(t, []logrus.Fields{{"b": "hello"}}, hook.lines)
+
+		// sql.Out also passes through New/ExecContext untouched
+		var out int
+		_, err = querysql.ExecContext(ctx, q, `set @out = 3`, sql.Named("out", sql.Out{Dest: &out}))
+		require.NoError(t, err)
+		assert.Equal(t, 3, out)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestExecProcInvalid(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		proc     string
+		in, out  map[string]any
+		expected string
+	}{
+		{"dbo.Proc; drop table X", nil, nil, "invalid procedure name 'dbo.Proc; drop table X'"},
+		{"dbo.Proc", map[string]any{"a b": 1}, nil, "invalid parameter name 'a b'; must be a letter followed by letters, digits or underscores"},
+		{"dbo.Proc", map[string]any{"a": 1}, map[string]any{"@a": new(int)}, "parameter 'a' given more than once"},
+		{"dbo.Proc", map[string]any{"_return": 1}, nil, "'_return' can only be used as an output parameter"},
+	} {
+		err := querysql.ExecProc(ctx, sqldb, tc.proc, tc.in, tc.out)
+		assert.EqualError(t, err, tc.expected)
+	}
+}
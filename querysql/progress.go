@@ -0,0 +1,128 @@
+package querysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProgressEvent is the progress reported by a row of a progress select, e.g.
+//
+//	select _progress='copy rows', done=@i, total=@n
+type ProgressEvent struct {
+	// Step is the value of the `_progress` column
+	Step string
+	// Done and Total are the values of the `done` and `total` columns, or 0 if absent
+	Done  int64
+	Total int64
+	// Percent is Done as a percentage of Total, or 0 if Total is 0
+	Percent float64
+	// Elapsed is the time since the first progress row of the query
+	Elapsed time.Duration
+	// Fields are the other columns of the progress select
+	Fields map[string]any
+}
+
+// ProgressLogger receives the events of progress selects, see WithProgressLogger
+type ProgressLogger func(event ProgressEvent) error
+
+func (rs *ResultSets) hasProgressColumn(cols []string) bool {
+	return len(cols) > 0 && cols[0] == "_progress"
+}
+
+// processProgressSelect passes each row of a progress select to rs.progress, or by default
+// logs it as an entry with the event "progress"
+func (rs *ResultSets) processProgressSelect() error {
+	cols, err := rs.Rows.Columns()
+	if err != nil {
+		return err
+	}
+	colTypes, err := rs.Rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	cfg := newLoggerConfig(nil)
+
+	var step string
+	values := make([]any, len(cols))
+	scanPointers := make([]any, len(cols))
+	scanPointers[0] = &step
+	for i := 1; i < len(cols); i++ {
+		scanPointers[i] = &values[i]
+	}
+	for n := 0; rs.Rows.Next(); n++ {
+		if n%ctxCheckInterval == 0 {
+			if err = rs.ctxErr(); err != nil {
+				return err
+			}
+		}
+		if err = rs.Rows.Scan(scanPointers...); err != nil {
+			return &ResultSetError{Index: rs.setIndex, Err: fmt.Errorf("could not read _progress row: %w", err)}
+		}
+		if rs.progressStart.IsZero() {
+			rs.progressStart = time.Now()
+		}
+		event := ProgressEvent{Step: step, Elapsed: time.Since(rs.progressStart), Fields: map[string]any{}}
+		for i := 1; i < len(cols); i++ {
+			switch strings.ToLower(cols[i]) {
+			case "done":
+				event.Done, err = progressCount(values[i])
+			case "total":
+				event.Total, err = progressCount(values[i])
+			default:
+				event.Fields[cols[i]], err = cfg.logValue(values[i], colTypes[i].DatabaseTypeName())
+			}
+			if err != nil {
+				return &ResultSetError{Index: rs.setIndex, Err: fmt.Errorf("_progress column %s: %w", cols[i], err)}
+			}
+		}
+		if event.Total != 0 {
+			event.Percent = 100 * float64(event.Done) / float64(event.Total)
+		}
+
+		if rs.progress != nil {
+			err = rs.progress(event)
+		} else {
+			err = rs.logProgress(event, cols[1:])
+		}
+		if err != nil {
+			return &ResultSetError{Index: rs.setIndex, Err: err}
+		}
+	}
+	return rs.Rows.Err()
+}
+
+// logProgress logs `event` through the RowsLogger as a compact entry at info level, with the
+// fields of the event in the order of `cols`
+func (rs *ResultSets) logProgress(event ProgressEvent, cols []string) error {
+	columns := []string{"event", "step", "done", "total", "percent", "elapsed_ms"}
+	values := []any{"progress", event.Step, event.Done, event.Total, strconv.FormatFloat(event.Percent, 'f', 1, 64), event.Elapsed.Milliseconds()}
+	for _, col := range cols {
+		if value, ok := event.Fields[col]; ok {
+			columns = append(columns, col)
+			values = append(values, value)
+		}
+	}
+	return rs.logEntry("info", columns, values)
+}
+
+// progressCount converts the value of a `done` or `total` column to an int64
+func progressCount(value any) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case []byte:
+		// DECIMAL and NUMERIC
+		f, err := strconv.ParseFloat(string(v), 64)
+		return int64(f), err
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("not a number: %v", value)
+	}
+}
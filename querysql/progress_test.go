@@ -0,0 +1,54 @@
+package querysql
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressSelect(t *testing.T) {
+	set := &bufferedSet{
+		columns:       []string{"_progress", "done", "total", "batch"},
+		databaseTypes: []string{"NVARCHAR", "INT", "INT", "NVARCHAR"},
+		rows: [][]any{
+			{"copy rows", int64(1), int64(4), "a"},
+			{"copy rows", int64(3), int64(4), "b"},
+			{"cleanup", int64(7), nil, "c"},
+		},
+	}
+	process := func(rs *ResultSets) {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		rs.Rows = rows
+		require.NoError(t, rs.processProgressSelect())
+	}
+
+	var events []ProgressEvent
+	process(&ResultSets{progress: func(event ProgressEvent) error {
+		events = append(events, event)
+		return nil
+	}})
+	require.Len(t, events, 3)
+	for i, expected := range []ProgressEvent{
+		{Step: "copy rows", Done: 1, Total: 4, Percent: 25, Fields: map[string]any{"batch": "a"}},
+		{Step: "copy rows", Done: 3, Total: 4, Percent: 75, Fields: map[string]any{"batch": "b"}},
+		{Step: "cleanup", Done: 7, Fields: map[string]any{"batch": "c"}},
+	} {
+		assert.GreaterOrEqual(t, events[i].Elapsed, events[0].Elapsed)
+		events[i].Elapsed = 0
+		assert.Equal(t, expected, events[i])
+	}
+
+	// Without a ProgressLogger the events are logged
+	var buf bytes.Buffer
+	process(&ResultSets{Logger: StdMSSQLLogger(log.New(&buf, "", 0))})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Regexp(t, `^level=info event=progress step="copy rows" done=1 total=4 percent=25.0 elapsed_ms=\d+ batch=a$`, lines[0])
+	assert.Regexp(t, `^level=info event=progress step=cleanup done=7 total=0 percent=0.0 elapsed_ms=\d+ batch=c$`, lines[2])
+}
@@ -0,0 +1,59 @@
+// Package queryprom contains Prometheus instrumentation for querysql.
+package queryprom
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+// DispatchMetrics counts and times the calls of dispatched functions. Add its Observe method to
+// the dispatcher, e.g.
+//
+//	metrics, err := queryprom.NewDispatchMetrics(prometheus.DefaultRegisterer)
+//	...
+//	dispatcher := querysql.NewDispatcherFuncs(RecordMetric).
+//		WithDispatchObserver(metrics.Observe).
+//		Dispatcher()
+//
+// The metrics are querysql_dispatch_calls_total, by function and whether the call failed, and
+// querysql_dispatch_duration_seconds, by function. Calls suppressed by querysql.DedupDispatcher,
+// when Observe is passed to querysql.DedupObserver, are counted with error="suppressed".
+type DispatchMetrics struct {
+	calls    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewDispatchMetrics returns DispatchMetrics registered with `registerer`
+func NewDispatchMetrics(registerer prometheus.Registerer) (*DispatchMetrics, error) {
+	m := &DispatchMetrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "querysql_dispatch_calls_total",
+			Help: "Calls of functions by querysql dispatcher selects.",
+		}, []string{"function", "error"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "querysql_dispatch_duration_seconds",
+			Help:    "Duration of the calls of functions by querysql dispatcher selects.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"function"}),
+	}
+	for _, collector := range []prometheus.Collector{m.calls, m.duration} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Observe records a call of the function `name`; it is a querysql.DispatchObserver
+func (m *DispatchMetrics) Observe(name string, duration time.Duration, err error) {
+	if errors.Is(err, querysql.ErrDispatchSuppressed) {
+		m.calls.WithLabelValues(name, "suppressed").Inc()
+		return
+	}
+	m.calls.WithLabelValues(name, strconv.FormatBool(err != nil)).Inc()
+	m.duration.WithLabelValues(name).Observe(duration.Seconds())
+}
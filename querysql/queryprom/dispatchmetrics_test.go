@@ -0,0 +1,38 @@
+package queryprom
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+func TestDispatchMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewDispatchMetrics(registry)
+	require.NoError(t, err)
+
+	metrics.Observe("Record", time.Millisecond, nil)
+	metrics.Observe("Record", 2*time.Millisecond, nil)
+	metrics.Observe("Record", time.Millisecond, errors.New("failed"))
+	metrics.Observe("Record", 0, querysql.ErrDispatchSuppressed)
+
+	assert.NoError(t, testutil.CollectAndCompare(registry, strings.NewReader(`
+# HELP querysql_dispatch_calls_total Calls of functions by querysql dispatcher selects.
+# TYPE querysql_dispatch_calls_total counter
+querysql_dispatch_calls_total{error="false",function="Record"} 2
+querysql_dispatch_calls_total{error="suppressed",function="Record"} 1
+querysql_dispatch_calls_total{error="true",function="Record"} 1
+`), "querysql_dispatch_calls_total"))
+	assert.Equal(t, 1, testutil.CollectAndCount(registry, "querysql_dispatch_duration_seconds"))
+
+	// registering twice fails
+	_, err = NewDispatchMetrics(registry)
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package queryprom
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+// Monitor records the rows of metric selects as Prometheus metrics. The metrics must be
+// declared with Counter, Gauge or Histogram, and the Record method registered as the
+// querysql.RowsMonitor, e.g.
+//
+//	monitor := queryprom.NewMonitor(prometheus.DefaultRegisterer)
+//	err := monitor.Counter("orders_processed_total", "Orders processed.", "region")
+//	...
+//	ctx = querysql.WithMonitor(ctx, monitor.Record)
+//
+// after which `select _metric='orders_processed_total', labels='region=eu', value=42` adds 42
+// to the counter. The `labels` column, parsed by querysql.ParseMetricLabels, must give all the
+// labels of the metric; NULL means no labels. The `value` column is added to counters,
+// defaulting to 1, set on gauges and observed by histograms.
+type Monitor struct {
+	registerer prometheus.Registerer
+	mu         sync.RWMutex
+	metrics    map[string]*metric
+}
+
+// metric is a declared metric; one of the vectors is set
+type metric struct {
+	counter   *prometheus.CounterVec
+	gauge     *prometheus.GaugeVec
+	histogram *prometheus.HistogramVec
+}
+
+// NewMonitor returns a Monitor registering the metrics declared with `registerer`
+func NewMonitor(registerer prometheus.Registerer) *Monitor {
+	return &Monitor{registerer: registerer, metrics: map[string]*metric{}}
+}
+
+// Counter declares and registers a counter with the label names `labels`
+func (m *Monitor) Counter(name, help string, labels ...string) error {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	return m.declare(name, vec, &metric{counter: vec})
+}
+
+// Gauge declares and registers a gauge with the label names `labels`
+func (m *Monitor) Gauge(name, help string, labels ...string) error {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	return m.declare(name, vec, &metric{gauge: vec})
+}
+
+// Histogram declares and registers a histogram with the label names `labels`. `buckets` nil
+// means prometheus.DefBuckets.
+func (m *Monitor) Histogram(name, help string, buckets []float64, labels ...string) error {
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	return m.declare(name, vec, &metric{histogram: vec})
+}
+
+func (m *Monitor) declare(name string, collector prometheus.Collector, declared *metric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.metrics[name]; ok {
+		return fmt.Errorf("metric '%s' is already declared", name)
+	}
+	if err := m.registerer.Register(collector); err != nil {
+		return err
+	}
+	m.metrics[name] = declared
+	return nil
+}
+
+// Record records the rows of a metric select; it is a querysql.RowsMonitor
+func (m *Monitor) Record(rows *sql.Rows) error {
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	var name string
+	var labels sql.NullString
+	var value any
+	scanPointers := make([]any, len(cols))
+	scanPointers[0] = &name
+	for i := 1; i < len(cols); i++ {
+		switch strings.ToLower(cols[i]) {
+		case "labels":
+			scanPointers[i] = &labels
+		case "value":
+			scanPointers[i] = &value
+		default:
+			return fmt.Errorf("unexpected column '%s' in metric select, expected 'labels' and 'value'", cols[i])
+		}
+	}
+
+	for rows.Next() {
+		labels, value = sql.NullString{}, nil
+		if err = rows.Scan(scanPointers...); err != nil {
+			return err
+		}
+		if err = m.record(name, labels.String, value); err != nil {
+			return fmt.Errorf("metric '%s': %w", name, err)
+		}
+	}
+	return rows.Err()
+}
+
+func (m *Monitor) record(name, labels string, value any) error {
+	m.mu.RLock()
+	declared, ok := m.metrics[name]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("not declared; expected one of %s", m.names())
+	}
+	parsedLabels, err := querysql.ParseMetricLabels(labels)
+	if err != nil {
+		return err
+	}
+	n := 1.0
+	if value != nil {
+		if n, err = querysql.ParseMetricValue(value); err != nil {
+			return err
+		}
+	} else if declared.counter == nil {
+		return fmt.Errorf("missing value")
+	}
+
+	switch {
+	case declared.counter != nil:
+		if n < 0 {
+			return fmt.Errorf("counters can not decrease, got %v", n)
+		}
+		counter, err := declared.counter.GetMetricWith(parsedLabels)
+		if err != nil {
+			return err
+		}
+		counter.Add(n)
+	case declared.gauge != nil:
+		gauge, err := declared.gauge.GetMetricWith(parsedLabels)
+		if err != nil {
+			return err
+		}
+		gauge.Set(n)
+	default:
+		histogram, err := declared.histogram.GetMetricWith(parsedLabels)
+		if err != nil {
+			return err
+		}
+		histogram.Observe(n)
+	}
+	return nil
+}
+
+// names returns the names of the declared metrics, sorted and quoted
+func (m *Monitor) names() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.metrics))
+	for name := range m.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "'" + strings.Join(names, "', '") + "'"
+}
@@ -0,0 +1,111 @@
+package queryprom
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// metricRows is a driver.Connector, driver.Conn and driver.QueryerContext returning a
+// fixed metric select for any query, so that Record can be tested without a database
+type metricRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (m *metricRows) Connect(context.Context) (driver.Conn, error) { return m, nil }
+func (m *metricRows) Driver() driver.Driver                        { return nil }
+func (m *metricRows) Prepare(string) (driver.Stmt, error)          { return nil, driver.ErrSkip }
+func (m *metricRows) Close() error                                 { return nil }
+func (m *metricRows) Begin() (driver.Tx, error)                    { return nil, driver.ErrSkip }
+
+func (m *metricRows) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &metricRowsIterator{metricRows: m}, nil
+}
+
+type metricRowsIterator struct {
+	*metricRows
+	next int
+}
+
+func (it *metricRowsIterator) Columns() []string { return it.columns }
+
+func (it *metricRowsIterator) Next(dest []driver.Value) error {
+	if it.next == len(it.rows) {
+		return io.EOF
+	}
+	copy(dest, it.rows[it.next])
+	it.next++
+	return nil
+}
+
+// record passes the rows to monitor.Record like a metric select would
+func record(t *testing.T, monitor *Monitor, columns []string, rows ...[]driver.Value) error {
+	db := sql.OpenDB(&metricRows{columns: columns, rows: rows})
+	defer db.Close()
+	sqlRows, err := db.Query("metric select")
+	require.NoError(t, err)
+	defer sqlRows.Close()
+	return monitor.Record(sqlRows)
+}
+
+func TestMonitor(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	monitor := NewMonitor(registry)
+	require.NoError(t, monitor.Counter("orders_processed_total", "Orders processed.", "region"))
+	require.NoError(t, monitor.Gauge("queue_length", "Length of the queue."))
+	require.NoError(t, monitor.Histogram("batch_size", "Size of the batches.", []float64{10, 100}))
+
+	columns := []string{"_metric", "labels", "value"}
+	require.NoError(t, record(t, monitor, columns,
+		[]driver.Value{"orders_processed_total", "region=eu", int64(42)},
+		[]driver.Value{"orders_processed_total", "region=eu", nil},
+	))
+	// NULL labels mean no labels
+	require.NoError(t, record(t, monitor, columns, []driver.Value{"queue_length", nil, 3.5}))
+	require.NoError(t, record(t, monitor, []string{"_metric", "value"},
+		[]driver.Value{"batch_size", int64(5)},
+		[]driver.Value{"batch_size", int64(50)},
+	))
+	assert.NoError(t, testutil.CollectAndCompare(registry, strings.NewReader(`
+# HELP batch_size Size of the batches.
+# TYPE batch_size histogram
+batch_size_bucket{le="10"} 1
+batch_size_bucket{le="100"} 2
+batch_size_bucket{le="+Inf"} 2
+batch_size_sum 55
+batch_size_count 2
+# HELP orders_processed_total Orders processed.
+# TYPE orders_processed_total counter
+orders_processed_total{region="eu"} 43
+# HELP queue_length Length of the queue.
+# TYPE queue_length gauge
+queue_length 3.5
+`)))
+
+	// NULL labels for a metric with labels lack the labels
+	assert.Error(t, record(t, monitor, columns, []driver.Value{"orders_processed_total", nil, int64(1)}))
+
+	err := record(t, monitor, columns, []driver.Value{"queue_length", nil, nil})
+	assert.EqualError(t, err, "metric 'queue_length': missing value")
+
+	err = record(t, monitor, columns, []driver.Value{"orders_processed_total", "region=eu", int64(-1)})
+	assert.EqualError(t, err, "metric 'orders_processed_total': counters can not decrease, got -1")
+
+	err = record(t, monitor, columns, []driver.Value{"orders_total", nil, int64(1)})
+	assert.EqualError(t, err, "metric 'orders_total': not declared; expected one of 'batch_size', 'orders_processed_total', 'queue_length'")
+
+	err = record(t, monitor, []string{"_metric", "unit"}, []driver.Value{"queue_length", "s"})
+	assert.EqualError(t, err, "unexpected column 'unit' in metric select, expected 'labels' and 'value'")
+
+	// declaring twice fails
+	assert.EqualError(t, monitor.Gauge("queue_length", "Length of the queue."), "metric 'queue_length' is already declared")
+}
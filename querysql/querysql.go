@@ -9,11 +9,154 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 var ErrNotDone = fmt.Errorf("there are more result sets after reading last expected result")
 var ErrNoMoreSets = fmt.Errorf("no more result sets")
+var ErrEmptyQuery = fmt.Errorf("the query is empty; it has nothing but whitespace and comments")
+var ErrConcurrentUse = fmt.Errorf("ResultSets used concurrently; Next, NextResult and Close must not be called while another call is in progress")
+
+// ResultSetError is returned when processing a given result set in the query fails,
+// e.g. when the dispatcher fails to call a function, or when scanning a row fails or a single
+// row was expected but not found in Next and NextResult. Unwrap gives the underlying error.
+// It is returned as a *ResultSetError.
+type ResultSetError struct {
+	// Index is the zero-based index of the failing result set within the query,
+	// counting all result sets including logging and dispatcher selects
+	Index int
+	Err   error
+}
+
+func (e *ResultSetError) Error() string {
+	return fmt.Sprintf("result set %d: %s", e.Index, e.Err.Error())
+}
+
+func (e *ResultSetError) Unwrap() error {
+	return e.Err
+}
+
+// maxQueryErrorLength is the maximum length of the SQL text included in QueryError
+const maxQueryErrorLength = 120
+
+// QueryError is returned in place of the errors of the driver when running the query or reading
+// its rows fails, to tell which query failed and how far it got. Unwrap gives the error of the
+// driver, so use errors.As rather than a type assertion to get at e.g. mssql.Error.
+// It is returned as a *QueryError; use WithoutQueryErrorContext to get the errors of the driver
+// unadorned.
+type QueryError struct {
+	// Query is the start of the SQL text, with whitespace collapsed into single spaces
+	Query string
+	// File is the name of the file the SQL text was read from, see SQL, or "" if unknown
+	File string
+	// NumArgs is the number of parameters passed with the query; their values are left out
+	NumArgs int
+	// ResultSetIndex is the zero-based index of the result set that was reached when the query
+	// failed, counting all result sets including logging and dispatcher selects
+	ResultSetIndex int
+	Err            error
+}
+
+func (e *QueryError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s (query %q from %s with %d parameters, at result set %d)", e.Err.Error(), e.Query, e.File, e.NumArgs, e.ResultSetIndex)
+	}
+	return fmt.Sprintf("%s (query %q with %d parameters, at result set %d)", e.Err.Error(), e.Query, e.NumArgs, e.ResultSetIndex)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// Is tells whether `target` is a QueryError for the same error of the driver. The query and the
+// result set tell where the error happened rather than what it is, so they are not compared.
+func (e *QueryError) Is(target error) bool {
+	t, ok := target.(*QueryError)
+	return ok && t != nil && t.Err != nil && wrapsError(e.Err, t.Err)
+}
+
+// resultSetError wraps `err` in a ResultSetError for the result set at `index`, unless it already
+// tells which result set failed. Errors of the context are returned as they are.
+func resultSetError(index int, err error) error {
+	var rsErr *ResultSetError
+	var qErr *QueryError
+	if err == nil || errors.As(err, &rsErr) || errors.As(err, &qErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &ResultSetError{Index: index, Err: err}
+}
+
+// queryError wraps `err` from the driver in a QueryError, unless disabled by
+// WithoutQueryErrorContext. Errors of the context are returned as they are.
+func (rs *ResultSets) queryError(err error) error {
+	if err == nil || rs.queryErr == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	qerr := *rs.queryErr
+	qerr.ResultSetIndex = rs.setIndex
+	qerr.Err = err
+	return &qerr
+}
+
+// PanicError is the value MustNext, MustNextResult, MustSingle and the other Must functions panic
+// with, to tell code recovering from the panic which query failed; use errors.As on the recovered
+// value to get at it. Error and Unwrap give the error the function would otherwise have returned.
+type PanicError struct {
+	// Query is the start of the SQL text as in QueryError; it is empty if disabled by
+	// WithoutQueryErrorContext
+	Query string
+	// ResultSetIndex is the index of the result set that failed, as in ResultSetError, or for
+	// errors not about a particular result set the index of the next result set to be read;
+	// it is -1 if not known
+	ResultSetIndex int
+	Err            error
+}
+
+func (e *PanicError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PanicError) Unwrap() error {
+	return e.Err
+}
+
+// newPanicError wraps `err` in a PanicError for `query`, taking the index of the result set
+// from `err` if it tells which result set failed, and `setIndex` otherwise
+func newPanicError(query string, setIndex int, err error) *PanicError {
+	var rsErr *ResultSetError
+	var qErr *QueryError
+	if errors.As(err, &rsErr) {
+		setIndex = rsErr.Index
+	} else if errors.As(err, &qErr) {
+		setIndex = qErr.ResultSetIndex
+	}
+	return &PanicError{Query: query, ResultSetIndex: setIndex, Err: err}
+}
+
+// panicError wraps `err` in a PanicError for the query of `rs`
+func (rs *ResultSets) panicError(err error) *PanicError {
+	var query string
+	if rs.queryErr != nil {
+		query = rs.queryErr.Query
+	}
+	return newPanicError(query, rs.setIndex, err)
+}
+
+// queryPanicError wraps `err` in a PanicError for `qry` run with `ctx`, for the Must functions
+// that do not get to the ResultSets
+func queryPanicError(ctx context.Context, qry string, err error) *PanicError {
+	var query string
+	if QueryErrorContext(ctx) {
+		query = trimQuery(qry, maxQueryErrorLength)
+	}
+	return newPanicError(query, -1, err)
+}
 
 type NotImplementedSqlResult struct{}
 
@@ -24,20 +167,58 @@ func (_ NotImplementedSqlResult) LastInsertId() (int64, error) {
 }
 
 func (_ NotImplementedSqlResult) RowsAffected() (int64, error) {
-	return 0, fmt.Errorf("LastInsertId not implemented")
+	return 0, fmt.Errorf("RowsAffected not implemented")
+}
+
+// SqlResult describes a result set read by NextWithSqlResult. database/sql does not expose the
+// number of rows affected by the statements of a query, so RowsAffected and LastInsertId
+// are not implemented.
+type SqlResult struct {
+	NotImplementedSqlResult
+	// Index is the index of the result set among all the result sets of the query, including
+	// logging and dispatcher selects
+	Index int
+	// RowsScanned is the number of rows read from the result set
+	RowsScanned int64
+}
+
+// ExecResult is the sql.Result returned by ExecContext
+type ExecResult struct {
+	NotImplementedSqlResult
+	// Sets describes each result set read, not including logging and dispatcher selects
+	Sets []SqlResult
 }
 
 // RowsLogger takes a sql.Rows and logs it. A default implementation is available, but
 // sometimes one might wish to improve on the formatting of different data types, hence
 // this low level interface is available.
 //
-// The convention is that the first column will always contain the log level.
+// The convention is that the first column will always contain the log level. ResultSets moves
+// the level column first if it is elsewhere in the log select.
 type RowsLogger func(rows *sql.Rows) error
 
+// RowsLoggerCtx is like RowsLogger, but is also passed the context given to New; e.g. to
+// correlate the logged entries with the trace of the request doing the query.
+type RowsLoggerCtx func(ctx context.Context, rows *sql.Rows) error
+
+// ToRowsLoggerCtx returns a RowsLoggerCtx that ignores the context and passes the rows to `logger`
+func ToRowsLoggerCtx(logger RowsLogger) RowsLoggerCtx {
+	if logger == nil {
+		return nil
+	}
+	return func(_ context.Context, rows *sql.Rows) error {
+		return logger(rows)
+	}
+}
+
 // RowsGoDispatcher takes a sql.Rows and calls a Go function.  The first argument,
 // __function is the function name, the other arguments are the arguments to the Go function.
 type RowsGoDispatcher func(rows *sql.Rows) error
 
+// RowsGoDispatcherCtx is like RowsGoDispatcher, but is also passed the context given to New,
+// e.g. to pass it on to the Go function
+type RowsGoDispatcherCtx func(ctx context.Context, rows *sql.Rows) error
+
 // ResultSets is a tiny wrapper around sql.Rows to help managing whether to call NextResultSet or not.
 // It is fine to instantiate this struct yourself.
 //
@@ -52,36 +233,174 @@ type ResultSets struct {
 	DoneAfterNext bool
 
 	// Logger is used for outputting select statements with the special log column (see README)
-	// By default it is set by New to the value provided by Logger(ctx), but feel free to set or change it.
+	// By default it is set by New to the value provided by Logger(ctx), or DefaultLogger() if there
+	// is none, but feel free to set or change it.
 	Logger RowsLogger
 
+	// LoggerCtx is like Logger, but is passed the context given to New. It is used instead of
+	// Logger if set. By default it is set by New to the value provided by LoggerCtx(ctx).
+	LoggerCtx RowsLoggerCtx
+
 	// TODO(dsf): Perhaps remove the LogKeyLowercase.  I'm not 100% this feature is justified
 	// By default, the use of an underscore column, "select _log=info, ...", will trigger logging
 	// This lets you specify a custom key such as "loglevel" for the same purpose in addition.
 	// It will be compared with the lowercase name of the column.
+	// By default it is set by New to the lowercase of LogKey(ctx).
 	LogKeyLowercase string
 
 	// "select _function=MyFunction" will attempt to fall a Go function (in this case MyFunction)
 	// with the remaining arguments to the select as arguments to the function call
 	Dispatcher RowsGoDispatcher
 
+	// DispatcherCtx is like Dispatcher, but is passed the context given to New. It is used instead
+	// of Dispatcher if set. By default it is set by New to the value provided by DispatcherCtx(ctx).
+	DispatcherCtx RowsGoDispatcherCtx
+
+	// Like LogKeyLowercase, but for the dispatcher: "select callback='MyFunction', ..." calls
+	// MyFunction if this is "callback". It is compared with the lowercase name of the first column.
+	// By default it is set by New to the lowercase of DispatchKey(ctx).
+	DispatchKeyLowercase string
+
+	// Monitor records the metrics of "select _metric='name', ..."; metric selects are discarded
+	// if it is nil. By default it is set by New to the value provided by Monitor(ctx).
+	Monitor RowsMonitor
+
+	// ctx is the context passed to New; it is checked for cancellation while scanning rows.
+	// It is nil if the struct was instantiated directly, in which case no checks are done.
+	ctx context.Context
+	// cancel is set if New derived ctx from a WithQueryTimeout context, and is called by Close
+	cancel context.CancelFunc
+	// setIndex is the zero-based index of the current result set in Rows, counting all sets
+	// including logging and dispatcher selects. Once Rows is exhausted it is the number of sets read.
+	setIndex int
+	// echo is set if the query is logged, see WithQueryEcho
+	echo *queryEcho
+	// timing is set if a summary of the query is logged, see WithTimingLogs
+	timing *queryTiming
+	// logTag is added to every logged entry, see WithQueryName
+	logTag *logTag
+	// redact tells which columns to redact in logged entries, see WithLogRedaction
+	redact func(column string) bool
+	// minLogLevel is the minimum level of rows to log, if set; see WithMinLogLevel
+	minLogLevel *logrus.Level
+	// logSampling is set to log only every logSampling'th row of log selects, see WithLogSampling
+	logSampling int
+	// warnDiscarded is set by New if no logger was found, see WarnDiscardedLogSelect
+	warnDiscarded bool
+	// progress receives the events of progress selects, see WithProgressLogger
+	progress ProgressLogger
+	// progressStart is when the first progress row was read
+	progressStart time.Time
+	// dispatchErrors are the errors of dispatcher selects that did not abort the query, see
+	// DispatchErrorContinue
+	dispatchErrors []error
+	// queryErr carries the query and the number of parameters into errors of the driver; it is
+	// nil if disabled, see QueryError
+	queryErr *QueryError
+	// messages queues the messages reported by the driver while the logger is set, see
+	// ForwardSQLMessages
+	messages *sqlMessages
+	// setName is the name given to the current result set by a preceding "select _set='name'"
+	setName string
+	// inUse detects concurrent or re-entrant use of the ResultSets, see enter
+	inUse   atomic.Bool
 	started bool
 }
 
+// ctxCheckInterval is the number of rows scanned between each check of whether
+// the context passed to New has been cancelled
+const ctxCheckInterval = 100
+
 // hook for tests
 var _closeHook = func(r io.Closer) error {
 	return r.Close()
 }
 
+// New executes the query and returns a ResultSets for reading the results. Errors are deferred
+// to the first call reading from the ResultSets. Instead of positional parameters, a single
+// map[string]any can be passed in `args` to pass its entries as named parameters.
+// To pass the query text as SQL, use NewSQL.
+//
+// Options in `args` are not passed to the query, but configure the ResultSets before the query
+// is started, taking precedence over the context:
+//
+//	rs := querysql.New(ctx, db, `select @p`, querysql.WithRowsLogger(nil), sql.Named("p", 1))
 func New(ctx context.Context, querier CtxQuerier, qry string, args ...any) *ResultSets {
-	rows, err := querier.QueryContext(ctx, qry, args...)
-	return &ResultSets{
-		Rows:       rows,
-		started:    false,
-		Err:        err, // important to return the error unadorned here, as some code e.g. casts it directly to mssql.Error
-		Logger:     Logger(ctx),
-		Dispatcher: Dispatcher(ctx),
+	return NewSQL(ctx, querier, SQLString(qry), args...)
+}
+
+// NewSQL is like New, but takes the query text as SQL, e.g. read from a file. An error reading
+// the text is deferred like the errors of the query.
+func NewSQL(ctx context.Context, querier CtxQuerier, sqlText SQL, args ...any) *ResultSets {
+	opts, args := splitOptions(args)
+	if sqlText.err != nil {
+		return &ResultSets{Err: sqlText.err, ctx: ctx}
+	}
+	// Do not spend a connection on a query that can only give ErrNoMoreSets
+	if err := sqlText.emptyErr(); err != nil {
+		return &ResultSets{Err: err, ctx: ctx}
+	}
+	args, err := expandArgs(args)
+	if err != nil {
+		return &ResultSets{Err: err, ctx: ctx}
+	}
+
+	var cancel context.CancelFunc
+	if timeout, ok := QueryTimeout(ctx); ok {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	rs := &ResultSets{
+		ctx:                  ctx,
+		started:              false,
+		Logger:               Logger(ctx),
+		LoggerCtx:            LoggerCtx(ctx),
+		LogKeyLowercase:      strings.ToLower(LogKey(ctx)),
+		Dispatcher:           Dispatcher(ctx),
+		DispatcherCtx:        DispatcherCtx(ctx),
+		DispatchKeyLowercase: strings.ToLower(DispatchKey(ctx)),
+		Monitor:              Monitor(ctx),
+		logTag:               newLogTag(ctx, sqlText.text),
+		redact:               LogRedaction(ctx),
+		logSampling:          LogSampling(ctx),
+		progress:             Progress(ctx),
+	}
+	if rs.Logger == nil {
+		rs.Logger = DefaultLogger()
+	}
+	rs.warnDiscarded = rs.Logger == nil && rs.LoggerCtx == nil
+	if level, ok := MinLogLevel(ctx); ok {
+		rs.minLogLevel = &level
+	}
+	rs.With(opts...)
+	if err := rs.startEcho(sqlText.describe(), args); err != nil {
+		rs.Err = err
+		if cancel != nil {
+			cancel()
+		}
+		return rs
+	}
+
+	start := time.Now()
+	rows, err := queryContext(rs.withSQLMessages(ctx), querier, sqlText.text, args...)
+	if err == nil && TimingLogs(ctx) {
+		rs.timing = newQueryTiming(start)
+	}
+	if err != nil {
+		// there is nothing to Close, so finish up here
+		if cancel != nil {
+			cancel()
+			cancel = nil
+		}
+		_ = rs.endEcho()
+	}
+	rs.Rows = rows
+	rs.cancel = cancel
+	if QueryErrorContext(ctx) {
+		rs.queryErr = &QueryError{Query: trimQuery(sqlText.text, maxQueryErrorLength), File: sqlText.name, NumArgs: len(args)}
 	}
+	// code casting the error directly to e.g. mssql.Error needs WithoutQueryErrorContext
+	rs.Err = rs.queryError(err)
+	return rs
 }
 
 // EnsureDoneAfterNext sets the DoneAfterNext flag. The receiver rs is returned for syntactical
@@ -91,68 +410,376 @@ func (rs *ResultSets) EnsureDoneAfterNext() *ResultSets {
 	return rs
 }
 
+// Close closes `rs`. It is safe to call Close several times, but not while
+// another call to Next, NextResult or Close is in progress on `rs`.
 func (rs *ResultSets) Close() error {
+	if !rs.enter() {
+		return ErrConcurrentUse
+	}
+	defer rs.leave()
+	return rs.close()
+}
+
+// enter marks `rs` as in use, and returns false if it already was; i.e. if another goroutine,
+// or a callback further up the stack, is using it. Each successful enter must be followed by leave.
+func (rs *ResultSets) enter() bool {
+	return rs.inUse.CompareAndSwap(false, true)
+}
+
+func (rs *ResultSets) leave() {
+	rs.inUse.Store(false)
+}
+
+func (rs *ResultSets) close() error {
+	if rs.cancel != nil {
+		// cancel after the rows are closed below
+		defer rs.cancel()
+		rs.cancel = nil
+	}
 	rows := rs.Rows
 	rs.Rows = nil
+	var err error
 	if rows != nil {
-		return _closeHook(rows)
+		err = _closeHook(rows)
 	}
-	return nil
+	if echoErr := rs.endEcho(); err == nil {
+		err = echoErr
+	}
+	if messagesErr := rs.logSQLMessages(); err == nil {
+		err = messagesErr
+	}
+	if timingErr := rs.endTiming(); err == nil {
+		err = timingErr
+	}
+	return err
+}
+
+// logDispatchResults logs the return values of the function `fname` called by a dispatcher select
+func (rs *ResultSets) logDispatchResults(fname string, results []any) error {
+	columns := make([]string, 0, len(results)+1)
+	columns = append(columns, "function")
+	for i := range results {
+		columns = append(columns, fmt.Sprintf("result_%d", i))
+	}
+	return rs.logEntry("debug", columns, append([]any{fname}, results...))
+}
+
+// logEntry sends a single entry generated by querysql itself, rather than by a log select,
+// to the logger. The entry follows the same protocol as a log select, with `level` as the
+// first column followed by `columns`.
+func (rs *ResultSets) logEntry(level string, columns []string, values []any) error {
+	if rs.Logger == nil && rs.LoggerCtx == nil {
+		return nil
+	}
+	rows, err := newLogEntrySet(level, columns, values).Rows()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	if err = rs.logger()(rows); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// sink returns rs.LoggerCtx bound to the context passed to New if set, and rs.Logger otherwise
+func (rs *ResultSets) sink() RowsLogger {
+	if rs.LoggerCtx == nil {
+		return rs.Logger
+	}
+	ctx := rs.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return func(rows *sql.Rows) error {
+		return rs.LoggerCtx(ctx, rows)
+	}
+}
+
+// logger returns the logger given by sink, wrapped to filter rows by level, redact columns and
+// add the query tag if configured
+func (rs *ResultSets) logger() RowsLogger {
+	sink := rs.sink()
+	if sink == nil || (rs.logTag == nil && rs.redact == nil && rs.minLogLevel == nil && rs.logSampling <= 1) {
+		return sink
+	}
+	return func(rows *sql.Rows) error {
+		set, err := rs.readSet(rows)
+		if err != nil {
+			return err
+		}
+		if rs.minLogLevel != nil {
+			var emit bool
+			if set, emit = filterByLevel(set, *rs.minLogLevel); !emit {
+				return nil
+			}
+		}
+		var suppressed int
+		var columns []string
+		if rs.logSampling > 1 {
+			columns = set.columns[1:]
+			set, suppressed = sampleSet(set, rs.logSampling)
+		}
+		info := &logSetInfo{minLevel: rs.minLogLevel}
+		if rs.redact != nil {
+			set, info.redacted = redactSet(set, rs.redact)
+		}
+		if rs.logTag != nil {
+			var tagged bool
+			if set, tagged = rs.logTag.addTo(set); tagged {
+				info.tag = rs.logTag
+			}
+		}
+		if err = replayToLogger(set, info, sink); err != nil || suppressed == 0 {
+			return err
+		}
+		return rs.logEntry("warning",
+			[]string{"event", "suppressed", "columns"},
+			[]any{"log.sampled", suppressed, strings.Join(columns, ",")},
+		)
+	}
+}
+
+// ctxErr returns the error of the context passed to New, if it has been cancelled
+func (rs *ResultSets) ctxErr() error {
+	if rs.ctx == nil {
+		return nil
+	}
+	return rs.ctx.Err()
+}
+
+// readSet reads the remaining rows of the current result set of `rows` into memory, checking
+// the context passed to New every ctxCheckInterval rows
+func (rs *ResultSets) readSet(rows *sql.Rows) (*bufferedSet, error) {
+	if rs.ctx == nil {
+		return readBufferedSet(rows)
+	}
+	return readBufferedSetCtx(rs.ctx, rows)
 }
 
 func (rs *ResultSets) hasLogColumn(cols []string) bool {
-	return len(cols) > 0 && cols[0] == "_log" || (rs.LogKeyLowercase != "" && strings.ToLower(cols[0]) == rs.LogKeyLowercase)
+	return rs.logColumnIndex(cols) != -1
+}
+
+// logColumnIndex returns the index of the log level column in `cols`, or -1 if there is none.
+// The level column may be in any position, unless the first column is another special column
+// such as `_function`.
+func (rs *ResultSets) logColumnIndex(cols []string) int {
+	for i, col := range cols {
+		if col == "_log" || (rs.LogKeyLowercase != "" && strings.ToLower(col) == rs.LogKeyLowercase) {
+			return i
+		}
+		if i == 0 && strings.HasPrefix(col, "_") {
+			return -1
+		}
+	}
+	return -1
+}
+
+// WarnDiscardedLogSelect is called the first time in the process that a log select is discarded
+// because neither the context nor SetDefaultLogger provided a RowsLogger, with the columns of
+// the select. By default it prints a notice with the standard library log package. Set it to
+// nil before doing any queries to disable the notice. Log selects silenced by
+// ResultSets.WithLogger(nil) are not reported.
+var WarnDiscardedLogSelect = func(columns []string) {
+	log.Printf("querysql: discarded a log select with columns %v since no RowsLogger is configured, see querysql.WithLogger; further log selects are discarded without notice", columns)
 }
 
+var discardedLogSelectWarned atomic.Bool
+
 func (rs *ResultSets) processLogSelect() error {
-	if rs.Logger == nil {
+	if rs.Logger == nil && rs.LoggerCtx == nil {
+		if rs.warnDiscarded && WarnDiscardedLogSelect != nil && discardedLogSelectWarned.CompareAndSwap(false, true) {
+			cols, err := rs.Rows.Columns()
+			if err != nil {
+				return err
+			}
+			WarnDiscardedLogSelect(cols)
+		}
 		// Just exhaust Rows...not an error to attempt logging to /dev/null
-		for rs.Rows.Next() {
+		for n := 0; rs.Rows.Next(); n++ {
+			if n%ctxCheckInterval == 0 {
+				if err := rs.ctxErr(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := rs.ctxErr(); err != nil {
+			return err
 		}
 		return rs.Rows.Err()
 	}
 
-	if err := rs.Logger(rs.Rows); err != nil {
+	if err := rs.ctxErr(); err != nil {
+		return err
+	}
+
+	cols, err := rs.Rows.Columns()
+	if err != nil {
+		return err
+	}
+	logger := rs.logger()
+	if i := rs.logColumnIndex(cols); i > 0 {
+		// By protocol of RowsLogger the level is the first column
+		levelLogger := logger
+		logger = func(rows *sql.Rows) error {
+			set, err := rs.readSet(rows)
+			if err != nil {
+				return err
+			}
+			return replayToLogger(moveColumnFirst(set, i), nil, levelLogger)
+		}
+	}
+	if err := logger(rs.Rows); err != nil {
+		return &ResultSetError{Index: rs.setIndex, Err: fmt.Errorf("log select with columns %v: %w", cols, err)}
+	}
+	// The RowsLogger does not know the context; if it was cancelled while logging, the rows
+	// were closed under it, so do not go on as if the select was logged
+	if err := rs.ctxErr(); err != nil {
 		return err
 	}
 	// a well-written RowsLogger would return rs.Rows.Err(), but just be certain this isn't overlooked...
 	return rs.Rows.Err()
 }
 
+func (rs *ResultSets) hasSetNameColumn(cols []string) bool {
+	return len(cols) == 1 && cols[0] == "_set"
+}
+
+// processSetNameSelect reads the name from a "select _set='name'", which names the following result set
+func (rs *ResultSets) processSetNameSelect() error {
+	var name string
+	n := 0
+	for rs.Rows.Next() {
+		if err := rs.Rows.Scan(&name); err != nil {
+			return &ResultSetError{Index: rs.setIndex, Err: fmt.Errorf("could not read _set name: %w", err)}
+		}
+		n++
+	}
+	if err := rs.Rows.Err(); err != nil {
+		return err
+	}
+	if n != 1 {
+		return &ResultSetError{Index: rs.setIndex, Err: fmt.Errorf("a _set select must have exactly one row, got %d", n)}
+	}
+	rs.setName = name
+	return nil
+}
+
+// dispatchAndLogColumns returns the indices of the dispatch key column and of the log key column
+// in `cols`, or -1. Unlike hasDispatcherColumn and hasLogColumn it looks for `_function` and the
+// log keys in any column, so that a select meant both for dispatching and for logging is not
+// silently taken as one of them.
+func (rs *ResultSets) dispatchAndLogColumns(cols []string) (dispatchCol, logCol int) {
+	dispatchCol, logCol = -1, -1
+	if rs.hasDispatcherColumn(cols) {
+		dispatchCol = 0
+	}
+	for i, col := range cols {
+		if dispatchCol == -1 && col == "_function" {
+			dispatchCol = i
+		}
+		if logCol == -1 && (col == "_log" || (rs.LogKeyLowercase != "" && strings.ToLower(col) == rs.LogKeyLowercase)) {
+			logCol = i
+		}
+	}
+	return dispatchCol, logCol
+}
+
 func (rs *ResultSets) hasDispatcherColumn(cols []string) bool {
-	return len(cols) > 0 && cols[0] == "_function"
+	return len(cols) > 0 && (cols[0] == "_function" || (rs.DispatchKeyLowercase != "" && strings.ToLower(cols[0]) == rs.DispatchKeyLowercase))
 }
 
 func (rs *ResultSets) processDispatcherSelect() error {
-	if rs.Dispatcher == nil {
-		return fmt.Errorf("missing dispatcher")
+	if rs.Dispatcher == nil && rs.DispatcherCtx == nil {
+		return &ResultSetError{Index: rs.setIndex, Err: fmt.Errorf("missing dispatcher")}
 	}
 
-	if err := rs.Dispatcher(rs.Rows); err != nil {
+	if err := rs.ctxErr(); err != nil {
 		return err
 	}
+
+	// the dispatcher may move on to a payload result set
+	index := rs.setIndex
+	var err error
+	if rs.DispatcherCtx != nil {
+		ctx := rs.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		// for logging the return values and reading the payloads of the functions of DispatcherFuncs
+		ctx = context.WithValue(ctx, ckDispatchResultLogger, rs.logDispatchResults)
+		ctx = context.WithValue(ctx, ckDispatchPayload, rs.nextPayloadSet)
+		err = rs.DispatcherCtx(ctx, rs.Rows)
+	} else {
+		err = rs.Dispatcher(rs.Rows)
+	}
+	var continued continuedError
+	if errors.As(err, &continued) {
+		err = &ResultSetError{Index: index, Err: continued.err}
+		rs.dispatchErrors = append(rs.dispatchErrors, err)
+		// the rest of the rows are skipped by nextResultSet
+		return rs.logEntry("error", []string{"event", "error"}, []any{"dispatch_error", err.Error()})
+	}
+	if err != nil {
+		return &ResultSetError{Index: index, Err: err}
+	}
 	// a well-written dispatchers would return rs.Rows.Err(), but just be certain this isn't overlooked...
 	return rs.Rows.Err()
 }
 
+// nextPayloadSet moves on to the payload result set after a dispatcher select calling a function
+// taking a payload, see DispatcherFuncs
+func (rs *ResultSets) nextPayloadSet() (*sql.Rows, error) {
+	if rs.Rows.Next() {
+		return nil, fmt.Errorf("a select calling a function taking a payload result set must have a single row")
+	}
+	if err := rs.Rows.Err(); err != nil {
+		return nil, err
+	}
+	if !rs.Rows.NextResultSet() {
+		// A cancelled context also makes NextResultSet return false, see nextResultSet
+		if err := rs.ctxErr(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("missing payload result set")
+	}
+	rs.setIndex++
+	if rs.timing != nil {
+		rs.timing.endSet()
+		rs.timing.startSet()
+	}
+	return rs.Rows, nil
+}
+
+// DispatchErrors returns the errors of the dispatcher selects read so far that did not abort the
+// query since the DispatcherFuncs was configured with DispatchErrorContinue, joined by
+// errors.Join, or nil if there were none
+func (rs *ResultSets) DispatchErrors() error {
+	return errors.Join(rs.dispatchErrors...)
+}
+
 // NextResult reads the next result set from `rs`, into the type/scanner provided in the `typ`
 // argument. Typical arguments for `typ` is `SliceOf[int]`, `SingleOf[MyStruct]`,
 // `Call[MyStruct](func(MyStruct) error { ... })`
 func NextResult[T any](rs *ResultSets, typ func() Result[T]) (T, error) {
-	result := typ()
 	var zero T
-	if err := Next(rs, result); err != nil {
+	if !rs.enter() {
+		return zero, ErrConcurrentUse
+	}
+	defer rs.leave()
+
+	result := typ()
+	sqlResult, err := nextWithSqlResult(rs, result)
+	if err != nil {
 		return zero, err
 	}
 
-	// The Next() above can return nil but still set rs.Err
-	// If that's the case, Result() will return empty results for
-	// iterScanner and sliceScanner and no errors.
-	// When it comes to singleScanner, it returns
-	// the ErrZeroRowsExpectedOne wrapped around the underlying error (rs.Err)
+	// The result set was read completely; for singleScanner, Result() returns
+	// ZeroRowsExpectedOne wrapped around sql.ErrNoRows if there were no rows
 	v, errFunc := result.Result()
 	if errFunc != nil {
-		return zero, errFunc(rs.Err)
+		return zero, resultSetError(sqlResult.Index, errFunc(nil))
 	}
 	return v, nil
 }
@@ -160,13 +787,20 @@ func NextResult[T any](rs *ResultSets, typ func() Result[T]) (T, error) {
 func MustNextResult[T any](rs *ResultSets, typ func() Result[T]) T {
 	result, err := NextResult(rs, typ)
 	if err != nil {
-		panic(err)
+		panic(rs.panicError(err))
 	}
 	return result
 }
 
 func (rs *ResultSets) processAllSpecialSelects() (hadColumns bool, err error) {
 	for !rs.Done() {
+		if err = rs.ctxErr(); err != nil {
+			return false, err
+		}
+		// Log the messages printed before the select, so that they come in order with log selects
+		if err = rs.logSQLMessages(); err != nil {
+			return false, err
+		}
 		var cols []string
 		cols, err = rs.Rows.Columns()
 		if err != nil {
@@ -177,6 +811,9 @@ func (rs *ResultSets) processAllSpecialSelects() (hadColumns bool, err error) {
 			return false, nil
 		}
 
+		if dispatchCol, logCol := rs.dispatchAndLogColumns(cols); dispatchCol != -1 && logCol != -1 {
+			return false, &ResultSetError{Index: rs.setIndex, Err: fmt.Errorf("select has both the dispatch key column '%s' and the log key column '%s'; use separate selects for dispatching and logging", cols[dispatchCol], cols[logCol])}
+		}
 		if rs.hasLogColumn(cols) {
 			if err = rs.processLogSelect(); err != nil {
 				return false, err
@@ -191,6 +828,27 @@ func (rs *ResultSets) processAllSpecialSelects() (hadColumns bool, err error) {
 			if err = rs.nextResultSet(); err != nil {
 				return false, err
 			}
+		} else if rs.hasProgressColumn(cols) {
+			if err = rs.processProgressSelect(); err != nil {
+				return false, err
+			}
+			if err = rs.nextResultSet(); err != nil {
+				return false, err
+			}
+		} else if rs.hasMetricColumn(cols) {
+			if err = rs.processMetricSelect(); err != nil {
+				return false, err
+			}
+			if err = rs.nextResultSet(); err != nil {
+				return false, err
+			}
+		} else if rs.hasSetNameColumn(cols) {
+			if err = rs.processSetNameSelect(); err != nil {
+				return false, err
+			}
+			if err = rs.nextResultSet(); err != nil {
+				return false, err
+			}
 		} else {
 			// non-logging select; return
 			return true, nil
@@ -203,100 +861,226 @@ func (rs *ResultSets) Done() bool {
 	return rs.Rows == nil
 }
 
+// ResultSetIndex returns the zero-based index of the result set to be read next, counting all
+// result sets including logging and dispatcher selects; it is the index given in ResultSetError.
+// Once all result sets have been read, it is the number of result sets in the query.
+func (rs *ResultSets) ResultSetIndex() int {
+	return rs.setIndex
+}
+
 func (rs *ResultSets) nextResultSet() error {
+	rs.setIndex++
+	if rs.timing != nil {
+		rs.timing.endSet()
+	}
 	if rs.Rows.NextResultSet() {
+		if rs.timing != nil {
+			rs.timing.startSet()
+		}
 		return nil
 	} else {
+		// A cancelled context also makes NextResultSet return false; that is not the end of the results
+		if err := rs.ctxErr(); err != nil {
+			_ = rs.close()
+			return err
+		}
 		// we have exhausted the results; automatically close Rows; this also ensures Done() returns true
-		return rs.Close()
+		return rs.close()
 	}
 }
 
-func NextNoScanner(rs *ResultSets) error {
+// start processes the special selects before the first result set, the first time it is called.
+// After that, `rs` is always positioned at the next result set to be read, or is Done.
+func (rs *ResultSets) start() error {
+	if rs.started {
+		return nil
+	}
+	hadColumns, err := rs.processAllSpecialSelects()
+	if err != nil {
+		_ = rs.close()
+		return err
+	}
+	if !hadColumns {
+		// the *sql.Rows interface typically treats a 'select' with 0 rows and the lack of a select
+		// very similar; but there is a slight difference in whether Columns() is available or not
+		// We make use of this to give a consistent API where you always get ErrNoMoreSets if a `select`
+		// statement is missing
+		_ = rs.close()
+		return ErrNoMoreSets
+	}
+	rs.started = true
+	return nil
+}
+
+// Columns returns the column names of the next result set without reading any of its rows,
+// so that the Target to read it with can be chosen based on them. Logging and dispatcher
+// selects before the result set are processed. ErrNoMoreSets is returned if there are no
+// more result sets.
+func (rs *ResultSets) Columns() ([]string, error) {
+	if !rs.enter() {
+		return nil, ErrConcurrentUse
+	}
+	defer rs.leave()
+
+	if rs.Err != nil {
+		return nil, rs.Err
+	}
+	if err := rs.start(); err != nil {
+		return nil, err
+	}
+	if rs.Done() {
+		return nil, ErrNoMoreSets
+	}
+	return rs.Rows.Columns()
+}
+
+// Drain advances past the next result set without scanning its rows. Logging and
+// dispatcher selects before and after it are processed as usual. ErrNoMoreSets
+// is returned if there are no more result sets.
+func Drain(rs *ResultSets) error {
 	return Next(rs, nil)
 }
 
+// DrainAll drains all the remaining result sets of `rs`, processing any logging
+// and dispatcher selects on the way. It returns nil once `rs` is exhausted.
+func DrainAll(rs *ResultSets) error {
+	for {
+		err := Drain(rs)
+		if err == ErrNoMoreSets {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// NextNoScanner is the same as Drain
+func NextNoScanner(rs *ResultSets) error {
+	return Drain(rs)
+}
+
 // Next reads the next result set from `rs`, passing each row to `scanner`;
 // taking care of checking errors and advancing result sets. On errors, `rs`
 // will be closed. If EnsureDoneAfterNext is used, `rs` will also be closed on successful return.
 func Next(rs *ResultSets, scanner Target) error {
+	if !rs.enter() {
+		return ErrConcurrentUse
+	}
+	defer rs.leave()
+	return next(rs, scanner)
+}
+
+// NextWithSqlResult is like Next, but also returns a description of the result set read
+func NextWithSqlResult(rs *ResultSets, scanner Target) (SqlResult, error) {
+	if !rs.enter() {
+		return SqlResult{}, ErrConcurrentUse
+	}
+	defer rs.leave()
+	return nextWithSqlResult(rs, scanner)
+}
+
+func next(rs *ResultSets, scanner Target) error {
+	_, err := nextWithSqlResult(rs, scanner)
+	return err
+}
+
+func nextWithSqlResult(rs *ResultSets, scanner Target) (SqlResult, error) {
 	if rs.Err != nil {
-		return rs.Err
+		return SqlResult{}, rs.Err
 	}
 
 	if rs.Done() {
 		// No need to `defer closeRS()`, already closed
-		return ErrNoMoreSets
+		return SqlResult{}, ErrNoMoreSets
 	}
 
-	if !rs.started {
-		hadColumns, err := rs.processAllSpecialSelects()
-		if err != nil {
-			defer func() { _ = rs.Close() }()
-			return err
-		}
-		if !hadColumns {
-			// the *sql.Rows interface typically treats a 'select' with 0 rows and the lack of a select
-			// very similar; but there is a slight difference in whether Columns() is available or not
-			// We make use of this to give a consistent API where you always get ErrNoMoreSets if a `select`
-			// statement is missing
-			defer func() { _ = rs.Close() }()
-			return ErrNoMoreSets
-		}
-		rs.started = true
+	if err := rs.start(); err != nil {
+		return SqlResult{}, err
+	}
+	if rs.Done() {
+		// No need to `defer closeRS()`, already closed
+		return SqlResult{}, ErrNoMoreSets
+	}
 
-		if rs.Done() {
-			// No need to `defer closeRS()`, already closed
-			return ErrNoMoreSets
+	result := SqlResult{Index: rs.setIndex}
+	if bound, ok := scanner.(boundTarget); ok {
+		if err := bound.bind(rs, rs.setIndex); err != nil {
+			defer func() { _ = rs.close() }()
+			return result, resultSetError(result.Index, err)
 		}
 	}
-
-	for rs.Rows.Next() {
+	for ; rs.Rows.Next(); result.RowsScanned++ {
+		if result.RowsScanned%ctxCheckInterval == 0 {
+			if err := rs.ctxErr(); err != nil {
+				defer func() { _ = rs.close() }()
+				return result, err
+			}
+		}
 		if scanner != nil {
 			if err := scanner.ScanRow(rs.Rows); err != nil {
-				defer func() { _ = rs.Close() }()
-				return err
+				defer func() { _ = rs.close() }()
+				return result, resultSetError(result.Index, err)
 			}
 		}
 	}
 
+	// The name from a _set select only applies to this result set
+	rs.setName = ""
+	if rs.timing != nil {
+		rs.timing.rows += result.RowsScanned
+	}
+
+	// A cancelled context makes database/sql close the rows, which ends the loop above early;
+	// make sure that is reported as the context error and not as a completed result set
+	if err := rs.ctxErr(); err != nil {
+		defer func() { _ = rs.close() }()
+		return result, err
+	}
+
+	// An error ending the result set early, e.g. a throw, must not make the rows read so far
+	// look like a complete result set
 	if err := rs.Rows.Err(); err != nil {
-		defer func() { _ = rs.Close() }()
-		// If we return the error here, we'll miss processing the result sets up to this point
-		// Instead of returning the error, we set rs.Err so that next call to Next will return the error
-		rs.Err = err
-		return nil
+		defer func() { _ = rs.close() }()
+		return result, rs.queryError(err)
+	}
+
+	// The error of a Target reporting on the complete result set is returned after advancing
+	// to the next result set, as the result set was read
+	var endErr error
+	if ender, ok := scanner.(setEnder); ok {
+		endErr = resultSetError(result.Index, ender.endSet())
 	}
 
 	if err := rs.nextResultSet(); err != nil {
-		defer func() { _ = rs.Close() }()
-		return err
+		defer func() { _ = rs.close() }()
+		return result, err
 	}
 
 	if _, err := rs.processAllSpecialSelects(); err != nil {
-		return err
+		defer func() { _ = rs.close() }()
+		return result, err
 	}
 
 	if rs.DoneAfterNext {
 		if !rs.Done() {
-			_ = rs.Close()
-			return ErrNotDone
+			_ = rs.close()
+			return result, ErrNotDone
 		}
 	}
 
-	return nil
+	return result, endErr
 }
 
 func MustNext(rs *ResultSets, scanner Target) {
 	err := Next(rs, scanner)
 	if err != nil {
-		panic(err)
+		panic(rs.panicError(err))
 	}
 }
 
-func must[T any](val T, err error) T {
+func must[T any](rs *ResultSets, val T, err error) T {
 	if err != nil {
-		panic(err)
+		panic(rs.panicError(err))
 	}
 	return val
 }
@@ -309,8 +1093,15 @@ func Single[T any](ctx context.Context, querier CtxQuerier, qry string, args ...
 	return NextResult[T](New(ctx, querier, qry, args...).EnsureDoneAfterNext(), SingleOf[T])
 }
 
+// SingleSQL is like Single, but takes the query text as SQL
+func SingleSQL[T any](ctx context.Context, querier CtxQuerier, qry SQL, args ...any) (T, error) {
+	return NextResult[T](NewSQL(ctx, querier, qry, args...).EnsureDoneAfterNext(), SingleOf[T])
+}
+
 func MustSingle[T any](ctx context.Context, querier CtxQuerier, qry string, args ...any) T {
-	return must(Single[T](ctx, querier, qry, args...))
+	rs := New(ctx, querier, qry, args...).EnsureDoneAfterNext()
+	v, err := NextResult(rs, SingleOf[T])
+	return must(rs, v, err)
 }
 
 func SingleOrNil[T any](ctx context.Context, querier CtxQuerier, qry string, args ...any) (*T, error) {
@@ -325,8 +1116,15 @@ func Slice[T any](ctx context.Context, querier CtxQuerier, qry string, args ...a
 	return NextResult(New(ctx, querier, qry, args...).EnsureDoneAfterNext(), SliceOf[T])
 }
 
+// SliceSQL is like Slice, but takes the query text as SQL
+func SliceSQL[T any](ctx context.Context, querier CtxQuerier, qry SQL, args ...any) ([]T, error) {
+	return NextResult(NewSQL(ctx, querier, qry, args...).EnsureDoneAfterNext(), SliceOf[T])
+}
+
 func MustSlice[T any](ctx context.Context, querier CtxQuerier, qry string, args ...any) []T {
-	return must(Slice[T](ctx, querier, qry, args...))
+	rs := New(ctx, querier, qry, args...).EnsureDoneAfterNext()
+	v, err := NextResult(rs, SliceOf[T])
+	return must(rs, v, err)
 }
 
 func Iter[T any](ctx context.Context, querier CtxQuerier, visit func(T) error, qry string, args ...any) error {
@@ -335,8 +1133,9 @@ func Iter[T any](ctx context.Context, querier CtxQuerier, visit func(T) error, q
 }
 
 func MustIter[T any](ctx context.Context, querier CtxQuerier, visit func(T) error, qry string, args ...any) {
-	if err := Iter[T](ctx, querier, visit, qry, args...); err != nil {
-		panic(err)
+	rs := New(ctx, querier, qry, args...).EnsureDoneAfterNext()
+	if _, err := NextResult(rs, Call(visit)); err != nil {
+		panic(rs.panicError(err))
 	}
 }
 
@@ -367,6 +1166,105 @@ func Query(
 	return nil
 }
 
+// Walk executes the query and scans only the result sets whose (zero-based) index is
+// a key in `handlers`, into the corresponding Target. All other result sets are drained.
+// Logging and dispatcher selects are processed as usual and are not counted.
+// An error is returned if `handlers` has keys for result sets that were never seen.
+func Walk(
+	ctx context.Context,
+	querier CtxQuerier,
+	qry string,
+	handlers map[int]Target,
+	args ...any,
+) error {
+	rs := New(ctx, querier, qry, args...)
+	defer func() { _ = rs.Close() }()
+
+	seen := 0
+	for {
+		err := Next(rs, handlers[seen])
+		if err == ErrNoMoreSets {
+			break
+		} else if err != nil {
+			return err
+		}
+		seen++
+	}
+
+	var outOfRange []int
+	for index := range handlers {
+		if index < 0 || index >= seen {
+			outOfRange = append(outOfRange, index)
+		}
+	}
+	if len(outOfRange) > 0 {
+		sort.Ints(outOfRange)
+		return fmt.Errorf("no result sets with index %v, the highest result set index seen was %d", outOfRange, seen-1)
+	}
+	return nil
+}
+
+// NamedResults executes the query and scans each result set that has been named by a
+// preceding "select _set='name'" into the Target with that name in `targets`. Unnamed result
+// sets are drained. An error is returned if the query names a result set that is not in
+// `targets`, or if a Target in `targets` did not get a result set.
+func NamedResults(
+	ctx context.Context,
+	querier CtxQuerier,
+	qry string,
+	targets map[string]Target,
+	args ...any,
+) error {
+	rs := New(ctx, querier, qry, args...)
+	defer func() { _ = rs.Close() }()
+
+	seen := map[string]bool{}
+	for {
+		// Process the special selects up to the next result set, to find its name
+		if err := rs.start(); err != nil && err != ErrNoMoreSets {
+			return err
+		}
+
+		var target Target
+		if name := rs.setName; name != "" && !rs.Done() {
+			var ok bool
+			if target, ok = targets[name]; !ok {
+				return fmt.Errorf("unknown result set name '%s'. Expected one of %s", name, quotedNames(targets))
+			}
+			seen[name] = true
+		}
+
+		err := Next(rs, target)
+		if err == ErrNoMoreSets {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var missing []string
+	for name := range targets {
+		if !seen[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("no result sets named %v", missing)
+	}
+	return nil
+}
+
+// quotedNames returns the sorted keys of `m` as a string like "'a', 'b'"
+func quotedNames[T any](m map[string]T) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, fmt.Sprintf("'%s'", name))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
 func Query2[T1 any, T2 any](
 	type1 func() Result[T1],
 	type2 func() Result[T2],
@@ -495,25 +1393,124 @@ func Query4[T1 any, T2 any, T3 any, T4 any](
 	return t1, t2, t3, t4, nil
 }
 
+func MustQuery2[T1 any, T2 any](
+	type1 func() Result[T1],
+	type2 func() Result[T2],
+	ctx context.Context,
+	querier CtxQuerier,
+	qry string,
+	args ...any,
+) (T1, T2) {
+	t1, t2, err := Query2(type1, type2, ctx, querier, qry, args...)
+	if err != nil {
+		panic(queryPanicError(ctx, qry, err))
+	}
+	return t1, t2
+}
+
+func MustQuery3[T1 any, T2 any, T3 any](
+	type1 func() Result[T1],
+	type2 func() Result[T2],
+	type3 func() Result[T3],
+	ctx context.Context,
+	querier CtxQuerier,
+	qry string,
+	args ...any,
+) (T1, T2, T3) {
+	t1, t2, t3, err := Query3(type1, type2, type3, ctx, querier, qry, args...)
+	if err != nil {
+		panic(queryPanicError(ctx, qry, err))
+	}
+	return t1, t2, t3
+}
+
+func MustQuery4[T1 any, T2 any, T3 any, T4 any](
+	type1 func() Result[T1],
+	type2 func() Result[T2],
+	type3 func() Result[T3],
+	type4 func() Result[T4],
+	ctx context.Context,
+	querier CtxQuerier,
+	qry string,
+	args ...any,
+) (T1, T2, T3, T4) {
+	t1, t2, t3, t4, err := Query4(type1, type2, type3, type4, ctx, querier, qry, args...)
+	if err != nil {
+		panic(queryPanicError(ctx, qry, err))
+	}
+	return t1, t2, t3, t4
+}
+
+// ExecContext executes all of the query, reading and discarding the result sets. The errors of
+// dispatcher selects that did not abort the query, see DispatchErrorContinue, are returned
+// together with the result once the query is done.
 func ExecContext(
 	ctx context.Context,
 	querier CtxQuerier,
 	qry string,
 	args ...any,
 ) (sql.Result, error) {
-	rs := New(ctx, querier, qry, args...)
-	var err error
+	return ExecContextSQL(ctx, querier, SQLString(qry), args...)
+}
+
+// ExecContextSQL is like ExecContext, but takes the query text as SQL
+func ExecContextSQL(ctx context.Context, querier CtxQuerier, qry SQL, args ...any) (sql.Result, error) {
+	rs := NewSQL(ctx, querier, qry, args...)
+	var result ExecResult
+	for {
+		setResult, err := NextWithSqlResult(rs, nil)
+		if err == ErrNoMoreSets {
+			return result, rs.DispatchErrors()
+		} else if err != nil {
+			return nil, err
+		}
+		result.Sets = append(result.Sets, setResult)
+	}
+}
 
+// ExecReturning executes all of the query like ExecContext, and returns the rows of the last
+// result set that is not a logging or dispatcher select. This is useful for scripts that end
+// by selecting the rows they changed, e.g. with `output inserted.*`. The result sets before
+// the last one are read and discarded. ErrNoMoreSets is returned if there are no such result sets.
+// Like ExecContext, it returns the errors of dispatcher selects that did not abort the query,
+// see DispatchErrors, together with the rows.
+func ExecReturning[T any](ctx context.Context, querier CtxQuerier, qry string, args ...any) ([]T, error) {
+	rs := New(ctx, querier, qry, args...)
+	var last *bufferedSet
 	for {
-		err = NextNoScanner(rs)
+		_, err := rs.Columns()
+		if err == ErrNoMoreSets {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		// Keep the set in memory, as we do not know if it is the last one until we have advanced past it
+		set, err := newBufferedSet(rs.Rows)
 		if err != nil {
-			if err == ErrNoMoreSets {
-				return NotImplementedSqlResult{}, nil
-			}
+			_ = rs.Close()
 			return nil, err
 		}
+		if err = Next(rs, set); err != nil {
+			return nil, err
+		}
+		last = set
+	}
+	if last == nil {
+		if err := rs.DispatchErrors(); err != nil {
+			return nil, errors.Join(ErrNoMoreSets, err)
+		}
+		return nil, ErrNoMoreSets
+	}
+
+	rows, err := last.Rows()
+	if err != nil {
+		return nil, err
+	}
+	result, err := NextResult(&ResultSets{ctx: ctx, Rows: rows}, SliceOf[T])
+	if err != nil {
+		return nil, err
 	}
-	return NotImplementedSqlResult{}, nil
+	return result, rs.DispatchErrors()
 }
 
 func Exec(querier CtxQuerier, qry string, args ...any) (sql.Result, error) {
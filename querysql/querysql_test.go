@@ -1,16 +1,26 @@
 package querysql_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
+	"log"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vippsas/go-querysql/querysql"
+	"github.com/vippsas/go-querysql/querysql/queryprom"
+	"github.com/vippsas/go-querysql/querysql/querytest"
 	"github.com/vippsas/go-querysql/querysql/testhelper"
 )
 
@@ -87,7 +97,7 @@ select _function='OtherTestFunction', time=42, money=convert(money, 12345.67);
 	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
 		testhelper.TestFunction,
 		testhelper.OtherTestFunction,
-	}))
+	}).Dispatcher())
 	rs := querysql.New(ctx, sqldb, qry, "world")
 	rows := rs.Rows
 	testhelper.ResetTestFunctionsCalled()
@@ -202,18 +212,52 @@ select 2;
 	assert.Equal(t, row{1, "one"}, v2)
 
 	// select X = 2, Y = 'two'
-	v3, err := querysql.NextResult(rs, querysql.SingleOf[row])
-	assert.NoError(t, err)
-	assert.Equal(t, row{2, "two"}, v3)
-
 	// throw 55002, 'Here is an error.', 1;
+	// The error ends the result set, so the row read is not returned
 	_, err = querysql.NextResult(rs, querysql.SingleOf[row])
-	assert.Equal(t, "mssql: Here is an error", err.Error())
+	var qerr *querysql.QueryError
+	require.ErrorAs(t, err, &qerr)
+	assert.Equal(t, "mssql: Here is an error", qerr.Err.Error())
+	assert.Equal(t, 1, qerr.NumArgs)
+	assert.True(t, strings.HasPrefix(qerr.Query, "-- single scalar select 2; -- single struct select X = 1"))
+
+	assert.Equal(t, 3, qerr.ResultSetIndex)
+	assert.True(t, rs.Done())
 
 	// Check that we have exhausted the logging select before we do the call that gets ErrNoMoreSets
 	assert.Equal(t, []logrus.Fields{
 		{"x": "hello world", "y": int64(1)},
 	}, hook.lines)
+	_, err = querysql.NextResult(rs, querysql.SingleOf[row])
+	assert.Equal(t, querysql.ErrNoMoreSets, err)
+}
+
+func Test_ExceptionInsideSet(t *testing.T) {
+	// The third row fails with a division by zero after the first two rows have been sent
+	qry := `
+select 1;
+select 10 / (3 - x) from (values (1), (2), (3), (4)) as t(x);
+select 2;
+`
+	rs := querysql.New(context.Background(), sqldb, qry)
+	defer rs.Close()
+	assert.Equal(t, 1, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+
+	// The rows read before the error are not returned as if they were the complete result set
+	values, err := querysql.NextResult(rs, querysql.SliceOf[int])
+	assert.Nil(t, values)
+	var mssqlErr mssql.Error
+	require.ErrorAs(t, err, &mssqlErr)
+	assert.Equal(t, int32(8134), mssqlErr.Number)
+	var qerr *querysql.QueryError
+	require.ErrorAs(t, err, &qerr)
+	assert.Equal(t, 1, qerr.ResultSetIndex)
+	assert.True(t, rs.Done())
+
+	// The same for the helpers reading several result sets
+	_, _, err = querysql.Query2(querysql.SingleOf[int], querysql.SliceOf[int], context.Background(), sqldb, qry)
+	require.ErrorAs(t, err, &mssqlErr)
+	assert.Equal(t, int32(8134), mssqlErr.Number)
 }
 
 func TestDispatcherSetupError(t *testing.T) {
@@ -230,7 +274,7 @@ func TestDispatcherSetupError(t *testing.T) {
 	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
 	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
 		"SomethingThatIsNotAFunctionPointer", // This should cause a panic
-	}))
+	}).Dispatcher())
 	// Nothing here gets executed because we expect the WithDispatcher to have panicked
 	mustNotBeTrue = true
 }
@@ -250,7 +294,7 @@ func TestDispatcherRuntimeErrorsAndCornerCases(t *testing.T) {
 						select _function='TestFunction', component = 'abc', val=1, time=1.23; -- This does not get processed
 			`,
 			function:      "FunctionDoesNotExist",
-			expectedError: "could not find 'FunctionDoesNotExist'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'TestFunction', 'OtherTestFunction'",
+			expectedError: "result set 0: could not find 'FunctionDoesNotExist'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'TestFunction', 'OtherTestFunction'",
 		},
 		{
 			name: "_function is not a string",
@@ -258,7 +302,7 @@ func TestDispatcherRuntimeErrorsAndCornerCases(t *testing.T) {
 						select _function=4; -- Blows up here
 						select _function='TestFunction', component = 'abc', val=1, time=1.23; -- This does not get processed
 			`,
-			expectedError: "first argument to 'select' is expected to be a string. Got '4' of type 'int64' instead",
+			expectedError: "result set 0: first argument to 'select' is expected to be a string. Got '4' of type 'int64' instead",
 		},
 		{
 			name: "Function exist, but wrong number of args",
@@ -267,7 +311,7 @@ func TestDispatcherRuntimeErrorsAndCornerCases(t *testing.T) {
 						select _function='TestFunction', component = 'abc', val=1, time=1.23; -- This does not get processed
 			`,
 			function:      "TestFunction",
-			expectedError: "incorrect number of parameters for function 'TestFunction'",
+			expectedError: "result set 0: incorrect number of parameters for function 'TestFunction'",
 		},
 		{
 			name: "Function exist, can't convert args",
@@ -276,7 +320,7 @@ func TestDispatcherRuntimeErrorsAndCornerCases(t *testing.T) {
 						select _function='TestFunction', component = 'abc', val=1, time=1.23; -- This does not get processed
 			`,
 			function:      "TestFunction",
-			expectedError: "expected parameter 'time' to be of type 'float64' but got 'string' instead",
+			expectedError: "result set 0: expected parameter 'time' to be of type 'float64' but got 'string' instead",
 		},
 		{
 			name:     "Function exists, but try to print nil values",
@@ -292,7 +336,7 @@ func TestDispatcherRuntimeErrorsAndCornerCases(t *testing.T) {
 	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
 		testhelper.TestFunction,
 		testhelper.OtherTestFunction,
-	}))
+	}).Dispatcher())
 	var err error
 	for _, tc := range testcases {
 		rs := querysql.New(ctx, sqldb, tc.query, "world")
@@ -317,6 +361,76 @@ func TestDispatcherRuntimeErrorsAndCornerCases(t *testing.T) {
 	}
 }
 
+func TestDrain(t *testing.T) {
+	qry := `
+select _log='info', x = 'first';
+select 1;
+select _log='info', x = 'second';
+select 2;
+select _log='info', x = 'third';
+`
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	rs := querysql.New(ctx, sqldb, qry)
+	rows := rs.Rows
+
+	// select 1
+	require.NoError(t, querysql.Drain(rs))
+	assert.Equal(t, []logrus.Fields{
+		{"x": "first"},
+		{"x": "second"},
+	}, hook.lines)
+
+	// select 2
+	assert.Equal(t, 2, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	assert.Equal(t, []logrus.Fields{
+		{"x": "first"},
+		{"x": "second"},
+		{"x": "third"},
+	}, hook.lines)
+
+	assert.Equal(t, querysql.ErrNoMoreSets, querysql.Drain(rs))
+	assert.True(t, isClosed(rows))
+	assert.True(t, rs.Done())
+}
+
+func TestDrainAll(t *testing.T) {
+	qry := `
+select 1;
+select _log='info', x = 'first';
+select 2 union all select 3;
+select _log='info', x = 'second';
+select 'four';
+`
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	rs := querysql.New(ctx, sqldb, qry)
+	rows := rs.Rows
+
+	assert.Equal(t, 1, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	require.NoError(t, querysql.DrainAll(rs))
+	assert.Equal(t, []logrus.Fields{
+		{"x": "first"},
+		{"x": "second"},
+	}, hook.lines)
+	assert.True(t, isClosed(rows))
+	assert.True(t, rs.Done())
+
+	// Draining an exhausted ResultSets is not an error
+	require.NoError(t, querysql.DrainAll(rs))
+
+	// Errors are propagated
+	rs = querysql.New(ctx, sqldb, `select 1; throw 55002, 'Here is an error', 1;`)
+	err := querysql.DrainAll(rs)
+	var qerr *querysql.QueryError
+	require.ErrorAs(t, err, &qerr)
+	assert.Equal(t, "mssql: Here is an error", qerr.Err.Error())
+}
+
 func TestMultipleRowsetsPointers(t *testing.T) {
 	qry := `
 -- single scalar
@@ -401,6 +515,50 @@ select newid()
 	assert.True(t, isClosed(rows))
 }
 
+func TestConcurrentUse(t *testing.T) {
+	rs := querysql.New(context.Background(), sqldb, `select 1 union all select 2; select 3;`)
+	defer rs.Close()
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := querysql.NextResult(rs, querysql.Call(func(row int) error {
+			if row == 1 {
+				close(entered)
+				<-release
+			}
+			return nil
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+	}()
+
+	// While the goroutine above is inside NextResult, all other use is rejected
+	<-entered
+	assert.Equal(t, querysql.ErrConcurrentUse, querysql.Next(rs, nil))
+	_, err := querysql.NextResult(rs, querysql.SingleOf[int])
+	assert.Equal(t, querysql.ErrConcurrentUse, err)
+	assert.Equal(t, querysql.ErrConcurrentUse, rs.Close())
+	close(release)
+	<-done
+
+	// The rejected calls did not disturb the state
+	assert.Equal(t, 3, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	assert.True(t, rs.Done())
+}
+
+func TestReentrantUse(t *testing.T) {
+	rs := querysql.New(context.Background(), sqldb, `select 1; select 2;`)
+	defer rs.Close()
+
+	_, err := querysql.NextResult(rs, querysql.Call(func(row int) error {
+		return rs.Close()
+	}))
+	assert.ErrorIs(t, err, querysql.ErrConcurrentUse)
+}
+
 func TestEmptyScalar(t *testing.T) {
 	qry := `select 1 where 1 = 2`
 	rs := querysql.New(context.Background(), sqldb, qry)
@@ -413,6 +571,40 @@ func TestEmptyScalar(t *testing.T) {
 	assert.True(t, isClosed(rows))
 }
 
+func TestScanErrorNamesField(t *testing.T) {
+	type payment struct {
+		ID     int
+		Amount int
+	}
+	qry := `select ID = 1, Amount = '10' union all select ID = 2, Amount = 'ten'`
+	_, err := querysql.Slice[payment](context.Background(), sqldb, qry)
+	assert.ErrorContains(t, err,
+		`result set 0: row index 1: scanning into field Amount of querysql_test.payment: sql: Scan error on column index 1, name "Amount"`)
+
+	_, err = querysql.Slice[int](context.Background(), sqldb, `select 'ten'`)
+	assert.ErrorContains(t, err, `result set 0: row index 0: scanning into int: sql: Scan error on column index 0`)
+}
+
+func TestScannerReuseAcrossSets(t *testing.T) {
+	type row struct {
+		X int
+	}
+	rs := querysql.New(context.Background(), sqldb, `select X = 1; select Y = 2, X = 3;`)
+	defer rs.Close()
+	var value row
+	target := querysql.SingleInto(&value)
+	querysql.MustNext(rs, target)
+	assert.Equal(t, row{1}, value)
+
+	// The scanner has the columns of the first result set mapped, so it must not read the second
+	err := querysql.Next(rs, target)
+	assert.ErrorIs(t, err, querysql.ErrScannerReuse)
+	var rsErr *querysql.ResultSetError
+	require.ErrorAs(t, err, &rsErr)
+	assert.Equal(t, 1, rsErr.Index)
+	assert.Equal(t, row{1}, value)
+}
+
 func TestEmptyStruct(t *testing.T) {
 	type row struct {
 		X int
@@ -446,28 +638,91 @@ values (42);
 	// We run the query above in two ways:
 	// - first with ExecContext
 	// - second with SingleOf
-	// The run with ExecContext returns an error E
-	// The run with SingleOf returns a QuerySqlError wrapped around E
+	// Both return the error E of the driver, wrapped in a QueryError
 
 	// ExecContext error
 	_, errExec := querysql.ExecContext(context.Background(), sqldb, qry, "world")
-	assert.Error(t, errExec)
+	var execErr mssql.Error
+	require.ErrorAs(t, errExec, &execErr)
 	assert.Equal(t,
 		"mssql: Cannot insert the value NULL into column 'Username', table 'master.dbo.MyUsers'; column does not allow nulls. INSERT fails.",
-		errExec.Error(),
+		execErr.Error(),
 	)
 
 	// SingleOf error
 	rs := querysql.New(context.Background(), sqldb, qry)
 	_ = rs.Rows
 	_, errSingle := querysql.NextResult(rs, querysql.SingleOf[int])
-	assert.Error(t, errSingle)
+	var singleErr mssql.Error
+	require.ErrorAs(t, errSingle, &singleErr)
+	assert.Equal(t, execErr, singleErr)
 	// The errSingle has the same underlying error as the errExec
 	assert.True(t, errors.Is(errSingle, errExec))
-	// But the errSingle is not the same error as the errExec because,
-	// in addition to the underlying error, errSingle also contains
-	// the information that we called Single and didn't get any value back
-	assert.False(t, errors.Is(errExec, errSingle))
+	// The error ended the result set; it is not reported as a result set without rows, so
+	// unlike when errSingle was a ZeroRowsExpectedOne the relation holds both ways
+	assert.True(t, errors.Is(errExec, errSingle))
+	assert.False(t, errors.Is(errSingle, querysql.ZeroRowsExpectedOne))
+}
+
+func TestQueryError(t *testing.T) {
+	driverErr := errors.New("driver failure")
+	qry := "select 1 from " + strings.Repeat("MyTable, ", 20) + "OtherTable where X = @p1"
+
+	// Errors of the driver are wrapped with the start of the query
+	q := &flakyQuerier{failures: 1, err: driverErr}
+	_, err := querysql.Single[int](context.Background(), q, qry, "secret value")
+	var qerr *querysql.QueryError
+	require.ErrorAs(t, err, &qerr)
+	assert.ErrorIs(t, err, driverErr)
+	assert.Equal(t, driverErr, qerr.Unwrap())
+	assert.Equal(t, 1, qerr.NumArgs)
+	assert.Equal(t, 0, qerr.ResultSetIndex)
+	assert.Equal(t, qry[:120]+"...", qerr.Query)
+	assert.NotContains(t, err.Error(), "secret value")
+
+	// Errors for the same error of the driver match, also for errors such as mssql.Error
+	// that can not be compared with ==
+	mssqlErr := mssql.Error{Number: 50000, Message: "failed", All: []mssql.Error{{Number: 50000, Message: "failed"}}}
+	errA := &querysql.QueryError{Query: "select 1", Err: mssqlErr}
+	errB := &querysql.QueryError{Query: "select 2", NumArgs: 1, ResultSetIndex: 1, Err: mssqlErr}
+	assert.True(t, errors.Is(errA, errB))
+	assert.True(t, errors.Is(&querysql.ResultSetError{Index: 1, Err: errA}, errB))
+	assert.False(t, errors.Is(errA, qerr))
+
+	// ... unless disabled
+	q = &flakyQuerier{failures: 1, err: driverErr}
+	_, err = querysql.Single[int](querysql.WithoutQueryErrorContext(context.Background()), q, qry, "secret value")
+	assert.Equal(t, driverErr, err)
+
+	// Errors of the context are not wrapped
+	q = &flakyQuerier{failures: 1, err: context.DeadlineExceeded}
+	_, err = querysql.Single[int](context.Background(), q, qry)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestResultSetIndexInErrors(t *testing.T) {
+	qry := `
+select 1;
+select _log='info', x = 1;
+select 2;
+select 3 where 1 = 2;
+`
+	_, _, _, err := querysql.Query3(querysql.SingleOf[int], querysql.SingleOf[int], querysql.SingleOf[int],
+		context.Background(), sqldb, qry)
+	var rsErr *querysql.ResultSetError
+	require.ErrorAs(t, err, &rsErr)
+	assert.Equal(t, 3, rsErr.Index)
+	assert.True(t, errors.Is(err, querysql.ZeroRowsExpectedOne))
+	assert.True(t, strings.HasPrefix(err.Error(), "result set 3: query: 0 rows, expected 1"))
+
+	rs := querysql.New(context.Background(), sqldb, qry)
+	defer rs.Close()
+	assert.Equal(t, 0, rs.ResultSetIndex())
+	assert.Equal(t, 1, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	// the log select is skipped
+	assert.Equal(t, 2, rs.ResultSetIndex())
+	assert.Equal(t, 2, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	assert.Equal(t, 3, rs.ResultSetIndex())
 }
 
 func TestManyScalar(t *testing.T) {
@@ -476,9 +731,19 @@ func TestManyScalar(t *testing.T) {
 	rows := rs.Rows
 
 	_, err := querysql.NextResult(rs, querysql.SingleOf[int])
-	assert.Equal(t, querysql.ManyRowsExpectedOne, err)
+	assert.ErrorIs(t, err, querysql.ManyRowsExpectedOne)
+	assert.EqualError(t, err, "result set 0: query: 2 rows, expected 1 (use sliceScanner?)")
+	var manyRows querysql.ManyRowsError
+	require.ErrorAs(t, err, &manyRows)
+	assert.Equal(t, querysql.ManyRowsError{Rows: 2}, manyRows)
 	assert.True(t, isClosed(rows))
 	assert.True(t, rs.Done())
+
+	// The rows are counted up to 1000
+	_, err = querysql.Single[int](context.Background(), sqldb,
+		`select top 1500 1 from sys.all_objects a cross join sys.all_objects b`)
+	assert.ErrorIs(t, err, querysql.ManyRowsExpectedOne)
+	assert.EqualError(t, err, "result set 0: query: 1000+ rows, expected 1 (use sliceScanner?)")
 }
 
 func TestAutoClose(t *testing.T) {
@@ -531,6 +796,112 @@ func TestQuery4(t *testing.T) {
 	assert.Equal(t, []int(nil), d)
 }
 
+func TestMustQuery(t *testing.T) {
+	a, b := querysql.MustQuery2(
+		querysql.SingleOf[int], querysql.SliceOf[string],
+		context.Background(), sqldb, `
+		select 1;
+		select 'hello' union all select @p1;
+	`, "world")
+	assert.Equal(t, 1, a)
+	assert.Equal(t, []string{"hello", "world"}, b)
+
+	a, b, c := querysql.MustQuery3(
+		querysql.SingleOf[int], querysql.SliceOf[string], querysql.SliceOf[int],
+		context.Background(), sqldb, `
+		select 1;
+		select 'hello';
+		select 1 where 1 = 0;
+	`)
+	assert.Equal(t, 1, a)
+	assert.Equal(t, []string{"hello"}, b)
+	assert.Equal(t, []int(nil), c)
+
+	a, b, c, d := querysql.MustQuery4(
+		querysql.SingleOf[int], querysql.SliceOf[string], querysql.SliceOf[int], querysql.SingleOf[string],
+		context.Background(), sqldb, `
+		select 1;
+		select 'hello';
+		select 3 union all select 4;
+		select 'world';
+	`)
+	assert.Equal(t, 1, a)
+	assert.Equal(t, []string{"hello"}, b)
+	assert.Equal(t, []int{3, 4}, c)
+	assert.Equal(t, "world", d)
+}
+
+func TestMustQueryPanicsWithOriginalError(t *testing.T) {
+	defer func() {
+		r := recover()
+		require.NotNil(t, r)
+		err, ok := r.(error)
+		require.True(t, ok)
+		assert.True(t, errors.Is(err, querysql.ZeroRowsExpectedOne))
+		var panicErr *querysql.PanicError
+		require.True(t, errors.As(err, &panicErr))
+		assert.Equal(t, 1, panicErr.ResultSetIndex)
+		assert.Equal(t, "select 1; select 1 where 1 = 0;", panicErr.Query)
+	}()
+
+	querysql.MustQuery2(
+		querysql.SliceOf[int], querysql.SingleOf[int],
+		context.Background(), sqldb, `
+		select 1;
+		select 1 where 1 = 0;
+	`)
+}
+
+func TestMustNextResultPanicError(t *testing.T) {
+	qry := `
+select _log='info', x = 'counted as a result set';
+select 1;
+select 'a';
+`
+	rs := querysql.New(context.Background(), sqldb, qry)
+	assert.Equal(t, 1, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		require.True(t, ok)
+		var panicErr *querysql.PanicError
+		require.True(t, errors.As(err, &panicErr))
+		assert.Equal(t, 2, panicErr.ResultSetIndex)
+		assert.Equal(t, "select _log='info', x = 'counted as a result set'; select 1; select 'a';", panicErr.Query)
+		// The message is that of the error NextResult would have returned
+		assert.Equal(t, panicErr.Err.Error(), err.Error())
+		var rsErr *querysql.ResultSetError
+		assert.True(t, errors.As(err, &rsErr))
+	}()
+	querysql.MustNextResult(rs, querysql.SingleOf[int])
+}
+
+func TestPage(t *testing.T) {
+	qry := `
+select Name from (values (1, 'a'), (2, 'b'), (3, 'c'), (4, 'd'), (5, 'e')) t(ID, Name)
+where ID >= @p1
+order by ID offset @offset rows fetch next @limit rows only;
+
+select _log='info', x = 'logging is still processed';
+
+select count(*) from (values (1, 'a'), (2, 'b'), (3, 'c'), (4, 'd'), (5, 'e')) t(ID, Name)
+where ID >= @p1;
+`
+	ctx := context.Background()
+
+	page, err := querysql.Page[string](ctx, sqldb, qry, querysql.PageRequest{Offset: 0, Limit: 2}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, querysql.PageResult[string]{Items: []string{"b", "c"}, Total: 4, HasMore: true}, page)
+
+	page, err = querysql.Page[string](ctx, sqldb, qry, querysql.PageRequest{Offset: 2, Limit: 2}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, querysql.PageResult[string]{Items: []string{"d", "e"}, Total: 4, HasMore: false}, page)
+
+	page, err = querysql.Page[string](ctx, sqldb, qry, querysql.PageRequest{Offset: 10, Limit: 2}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, querysql.PageResult[string]{Items: nil, Total: 4, HasMore: false}, page)
+}
+
 func TestQueryPointers(t *testing.T) {
 	var a int
 	var b []int
@@ -552,6 +923,163 @@ func TestQueryPointers(t *testing.T) {
 	assert.Equal(t, []int(nil), d)
 }
 
+func TestWalk(t *testing.T) {
+	qry := `
+select 1;
+select 'skipped' union all select 'also skipped';
+select _log='info', x = 'not counted as a result set';
+select 2 union all select 3;
+select X = 1, Y = 'one' where 1 = 0;
+select 'last';
+`
+	var first int
+	var third []int
+	var last string
+	err := querysql.Walk(context.Background(), sqldb, qry, map[int]querysql.Target{
+		0: querysql.SingleInto(&first),
+		2: querysql.SliceInto(&third),
+		4: querysql.SingleInto(&last),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, []int{2, 3}, third)
+	assert.Equal(t, "last", last)
+
+	err = querysql.Walk(context.Background(), sqldb, qry, map[int]querysql.Target{
+		0: querysql.SingleInto(&first),
+		9: querysql.SingleInto(&last),
+		7: querysql.SingleInto(&last),
+	})
+	require.Error(t, err)
+	assert.Equal(t, "no result sets with index [7 9], the highest result set index seen was 4", err.Error())
+}
+
+func TestNamedResults(t *testing.T) {
+	qry := `
+select 'not named, drained';
+
+select _set='users';
+select X = 1, Y = 'one'
+union all select X = 2, Y = 'two';
+
+select _log='info', x = 'logging is processed as usual';
+
+select 'also drained';
+
+select _set='count';
+select 2;
+`
+	type row struct {
+		X int
+		Y string
+	}
+
+	var users []row
+	var count int
+	err := querysql.NamedResults(context.Background(), sqldb, qry, map[string]querysql.Target{
+		"count": querysql.SingleInto(&count),
+		"users": querysql.SliceInto(&users),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []row{{1, "one"}, {2, "two"}}, users)
+	assert.Equal(t, 2, count)
+
+	// Names in the query must be known
+	err = querysql.NamedResults(context.Background(), sqldb, qry, map[string]querysql.Target{
+		"users":  querysql.SliceInto(&users),
+		"orders": querysql.SliceInto(&users),
+	})
+	require.Error(t, err)
+	assert.Equal(t, "unknown result set name 'count'. Expected one of 'orders', 'users'", err.Error())
+
+	// All targets must get a result set
+	err = querysql.NamedResults(context.Background(), sqldb, qry, map[string]querysql.Target{
+		"users":  querysql.SliceInto(&users),
+		"count":  querysql.SingleInto(&count),
+		"orders": querysql.SliceInto(&users),
+	})
+	require.Error(t, err)
+	assert.Equal(t, "no result sets named [orders]", err.Error())
+
+	// Other ways of reading the results skip the _set selects
+	rs := querysql.New(context.Background(), sqldb, qry)
+	defer rs.Close()
+	assert.Equal(t, "not named, drained", querysql.MustNextResult(rs, querysql.SingleOf[string]))
+	assert.Equal(t, []row{{1, "one"}, {2, "two"}}, querysql.MustNextResult(rs, querysql.SliceOf[row]))
+}
+
+func TestMapArgs(t *testing.T) {
+	ctx := context.Background()
+	v, err := querysql.Single[string](ctx, sqldb, `select concat(@greeting, ' ', @name, ' ', @n)`, map[string]any{
+		"greeting": "hello",
+		"name":     "world",
+		"n":        3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello world 3", v)
+
+	// Mixing with positional parameters fails before running the query
+	q := &flakyQuerier{CtxQuerier: sqldb}
+	_, err = querysql.Slice[int](ctx, q, `select @p1`, map[string]any{"a": 1}, 2)
+	require.Error(t, err)
+	assert.Equal(t, 0, q.calls)
+}
+
+func TestColumns(t *testing.T) {
+	type errorDetail struct {
+		ErrorCode int
+		Message   string
+	}
+	type data struct {
+		X int
+		Y string
+	}
+
+	for _, tc := range []struct {
+		qry             string
+		expectedColumns []string
+		expected        any
+	}{
+		{
+			qry: `
+select _log='info', x = 'leading log select';
+select ErrorCode = 42, Message = 'failed';
+`,
+			expectedColumns: []string{"ErrorCode", "Message"},
+			expected:        errorDetail{42, "failed"},
+		},
+		{
+			qry:             `select X = 1, Y = 'one';`,
+			expectedColumns: []string{"X", "Y"},
+			expected:        data{1, "one"},
+		},
+	} {
+		rs := querysql.New(context.Background(), sqldb, tc.qry)
+		rows := rs.Rows
+
+		cols, err := rs.Columns()
+		require.NoError(t, err)
+		assert.Equal(t, tc.expectedColumns, cols)
+		// Peeking again gives the same result
+		cols, err = rs.Columns()
+		require.NoError(t, err)
+		assert.Equal(t, tc.expectedColumns, cols)
+
+		var result any
+		if cols[0] == "ErrorCode" {
+			result, err = querysql.NextResult(rs, querysql.SingleOf[errorDetail])
+		} else {
+			result, err = querysql.NextResult(rs, querysql.SingleOf[data])
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, result)
+
+		_, err = rs.Columns()
+		assert.Equal(t, querysql.ErrNoMoreSets, err)
+		assert.True(t, isClosed(rows))
+	}
+}
+
 func TestPropagateSyntaxError1(t *testing.T) {
 	_, _, _, _, err := querysql.Query4(
 		querysql.SingleOf[int], querysql.SliceOf[int], querysql.SliceOf[string], querysql.SliceOf[int],
@@ -605,7 +1133,7 @@ select _function='TestFunction', component = 'abc', val=1, time=1.23;
 	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
 	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
 		testhelper.TestFunction,
-	}))
+	}).Dispatcher())
 	testhelper.ResetTestFunctionsCalled()
 
 	res, err := querysql.ExecContext(ctx, sqldb, qry, "world")
@@ -624,6 +1152,210 @@ select _function='TestFunction', component = 'abc', val=1, time=1.23;
 	assert.True(t, testhelper.TestFunctionsCalled["TestFunction"])
 }
 
+func TestNextWithSqlResult(t *testing.T) {
+	qry := `
+select _log='info', x = 'first';
+select 1 union all select 2;
+select _log='info', x = 'second';
+select top(0) 1 as X;
+`
+	rs := querysql.New(context.Background(), sqldb, qry)
+	var xs []int
+	result, err := querysql.NextWithSqlResult(rs, querysql.SliceInto(&xs))
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, xs)
+	assert.Equal(t, 1, result.Index)
+	assert.Equal(t, int64(2), result.RowsScanned)
+
+	result, err = querysql.NextWithSqlResult(rs, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Index)
+	assert.Equal(t, int64(0), result.RowsScanned)
+
+	_, err = querysql.NextWithSqlResult(rs, nil)
+	assert.Equal(t, querysql.ErrNoMoreSets, err)
+
+	// ExecContext returns the same for each set
+	res, err := querysql.ExecContext(context.Background(), sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, []querysql.SqlResult{{Index: 1, RowsScanned: 2}, {Index: 3, RowsScanned: 0}}, res.(querysql.ExecResult).Sets)
+}
+
+func TestExecContextDispatcherError(t *testing.T) {
+	qry := `
+select 1;
+select _log='info', x = 'before the failing select';
+select _function='FunctionDoesNotExist', val = 1;
+select _function='TestFunction', component = 'abc', val=1, time=1.23; -- This does not get processed
+select 2;
+`
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
+		testhelper.TestFunction,
+	}).Dispatcher())
+	testhelper.ResetTestFunctionsCalled()
+
+	_, err := querysql.ExecContext(ctx, sqldb, qry)
+	require.Error(t, err)
+	assert.Equal(t, "result set 2: could not find 'FunctionDoesNotExist'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'TestFunction'", err.Error())
+	var rsErr *querysql.ResultSetError
+	require.True(t, errors.As(err, &rsErr))
+	assert.Equal(t, 2, rsErr.Index)
+
+	assert.Equal(t, []logrus.Fields{{"x": "before the failing select"}}, hook.lines)
+	assert.False(t, testhelper.TestFunctionsCalled["TestFunction"])
+
+	// Without a dispatcher on the context
+	_, err = querysql.ExecContext(context.Background(), sqldb, qry)
+	require.Error(t, err)
+	assert.Equal(t, "result set 2: missing dispatcher", err.Error())
+}
+
+func TestExecContextDispatcherErrorContinue(t *testing.T) {
+	qry := `
+select _function='FunctionDoesNotExist', val = 1;
+select _function='TestFunction', component = 'abc', val=1, time=1.23;
+select 2;
+`
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithDispatcher(ctx, querysql.NewDispatcherFuncs(testhelper.TestFunction).
+		OnError(querysql.DispatchErrorContinue).
+		Dispatcher())
+	testhelper.ResetTestFunctionsCalled()
+
+	res, err := querysql.ExecContext(ctx, sqldb, qry)
+	require.Error(t, err)
+	assert.Equal(t, "result set 0: could not find 'FunctionDoesNotExist'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'TestFunction'", err.Error())
+	var rsErr *querysql.ResultSetError
+	require.True(t, errors.As(err, &rsErr))
+	assert.Equal(t, 0, rsErr.Index)
+	assert.Equal(t, []querysql.SqlResult{{Index: 2, RowsScanned: 1}}, res.(querysql.ExecResult).Sets)
+
+	assert.Equal(t, []logrus.Fields{{"event": "dispatch_error", "error": err.Error()}}, hook.lines)
+	assert.True(t, testhelper.TestFunctionsCalled["TestFunction"])
+}
+
+func TestDispatchPayload(t *testing.T) {
+	type importRow struct {
+		Name  string
+		Value int64
+	}
+	var batches []int64
+	var imported [][]importRow
+	ctx := querysql.WithDispatcherCtx(context.Background(), querysql.GoMSSQLDispatcherCtx([]interface{}{
+		querysql.Func("ImportBatch", func(batchID int64, rows []importRow) error {
+			batches = append(batches, batchID)
+			imported = append(imported, rows)
+			return nil
+		}),
+	}))
+
+	qry := `
+select _function='ImportBatch', batchId=7;
+select name='a', value=1 union all select name='b', value=2;
+select _function='ImportBatch', batchId=8;
+select name='c', value=3 where 1=2;
+select 42;
+`
+	x, err := querysql.Single[int](ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, 42, x)
+	assert.Equal(t, []int64{7, 8}, batches)
+	assert.Equal(t, [][]importRow{{{"a", 1}, {"b", 2}}, {}}, imported)
+
+	_, err = querysql.ExecContext(ctx, sqldb, `select _function='ImportBatch', batchId=9;`)
+	assert.EqualError(t, err, "result set 0: payload of function 'ImportBatch': missing payload result set")
+	_, err = querysql.ExecContext(ctx, sqldb, `
+select _function='ImportBatch', batchId=9;
+select name='a', other=1;
+`)
+	assert.EqualError(t, err, "result set 0: payload of function 'ImportBatch': failed to map all struct fields to query columns (names: [name value], columns: [name other], diff: map[other:-1 value:1])")
+}
+
+func TestExecScript(t *testing.T) {
+	script := `
+create table #ExecScript (X int);
+GO
+-- 'create procedure' must be the first statement in its batch
+create procedure #ExecScriptInsert(@x int) as
+begin
+	insert into #ExecScript (X) values (@x);
+	select _log='info', x = @x, msg = 'inserted; next is go
+go';
+end
+go
+exec #ExecScriptInsert @p1;
+exec #ExecScriptInsert 2;
+`
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+
+	err := querysql.OnConn(ctx, sqldb, func(q querysql.CtxQuerier) error {
+		require.NoError(t, querysql.ExecScript(ctx, q, script, 1))
+		assert.Equal(t, []int{1, 2}, querysql.MustSlice[int](ctx, q, `select X from #ExecScript order by X`))
+
+		err := querysql.ExecScript(ctx, q, "select 1\ngo\n\nselect * from NoSuchTable;\ngo\nselect 2")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "batch 2 (select * from NoSuchTable;): ")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{
+		{"x": int64(1), "msg": "inserted; next is go\ngo"},
+		{"x": int64(2), "msg": "inserted; next is go\ngo"},
+	}, hook.lines)
+}
+
+func TestExecReturning(t *testing.T) {
+	type user struct {
+		ID       int
+		Username string
+	}
+	qry := `
+create table #ExecReturning (ID int identity(1,1) primary key, Username nvarchar(50));
+select 'not the last result set';
+select _log='info', x = 'inserting';
+insert into #ExecReturning (Username)
+output inserted.ID, inserted.Username
+values ('JohnDoe'), ('JaneDoe');
+select _log='info', x = 'done';
+`
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+
+	users, err := querysql.ExecReturning[user](ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, []user{{1, "JohnDoe"}, {2, "JaneDoe"}}, users)
+	assert.Equal(t, []logrus.Fields{{"x": "inserting"}, {"x": "done"}}, hook.lines)
+
+	_, err = querysql.ExecReturning[user](ctx, sqldb, `select _log='info', x = 'no data'`)
+	assert.Equal(t, querysql.ErrNoMoreSets, err)
+}
+
+func TestExecReturningDispatcherErrorContinue(t *testing.T) {
+	qry := `
+select _function='FunctionDoesNotExist', val = 1;
+select X = 2;
+`
+	ctx := querysql.WithDispatcher(context.Background(), querysql.NewDispatcherFuncs(testhelper.TestFunction).
+		OnError(querysql.DispatchErrorContinue).
+		Dispatcher())
+
+	rows, err := querysql.ExecReturning[int](ctx, sqldb, qry)
+	assert.EqualError(t, err, "result set 0: could not find 'FunctionDoesNotExist'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'TestFunction'")
+	assert.Equal(t, []int{2}, rows)
+}
+
 func Test_timeDotTime(t *testing.T) {
 	testcases := []struct {
 		name     string
@@ -740,7 +1472,7 @@ select _function='ReturnAnonFunc', label = 'myLabel', time=1.23;
 	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
 		testhelper.TestFunction,
 		testhelper.ReturnAnonFunc("myComponent"),
-	}))
+	}).Dispatcher())
 	testhelper.ResetTestFunctionsCalled()
 
 	_, err := querysql.ExecContext(ctx, sqldb, qry, "world")
@@ -771,7 +1503,645 @@ func TestDispatcherPanicsWithTwoAnonFuncs(t *testing.T) {
 	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
 		testhelper.ReturnAnonFunc("myComponent"),
 		testhelper.ReturnAnonFunc("myComponent2"), // This should cause a panic
-	}))
+	}).Dispatcher())
 	// Nothing here gets executed because we expect the WithDispatcher to have panicked
 	mustNotBeTrue = true
 }
+
+func TestDispatcherLongValues(t *testing.T) {
+	// Values of 1 MB, to make sure the driver does not truncate NVARCHAR(MAX) and VARBINARY(MAX)
+	qry := `
+declare @key nvarchar(max) = replicate(convert(nvarchar(max), N'k'), 1048576);
+declare @blob varbinary(max) = convert(varbinary(max), replicate(convert(varchar(max), 'abcd'), 262144));
+select _function = 'Store', [key] = @key, blob = @blob;
+`
+	var key string
+	var blob []byte
+	store := func(k string, b []byte) {
+		key, blob = k, b
+	}
+	for _, funcs := range []*querysql.DispatcherFuncs{
+		querysql.NewDispatcherFuncs().Register("Store", store),
+		querysql.NewDispatcherFuncs().Register("Store", store).StrictTypes(),
+	} {
+		key, blob = "", nil
+		ctx := querysql.WithDispatcher(context.Background(), funcs.Dispatcher())
+		_, err := querysql.ExecContext(ctx, sqldb, qry)
+		require.NoError(t, err)
+		assert.Equal(t, 1<<20, len(key))
+		assert.Equal(t, strings.Repeat("k", 1<<20), key)
+		assert.Equal(t, bytes.Repeat([]byte("abcd"), 1<<18), blob)
+	}
+}
+
+func TestContextCancelledDuringScan(t *testing.T) {
+	qry := `
+select top(10000) row_number() over (order by a.object_id)
+from sys.all_objects a cross join sys.all_objects b
+`
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	visited := 0
+	err := querysql.Iter(ctx, sqldb, func(row int) error {
+		visited++
+		if visited == 5 {
+			cancel()
+		}
+		return nil
+	}, qry)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, visited, 10000)
+}
+
+func TestContextCancelledBeforeLogSelect(t *testing.T) {
+	qry := `
+select 1;
+select _log='info', x = 'never logged';
+select 2;
+`
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx, cancel := context.WithCancel(querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel)))
+	defer cancel()
+
+	rs := querysql.New(ctx, sqldb, qry)
+	rows := rs.Rows
+	defer rs.Close()
+
+	cancel()
+	_, err := querysql.NextResult(rs, querysql.SingleOf[int])
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Empty(t, hook.lines)
+	assert.True(t, isClosed(rows))
+	assert.True(t, rs.Done())
+}
+
+func TestContextCancelledDuringLogSelect(t *testing.T) {
+	qry := `
+select top(10000) _log='info', x = row_number() over (order by a.object_id)
+from sys.all_objects a cross join sys.all_objects b;
+select 1;
+`
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logged := 0
+	ctx = querysql.WithLogger(ctx, func(rows *sql.Rows) error {
+		for rows.Next() {
+			logged++
+			if logged == 5 {
+				cancel()
+			}
+		}
+		return nil
+	})
+	// The logger reads on until database/sql closes the rows, but the select is not taken as logged
+	_, err := querysql.Single[int](ctx, sqldb, qry)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Less(t, logged, 10000)
+}
+
+// ctxCapturingQuerier remembers the context passed to QueryContext
+type ctxCapturingQuerier struct {
+	querysql.CtxQuerier
+	ctx context.Context
+}
+
+func (q *ctxCapturingQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	q.ctx = ctx
+	return q.CtxQuerier.QueryContext(ctx, query, args...)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	qry := `
+select 1;
+waitfor delay '00:00:03';
+select 2;
+`
+	ctx := querysql.WithQueryTimeout(context.Background(), 200*time.Millisecond)
+	start := time.Now()
+	_, _, err := querysql.Query2(querysql.SingleOf[int], querysql.SingleOf[int], ctx, sqldb, qry)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestQueryTimeoutCancelledOnClose(t *testing.T) {
+	qry := `
+select 1;
+select _log='info', x = 'trailing log select';
+select _function='TestFunction', component = 'abc', val=1, time=1.23;
+`
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
+		testhelper.TestFunction,
+	}).Dispatcher())
+	ctx = querysql.WithQueryTimeout(ctx, time.Minute)
+	testhelper.ResetTestFunctionsCalled()
+
+	q := &ctxCapturingQuerier{CtxQuerier: sqldb}
+	rs := querysql.New(ctx, q, qry)
+	_, hasDeadline := q.ctx.Deadline()
+	assert.True(t, hasDeadline)
+
+	assert.Equal(t, 1, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	// The trailing selects were processed before the timeout context was cancelled
+	assert.Equal(t, []logrus.Fields{{"x": "trailing log select"}}, hook.lines)
+	assert.True(t, testhelper.TestFunctionsCalled["TestFunction"])
+	assert.True(t, rs.Done())
+	assert.Equal(t, context.Canceled, q.ctx.Err())
+
+	// Explicitly closing before the results are exhausted also cancels
+	rs = querysql.New(ctx, q, `select 1; select 2;`)
+	assert.NoError(t, q.ctx.Err())
+	assert.NoError(t, rs.Close())
+	assert.Equal(t, context.Canceled, q.ctx.Err())
+}
+
+func TestQueryEcho(t *testing.T) {
+	var hook LogHook
+	logger := logrus.StandardLogger()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithQueryEcho(ctx)
+
+	v, err := querysql.Single[string](ctx, sqldb, `
+		select _log='info', x = 'in between';
+		select concat(@p1, @suffix)
+	`, "hello", sql.Named("suffix", " world"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", v)
+
+	require.Len(t, hook.lines, 3)
+	assert.Equal(t, logrus.Fields{
+		"event":  "query.start",
+		"query":  "select _log='info', x = 'in between'; select concat(@p1, @suffix)",
+		"params": "@p1 string, @suffix string",
+	}, hook.lines[0])
+	assert.Equal(t, logrus.Fields{"x": "in between"}, hook.lines[1])
+	assert.Equal(t, "query.end", hook.lines[2]["event"])
+	assert.Equal(t, int64(2), hook.lines[2]["sets"])
+	assert.Contains(t, hook.lines[2], "duration_ms")
+
+	// Without WithQueryEcho nothing extra is logged
+	hook.lines = nil
+	_, err = querysql.Single[int](querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel)), sqldb, `select 1`)
+	require.NoError(t, err)
+	assert.Empty(t, hook.lines)
+}
+
+func TestTimingLogs(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithTimingLogs(ctx)
+
+	v, err := querysql.Single[int](ctx, sqldb, `
+		select _log='info', x = 'in between';
+		select 1;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	require.Len(t, hook.lines, 2)
+	assert.Equal(t, logrus.Fields{"x": "in between"}, hook.lines[0])
+	timing := hook.lines[1]
+	assert.Equal(t, "query.timing", timing["event"])
+	assert.Equal(t, int64(2), timing["sets"])
+	assert.Equal(t, int64(1), timing["rows"])
+	assert.Contains(t, timing, "duration_ms")
+	assert.Regexp(t, `^\d+,\d+$`, timing["set_durations_ms"])
+
+	// Without WithTimingLogs nothing extra is logged
+	hook.lines = nil
+	_, err = querysql.Single[int](querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel)), sqldb, `select 1`)
+	require.NoError(t, err)
+	assert.Empty(t, hook.lines)
+}
+
+func TestQueryName(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithQueryName(ctx, "settlement-batch")
+
+	_, err := querysql.ExecContext(ctx, sqldb, `
+		select _log='info', x = 'hello';
+		select _log='nosuchlevel', x = 'invalid level';
+		select _log='info', x = 1 where 1 = 0;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{
+		{"query_id": "settlement-batch", "x": "hello"},
+		{"query_id": "settlement-batch", "event": "invalid.log.level", "invalid.level": "nosuchlevel"},
+		{"query_id": "settlement-batch", "x": "invalid level"},
+		{"query_id": "settlement-batch", "_norows": true, "x": ""},
+	}, hook.lines)
+}
+
+func TestLogrusLogRedaction(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithLogRedaction(ctx, querysql.RedactColumns("*card*"))
+
+	_, err := querysql.ExecContext(ctx, sqldb, `
+		select _log='info', x = 'hello', CardNumber = '4925000000000004';
+		select _log='info', CardNumber = 1 where 1 = 0;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{
+		{"x": "hello", "CardNumber": "[REDACTED]"},
+		{"_norows": true, "CardNumber": "[REDACTED]"},
+	}, hook.lines)
+}
+
+func TestResultSetsWithLogger(t *testing.T) {
+	var ctxHook, rsHook LogHook
+	ctxLogger, rsLogger := logrus.New(), logrus.New()
+	ctxLogger.Hooks.Add(&ctxHook)
+	rsLogger.Hooks.Add(&rsHook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(ctxLogger, logrus.InfoLevel))
+	qry := `
+		select _log='info', x = 'before';
+		select 1;
+		select _log='info', x = 'after';
+	`
+
+	// Silence the logger on the context for one query
+	rs := querysql.New(ctx, sqldb, qry).WithLogger(nil)
+	n, err := querysql.NextResult(rs, querysql.SingleOf[int])
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.True(t, rs.Done())
+	assert.Empty(t, ctxHook.lines)
+
+	rs = querysql.New(ctx, sqldb, qry).WithLogger(querysql.LogrusMSSQLLogger(rsLogger, logrus.InfoLevel))
+	_, err = querysql.NextResult(rs, querysql.SingleOf[int])
+	require.NoError(t, err)
+	assert.Empty(t, ctxHook.lines)
+	assert.Equal(t, []logrus.Fields{{"x": "before"}, {"x": "after"}}, rsHook.lines)
+
+	// Passed to New, the options also apply to the entries logged when the query starts
+	echo := querysql.WithQueryEcho(ctx)
+	rs = querysql.New(echo, sqldb, qry).WithLogger(nil)
+	require.NoError(t, querysql.DrainAll(rs))
+	require.Len(t, ctxHook.lines, 1)
+	assert.Equal(t, "query.start", ctxHook.lines[0]["event"])
+	ctxHook.lines = nil
+	rs = querysql.New(echo, sqldb, qry, querysql.WithRowsLogger(nil))
+	require.NoError(t, querysql.DrainAll(rs))
+	assert.Empty(t, ctxHook.lines)
+
+	// and are not passed to the query
+	n, err = querysql.Single[int](echo, sqldb, `select _log='info', x = @p; select @p`, sql.Named("p", 2), querysql.WithRowsLogger(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Empty(t, ctxHook.lines)
+}
+
+func TestLogKeyFromContext(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithLogKey(ctx, "LogLevel")
+
+	qry := `
+		select loglevel='info', x = 'custom key';
+		select _log='info', x = 'underscore key';
+		select 1;
+	`
+	n, err := querysql.Single[int](ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []logrus.Fields{{"x": "custom key"}, {"x": "underscore key"}}, hook.lines)
+
+	// The key set on the ResultSets takes precedence
+	rs := querysql.New(ctx, sqldb, qry)
+	assert.Equal(t, "loglevel", rs.LogKeyLowercase)
+	require.NoError(t, rs.Close())
+	rs = querysql.New(ctx, sqldb, qry).With(querysql.WithRowsLogKey("Level"))
+	assert.Equal(t, "level", rs.LogKeyLowercase)
+	require.NoError(t, rs.Close())
+}
+
+func TestDispatchKeyFromContext(t *testing.T) {
+	ctx := querysql.WithDispatcher(context.Background(), querysql.GoMSSQLDispatcher([]interface{}{
+		testhelper.TestFunction,
+	}).Dispatcher())
+	ctx = querysql.WithDispatchKey(ctx, "Callback")
+	testhelper.ResetTestFunctionsCalled()
+
+	qry := `
+		select callback='TestFunction', component = 'abc', val=1, time=1.23;
+		select 1;
+	`
+	n, err := querysql.Single[int](ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, testhelper.TestFunctionsCalled["TestFunction"])
+
+	// The key set on the ResultSets takes precedence
+	rs := querysql.New(ctx, sqldb, qry)
+	assert.Equal(t, "callback", rs.DispatchKeyLowercase)
+	require.NoError(t, rs.Close())
+	rs = querysql.New(ctx, sqldb, qry).With(querysql.WithRowsDispatchKey("Call"))
+	assert.Equal(t, "call", rs.DispatchKeyLowercase)
+	require.NoError(t, rs.Close())
+
+	// Dispatching and logging in the same select is an error
+	_, err = querysql.ExecContext(ctx, sqldb, `select callback='TestFunction', _log='info', val=1`)
+	assert.EqualError(t, err, "result set 0: select has both the dispatch key column 'callback' and the log key column '_log'; use separate selects for dispatching and logging")
+}
+
+func TestPrometheusMonitor(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	monitor := queryprom.NewMonitor(registry)
+	require.NoError(t, monitor.Counter("orders_processed_total", "Orders processed.", "region"))
+	require.NoError(t, monitor.Gauge("queue_length", "Length of the queue."))
+	ctx := querysql.WithMonitor(context.Background(), monitor.Record)
+
+	_, err := querysql.ExecContext(ctx, sqldb, `
+		select _metric='orders_processed_total', labels='region=eu', value=42;
+		select _metric='orders_processed_total', labels='region=eu';
+		select _metric='queue_length', labels=null, value=convert(decimal(10, 2), 3.5);
+	`)
+	require.NoError(t, err)
+	assert.NoError(t, testutil.CollectAndCompare(registry, strings.NewReader(`
+# HELP orders_processed_total Orders processed.
+# TYPE orders_processed_total counter
+orders_processed_total{region="eu"} 43
+# HELP queue_length Length of the queue.
+# TYPE queue_length gauge
+queue_length 3.5
+`)))
+
+	_, err = querysql.ExecContext(ctx, sqldb, `select _metric='orders_total', value=1`)
+	assert.EqualError(t, err, "result set 0: metric 'orders_total': not declared; expected one of 'orders_processed_total', 'queue_length'")
+}
+
+func TestLogCollector(t *testing.T) {
+	logs := querytest.NewLogCollector()
+	ctx := querysql.WithLogger(context.Background(), logs.Log)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := querysql.ExecContext(ctx, sqldb, `select _log='warning', _event='query.done', i=@p1`, i)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	entries := logs.Entries()
+	require.Len(t, entries, 5)
+	assert.Equal(t, logrus.WarnLevel, entries[0].Level)
+	assert.Equal(t, "query.done", entries[0].Message)
+	for i := 0; i < 5; i++ {
+		logs.AssertContains(t, logrus.Fields{"i": int64(i)})
+	}
+
+	logs.Reset()
+	assert.Empty(t, logs.Entries())
+}
+
+func TestRecordingDispatcher(t *testing.T) {
+	calls := querytest.RecordingDispatcher()
+	ctx := querysql.WithDispatcher(context.Background(), calls.Dispatch)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := querysql.ExecContext(ctx, sqldb, `select _function='RecordMetric', name='queries', value=@p1`, i)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, calls.CallsTo("RecordMetric"), 5)
+
+	calls.Reset()
+	_, err := querysql.ExecContext(ctx, sqldb, `
+select _function='Audit', id=convert(uniqueidentifier, '00010203-0405-0607-0809-0a0b0c0d0e0f'), amount=convert(money, 12.5), note=null;
+select _function='RecordMetric', name='queries', value=1;
+`)
+	require.NoError(t, err)
+	assert.Equal(t, []querytest.DispatchCall{
+		{Name: "Audit", Args: []any{uuid.MustParse("00010203-0405-0607-0809-0a0b0c0d0e0f"), 12.5, nil}},
+		{Name: "RecordMetric", Args: []any{"queries", int64(1)}},
+	}, calls.Calls())
+	assert.Equal(t, [][]any{{"queries", int64(1)}}, calls.ArgsOf("RecordMetric"))
+}
+
+func TestLogNullValues(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	qry := `select _log='info', a=null, b=convert(uniqueidentifier, null), c=convert(money, null), d=1`
+
+	_, err := querysql.ExecContext(ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{{"a": nil, "b": nil, "c": nil, "d": int64(1)}}, hook.lines)
+
+	hook.lines = nil
+	ctx = querysql.WithLogger(ctx, querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel, querysql.WithOmitNullLogValues()))
+	_, err = querysql.ExecContext(ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{{"d": int64(1)}}, hook.lines)
+}
+
+func TestLogDateTime(t *testing.T) {
+	qry := `
+select _log='info', at = sysutcdatetime(), d = convert(datetime, '2024-01-02T03:04:05.600'), o = convert(datetimeoffset, '2024-01-02T03:04:05+02:00');
+`
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	_, err := querysql.ExecContext(ctx, sqldb, qry)
+	require.NoError(t, err)
+	require.Len(t, hook.lines, 1)
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?Z$`, hook.lines[0]["at"])
+	assert.Equal(t, "2024-01-02T03:04:05.6Z", hook.lines[0]["d"])
+	assert.Equal(t, "2024-01-02T03:04:05+02:00", hook.lines[0]["o"])
+
+	var buf bytes.Buffer
+	ctx = querysql.WithLogger(context.Background(), querysql.StdMSSQLLogger(log.New(&buf, "", 0), querysql.WithLogTimeLayout(time.DateTime)))
+	_, err = querysql.ExecContext(ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Regexp(t, `^level=info at="\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}" d="2024-01-02 03:04:05" o="2024-01-02 03:04:05"\n$`, buf.String())
+}
+
+func TestLogDecimal(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	_, err := querysql.ExecContext(ctx, sqldb, `select _log='info', ratio=convert(decimal(9,4), 0.25), n=convert(numeric(5,1), -12.5)`)
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{{"ratio": "0.2500", "n": "-12.5"}}, hook.lines)
+}
+
+func TestLogBit(t *testing.T) {
+	qry := `select _log='info', enabled=convert(bit, 1), disabled=convert(bit, 0), unknown=convert(bit, null)`
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	_, err := querysql.ExecContext(ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{{"enabled": true, "disabled": false, "unknown": nil}}, hook.lines)
+
+	var buf bytes.Buffer
+	ctx = querysql.WithLogger(context.Background(), querysql.StdMSSQLLogger(log.New(&buf, "", 0)))
+	_, err = querysql.ExecContext(ctx, sqldb, qry)
+	require.NoError(t, err)
+	assert.Equal(t, "level=info enabled=true disabled=false unknown=null\n", buf.String())
+}
+
+func TestLogNumericLevel(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	_, err := querysql.ExecContext(ctx, sqldb, `
+		select _log=1, x = 'one';
+		select _log=10, x = 'ten';
+		select _log='nonsense', x = 'invalid';
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, []logrus.Fields{
+		{"x": "one"},
+		{"x": "ten"},
+		{"event": "invalid.log.level", "invalid.level": "nonsense"},
+		{"x": "invalid"},
+	}, hook.lines)
+	assert.Equal(t, []logrus.Level{logrus.InfoLevel, logrus.DebugLevel, logrus.ErrorLevel, logrus.InfoLevel}, hook.levels)
+}
+
+func TestMinLogLevel(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.SetLevel(logrus.DebugLevel)
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.DebugLevel))
+	ctx = querysql.WithMinLogLevel(ctx, logrus.InfoLevel)
+
+	qry := `
+		select _log='debug', x = 'debug';
+		select _log='info', x = 'info';
+		select _log='info', x = 1 where 1 = 0;
+		select 1;
+	`
+	assert.Equal(t, 1, querysql.MustSingle[int](ctx, sqldb, qry))
+	assert.Equal(t, []logrus.Fields{{"x": "info"}}, hook.lines)
+
+	// The options of a query take precedence
+	hook.lines = nil
+	rs := querysql.New(ctx, sqldb, qry).With(querysql.WithRowsMinLogLevel(logrus.DebugLevel))
+	assert.Equal(t, 1, querysql.MustNextResult(rs, querysql.SingleOf[int]))
+	assert.Equal(t, []logrus.Fields{{"x": "debug"}, {"x": "info"}, {"_norows": true, "x": ""}}, hook.lines)
+}
+
+func TestOptions(t *testing.T) {
+	qry := `
+select _log='info', x = 'underscore key';
+select loglevel='info', x = 'custom key';
+select _function='TestFunction', component = 'abc', val=1, time=1.23;
+select 1;
+select 2;
+`
+	var ctxHook, optionHook LogHook
+	ctxLogger := logrus.New()
+	ctxLogger.Hooks.Add(&ctxHook)
+	optionLogger := logrus.New()
+	optionLogger.Hooks.Add(&optionHook)
+
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(ctxLogger, logrus.InfoLevel))
+	ctx = querysql.WithDispatcher(ctx, querysql.GoMSSQLDispatcher([]interface{}{
+		testhelper.OtherTestFunction,
+	}).Dispatcher())
+
+	for _, tc := range []struct {
+		name                string
+		opts                []querysql.Option
+		expectedCtxLines    []logrus.Fields
+		expectedOptionLines []logrus.Fields
+		expectedErr         string
+	}{
+		{
+			name:             "no options uses the context",
+			opts:             nil,
+			expectedCtxLines: []logrus.Fields{{"x": "underscore key"}},
+			expectedErr:      "result set 2: could not find 'TestFunction'.  The first argument to 'select' must be the name of a function passed into the dispatcher.  Expected one of 'OtherTestFunction'",
+		},
+		{
+			name: "logger and dispatcher",
+			opts: []querysql.Option{
+				querysql.WithRowsLogger(querysql.LogrusMSSQLLogger(optionLogger, logrus.InfoLevel)),
+				querysql.WithRowsDispatcher(querysql.GoMSSQLDispatcher([]interface{}{testhelper.TestFunction}).Dispatcher()),
+			},
+			expectedOptionLines: []logrus.Fields{{"x": "underscore key"}},
+			expectedErr:         "",
+		},
+		{
+			name: "nil logger silences logging",
+			opts: []querysql.Option{
+				querysql.WithRowsLogger(nil),
+				querysql.WithRowsDispatcher(querysql.GoMSSQLDispatcher([]interface{}{testhelper.TestFunction}).Dispatcher()),
+			},
+		},
+		{
+			name: "log key",
+			opts: []querysql.Option{
+				querysql.WithRowsLogKey("LogLevel"),
+				querysql.WithRowsDispatcher(querysql.GoMSSQLDispatcher([]interface{}{testhelper.TestFunction}).Dispatcher()),
+			},
+			expectedCtxLines: []logrus.Fields{{"x": "underscore key"}, {"x": "custom key"}},
+		},
+		{
+			name: "all options",
+			opts: []querysql.Option{
+				querysql.WithRowsLogger(querysql.LogrusMSSQLLogger(optionLogger, logrus.InfoLevel)),
+				querysql.WithRowsDispatcher(querysql.GoMSSQLDispatcher([]interface{}{testhelper.TestFunction}).Dispatcher()),
+				querysql.WithRowsLogKey("loglevel"),
+				querysql.WithDoneAfterNext(),
+			},
+			expectedOptionLines: []logrus.Fields{{"x": "underscore key"}, {"x": "custom key"}},
+			expectedErr:         querysql.ErrNotDone.Error(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctxHook.lines, optionHook.lines = nil, nil
+			testhelper.ResetTestFunctionsCalled()
+
+			rs := querysql.New(ctx, sqldb, qry).With(tc.opts...)
+			defer rs.Close()
+			err := querysql.DrainAll(rs)
+			if tc.expectedErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedErr, err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.True(t, testhelper.TestFunctionsCalled["TestFunction"])
+			}
+			assert.Equal(t, tc.expectedCtxLines, ctxHook.lines)
+			assert.Equal(t, tc.expectedOptionLines, optionHook.lines)
+		})
+	}
+}
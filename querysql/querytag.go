@@ -0,0 +1,58 @@
+package querysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const defaultQueryTagField = "query_id"
+
+// logTag is a field added to every entry logged by a ResultSets, see WithQueryName
+type logTag struct {
+	field string
+	value string
+}
+
+// newLogTag returns the tag configured on `ctx` for the query `qry`, or nil
+func newLogTag(ctx context.Context, qry string) *logTag {
+	field, tagged := QueryTag(ctx)
+	name := QueryName(ctx)
+	if !tagged {
+		if name == "" {
+			return nil
+		}
+		field = defaultQueryTagField
+	}
+	if name == "" {
+		hash := sha256.Sum256([]byte(qry))
+		name = hex.EncodeToString(hash[:4])
+	}
+	return &logTag{field: field, value: name}
+}
+
+// addTo returns `set` with the tag added as the second column, after the log level, and whether
+// it was added; it is not if the select has a column of the same name already
+func (tag *logTag) addTo(set *bufferedSet) (*bufferedSet, bool) {
+	for _, col := range set.columns {
+		if col == tag.field {
+			return set, false
+		}
+	}
+	tagged := &bufferedSet{
+		columns:       insertAt(set.columns, 1, tag.field),
+		databaseTypes: insertAt(set.databaseTypes, 1, "NVARCHAR"),
+		rows:          make([][]any, len(set.rows)),
+	}
+	for i, row := range set.rows {
+		tagged.rows[i] = insertAt(row, 1, any(tag.value))
+	}
+	return tagged, true
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	result := make([]T, 0, len(s)+1)
+	result = append(result, s[:i]...)
+	result = append(result, v)
+	return append(result, s[i:]...)
+}
@@ -0,0 +1,70 @@
+package querysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogTag(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, newLogTag(ctx, "select 1"))
+	assert.Equal(t, &logTag{"query_id", "batch"}, newLogTag(WithQueryName(ctx, "batch"), "select 1"))
+	assert.Equal(t, &logTag{"query", "batch"}, newLogTag(WithQueryTag(WithQueryName(ctx, "batch"), "query"), "select 1"))
+	assert.Equal(t, &logTag{"query_id", "822ae07d"}, newLogTag(WithQueryTag(ctx, ""), "select 1"))
+}
+
+func TestLogTag(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	// Other loggers see the tag as an ordinary column
+	var typeNames [][]string
+	recordTypes := func(rows *sql.Rows) error {
+		colTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		var names []string
+		for _, colType := range colTypes {
+			names = append(names, colType.DatabaseTypeName())
+		}
+		typeNames = append(typeNames, names)
+		return nil
+	}
+	rs := &ResultSets{
+		Logger: MultiLogger(SlogMSSQLLogger(slog.New(handler), slog.LevelInfo), recordTypes),
+		logTag: &logTag{"query", "batch"},
+	}
+
+	require.NoError(t, rs.logEntry("info", []string{"x"}, []any{"hello"}))
+	require.NoError(t, rs.logEntry("nosuchlevel", []string{"x"}, []any{"hello"}))
+	// a select that has the field already is not tagged
+	require.NoError(t, rs.logEntry("info", []string{"query"}, []any{"select 1"}))
+	empty := &bufferedSet{columns: []string{"_log", "x"}, databaseTypes: []string{"NVARCHAR", "NVARCHAR"}}
+	rows, err := empty.Rows()
+	require.NoError(t, err)
+	require.NoError(t, rs.logger()(rows))
+	require.NoError(t, rows.Close())
+
+	assert.Equal(t, []string{
+		`level=INFO msg="" query=batch x=hello`,
+		`level=ERROR msg="" invalid.level=nosuchlevel query=batch x=hello`,
+		`level=INFO msg="" query="select 1"`,
+		`level=INFO msg="" _norows=true query=batch x=""`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+	assert.Equal(t, []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"}, typeNames[0])
+	assert.Equal(t, []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"}, typeNames[3])
+}
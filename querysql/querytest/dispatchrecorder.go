@@ -0,0 +1,109 @@
+package querytest
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+// DispatchCall is a row of a dispatcher select recorded by DispatchRecorder
+type DispatchCall struct {
+	// Name is the first column of the select
+	Name string
+	// Args are the other columns. UNIQUEIDENTIFIER columns are given as uuid.UUID, DECIMAL,
+	// NUMERIC and MONEY as float64, and character columns given as bytes as string; the other
+	// columns as returned by the driver. NULL columns are nil.
+	Args []any
+}
+
+// DispatchRecorder records the rows of dispatcher selects calling any function, for asserting
+// that SQL calls the functions it should in tests. Register its Dispatch method as the
+// RowsGoDispatcher in place of e.g. GoMSSQLDispatcher:
+//
+//	calls := querytest.RecordingDispatcher()
+//	ctx := querysql.WithDispatcher(ctx, calls.Dispatch)
+//	...
+//	assert.Equal(t, [][]any{{"payments.captured", int64(1)}}, calls.ArgsOf("RecordMetric"))
+//
+// It is safe to use from several queries concurrently.
+type DispatchRecorder struct {
+	mu    sync.Mutex
+	calls []DispatchCall
+}
+
+// RecordingDispatcher returns a DispatchRecorder that has recorded no calls
+func RecordingDispatcher() *DispatchRecorder {
+	return &DispatchRecorder{}
+}
+
+// Dispatch records the rows of a dispatcher select; it is a querysql.RowsGoDispatcher
+func (r *DispatchRecorder) Dispatch(rows *sql.Rows) error {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	fields := make([]any, len(colTypes))
+	scanPointers := make([]any, len(colTypes))
+	for i := range fields {
+		scanPointers[i] = &fields[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(scanPointers...); err != nil {
+			return err
+		}
+		// Like GoMSSQLDispatcher, `select _function=... where 1=2` is not a call
+		if fields[0] == nil {
+			continue
+		}
+		name, ok := fields[0].(string)
+		if !ok {
+			return fmt.Errorf("first argument to 'select' is expected to be a string. Got '%v' of type '%T' instead", fields[0], fields[0])
+		}
+		call := DispatchCall{Name: name, Args: make([]any, len(fields)-1)}
+		for i := 1; i < len(fields); i++ {
+			if call.Args[i-1], err = querysql.ConvertSQLBytes(fields[i], colTypes[i].DatabaseTypeName()); err != nil {
+				return fmt.Errorf("function '%s', column '%s': %w", name, colTypes[i].Name(), err)
+			}
+		}
+		r.mu.Lock()
+		r.calls = append(r.calls, call)
+		r.mu.Unlock()
+	}
+	return rows.Err()
+}
+
+// Calls returns the calls recorded so far
+func (r *DispatchRecorder) Calls() []DispatchCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]DispatchCall(nil), r.calls...)
+}
+
+// CallsTo returns the calls of the function `name` recorded so far
+func (r *DispatchRecorder) CallsTo(name string) []DispatchCall {
+	var calls []DispatchCall
+	for _, call := range r.Calls() {
+		if call.Name == name {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ArgsOf returns the arguments of the calls of the function `name` recorded so far
+func (r *DispatchRecorder) ArgsOf(name string) [][]any {
+	var args [][]any
+	for _, call := range r.CallsTo(name) {
+		args = append(args, call.Args)
+	}
+	return args
+}
+
+// Reset forgets the calls recorded so far
+func (r *DispatchRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
@@ -0,0 +1,123 @@
+// Package querytest contains helpers for testing code that uses querysql.
+package querytest
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+// LogEntry is an entry logged by a log select
+type LogEntry struct {
+	Level logrus.Level
+	// Message is the value of the `_event` column, if any
+	Message string
+	Fields  logrus.Fields
+}
+
+// LogCollector collects the entries logged by log selects, for asserting on them in tests.
+// Register its Log method as the RowsLogger, e.g.
+//
+//	logs := querytest.NewLogCollector()
+//	ctx := querysql.WithLogger(ctx, logs.Log)
+//	...
+//	logs.AssertContains(t, logrus.Fields{"x": "hello"})
+//
+// The values of the columns are converted as by LogrusMSSQLLogger. It is safe to use from
+// several queries concurrently.
+type LogCollector struct {
+	logger  querysql.RowsLogger
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+// NewLogCollector returns an empty LogCollector. Rows with an invalid level, and empty log
+// selects, are collected at info level. `opts` are passed on to LogrusMSSQLLogger.
+func NewLogCollector(opts ...querysql.LoggerOption) *LogCollector {
+	c := &LogCollector{}
+	logger := &logrus.Logger{
+		Out:       io.Discard,
+		Formatter: collectingFormatter{c},
+		Hooks:     make(logrus.LevelHooks),
+		Level:     logrus.TraceLevel,
+		ExitFunc:  func(int) {},
+	}
+	c.logger = querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel, opts...)
+	return c
+}
+
+// Log collects the entries of a log select; it is a querysql.RowsLogger
+func (c *LogCollector) Log(rows *sql.Rows) error {
+	return c.logger(rows)
+}
+
+// Entries returns the entries collected so far
+func (c *LogCollector) Entries() []LogEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]LogEntry(nil), c.entries...)
+}
+
+// Reset forgets the entries collected so far
+func (c *LogCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+}
+
+// AssertContains fails the test unless an entry has all of `fields`, and returns whether one did
+func (c *LogCollector) AssertContains(t testing.TB, fields logrus.Fields) bool {
+	t.Helper()
+	entries := c.Entries()
+	for _, entry := range entries {
+		if containsFields(entry.Fields, fields) {
+			return true
+		}
+	}
+	t.Errorf("no log entry contains %v; entries:\n%s", fields, formatEntries(entries))
+	return false
+}
+
+func (c *LogCollector) add(entry LogEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, entry)
+}
+
+func containsFields(fields logrus.Fields, expected logrus.Fields) bool {
+	for key, value := range expected {
+		actual, ok := fields[key]
+		if !ok || !reflect.DeepEqual(actual, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatEntries(entries []LogEntry) string {
+	var s string
+	for _, entry := range entries {
+		s += fmt.Sprintf("\t%s %q %v\n", entry.Level, entry.Message, entry.Fields)
+	}
+	return s
+}
+
+// collectingFormatter collects the entries instead of formatting them
+type collectingFormatter struct {
+	c *LogCollector
+}
+
+func (f collectingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	fields := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		fields[key] = value
+	}
+	f.c.add(LogEntry{Level: entry.Level, Message: entry.Message, Fields: fields})
+	return nil, nil
+}
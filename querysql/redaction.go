@@ -0,0 +1,68 @@
+package querysql
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RedactedValue replaces the values of the columns redacted by WithLogRedaction
+const RedactedValue = "[REDACTED]"
+
+// RedactColumns returns a function for WithLogRedaction that matches the column names
+// against the glob patterns `patterns` (as in path.Match), ignoring case. Example:
+//
+//	ctx = querysql.WithLogRedaction(ctx, querysql.RedactColumns("*card*", "password"))
+//
+// It panics if a pattern is malformed.
+func RedactColumns(patterns ...string) func(column string) bool {
+	lowercased := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		lowercased[i] = strings.ToLower(pattern)
+		if _, err := path.Match(lowercased[i], ""); err != nil {
+			panic(fmt.Sprintf("RedactColumns: invalid pattern '%s': %s", pattern, err))
+		}
+	}
+	return func(column string) bool {
+		column = strings.ToLower(column)
+		for _, pattern := range lowercased {
+			if matched, _ := path.Match(pattern, column); matched {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// redactSet returns `set` with the values of the columns for which `redact` returns
+// true replaced by RedactedValue, and the names of those columns. The log level in the first
+// column is never redacted. The columns keep their types; the loggers of this package learn
+// which columns are redacted from logSetInfo.
+func redactSet(set *bufferedSet, redact func(column string) bool) (*bufferedSet, map[string]bool) {
+	var redactedColumns []int
+	for i, col := range set.columns {
+		if i > 0 && redact(col) {
+			redactedColumns = append(redactedColumns, i)
+		}
+	}
+	if len(redactedColumns) == 0 {
+		return set, nil
+	}
+
+	redacted := &bufferedSet{
+		columns:       set.columns,
+		databaseTypes: set.databaseTypes,
+		rows:          make([][]any, len(set.rows)),
+	}
+	names := make(map[string]bool, len(redactedColumns))
+	for _, i := range redactedColumns {
+		names[set.columns[i]] = true
+	}
+	for i, row := range set.rows {
+		redacted.rows[i] = append([]any(nil), row...)
+		for _, j := range redactedColumns {
+			redacted.rows[i][j] = RedactedValue
+		}
+	}
+	return redacted, names
+}
@@ -0,0 +1,56 @@
+package querysql
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactColumns(t *testing.T) {
+	redact := RedactColumns("*card*", "Password")
+	assert.True(t, redact("CardNumber"))
+	assert.True(t, redact("creditcard"))
+	assert.True(t, redact("password"))
+	assert.False(t, redact("passwords"))
+	assert.False(t, redact("x"))
+
+	assert.PanicsWithValue(t, "RedactColumns: invalid pattern '[': syntax error in pattern", func() {
+		RedactColumns("[")
+	})
+}
+
+func TestLogRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	// Other loggers see the redacted columns with their types
+	var typeNames []string
+	recordTypes := func(rows *sql.Rows) error {
+		colTypes, err := rows.ColumnTypes()
+		for _, colType := range colTypes {
+			typeNames = append(typeNames, colType.DatabaseTypeName())
+		}
+		return err
+	}
+	rs := &ResultSets{
+		Logger: MultiLogger(StdMSSQLLogger(log.New(&buf, "", 0)), recordTypes),
+		redact: RedactColumns("*card*", "_log"),
+		logTag: &logTag{"query_id", "batch"},
+	}
+
+	require.NoError(t, rs.logEntry("info", []string{"x", "CardNumber", "CardBlocked"}, []any{"hello", "4925000000000004", true}))
+	assert.Equal(t, []string{"NVARCHAR", "NVARCHAR", "NVARCHAR", "NVARCHAR", "BIT"}, typeNames)
+	empty := &bufferedSet{columns: []string{"_log", "x", "CardNumber"}, databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"}}
+	rows, err := empty.Rows()
+	require.NoError(t, err)
+	require.NoError(t, rs.logger()(rows))
+	require.NoError(t, rows.Close())
+
+	assert.Equal(t, []string{
+		`level=info query_id=batch x=hello CardNumber=[REDACTED] CardBlocked=[REDACTED]`,
+		`level=info _norows=true query_id=batch x="" CardNumber=[REDACTED]`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
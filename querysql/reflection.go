@@ -7,11 +7,13 @@ import (
 	"strings"
 )
 
-func getPointersToFields(rows *sql.Rows, pointerToStruct interface{}) ([]interface{}, error) {
+// getPointersToFields returns pointers to the fields of the struct to scan each column of `rows`
+// into, and the names of those fields
+func getPointersToFields(rows *sql.Rows, pointerToStruct interface{}) ([]interface{}, []string, error) {
 	// Gets the names of columns in the query
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for i, name := range columns {
 		columns[i] = canonicalName(name)
@@ -19,6 +21,7 @@ func getPointersToFields(rows *sql.Rows, pointerToStruct interface{}) ([]interfa
 
 	// Get the names of struct fields, recursing into embedded structs
 	names := DeepFieldNames(pointerToStruct)
+	fieldNames := append([]string(nil), names...)
 	for i, name := range names {
 		names[i] = canonicalName(name)
 	}
@@ -40,7 +43,7 @@ func getPointersToFields(rows *sql.Rows, pointerToStruct interface{}) ([]interfa
 	for _, col := range columns {
 		if j, ok := name2index[col]; ok {
 			ptrs = append(ptrs, origPtrs[j])
-			mappedNames = append(mappedNames, names[j])
+			mappedNames = append(mappedNames, fieldNames[j])
 			n++
 		}
 	}
@@ -48,15 +51,15 @@ func getPointersToFields(rows *sql.Rows, pointerToStruct interface{}) ([]interfa
 	// Demand that all fields in struct gets filled
 	if n != len(names) {
 		diff := stringSliceDiff(names, columns)
-		return nil, fmt.Errorf("failed to map all struct fields to query columns (names: %v, columns: %v, diff: %v)", names, columns, diff)
+		return nil, nil, fmt.Errorf("failed to map all struct fields to query columns (names: %v, columns: %v, diff: %v)", names, columns, diff)
 	}
 
 	// Demand that all query columns gets scanned
 	if len(columns) > len(ptrs) {
 		diff := stringSliceDiff(names, columns)
-		return nil, fmt.Errorf("failed to map all query columns to struct fields (names: %v, columns: %v, diff: %v)", names, columns, diff)
+		return nil, nil, fmt.Errorf("failed to map all query columns to struct fields (names: %v, columns: %v, diff: %v)", names, columns, diff)
 	}
-	return ptrs, nil
+	return ptrs, mappedNames, nil
 }
 
 func stringSliceDiff(a, b []string) map[string]int {
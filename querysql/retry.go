@@ -0,0 +1,125 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"syscall"
+)
+
+type retryPolicy struct {
+	retries     int
+	isTransient func(error) bool
+}
+
+// IsTransientError reports whether err is a connection level error, such as a stale pooled
+// connection or a connection reset, that is typically resolved by simply running the query again.
+// It is the default classification used by WithRetry; to extend it, pass a function to WithRetry
+// that calls IsTransientError in addition to your own checks.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// Some driver errors only carry the underlying cause as text
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe")
+}
+
+// WithRetry returns a context that makes New retry the query up to `retries` times if it
+// fails with an error that `isTransient` classifies as transient. If `isTransient` is nil,
+// IsTransientError is used. Errors classified by IsTimeoutOrCanceled are never retried.
+//
+// Only a failing call to QueryContext is retried; once results have started streaming,
+// errors are returned as usual. Note that the server may have started executing the query
+// before the connection failed, so only use this for queries that are safe to run twice.
+func WithRetry(ctx context.Context, retries int, isTransient func(error) bool) context.Context {
+	if isTransient == nil {
+		isTransient = IsTransientError
+	}
+	return context.WithValue(ctx, ckRetryPolicy, retryPolicy{retries: retries, isTransient: isTransient})
+}
+
+func getRetryPolicy(ctx context.Context) (retryPolicy, bool) {
+	p, ok := ctx.Value(ckRetryPolicy).(retryPolicy)
+	return p, ok
+}
+
+// queryContext calls querier.QueryContext, retrying according to the policy set by WithRetry
+func queryContext(ctx context.Context, querier CtxQuerier, qry string, args ...any) (*sql.Rows, error) {
+	rows, err := querier.QueryContext(ctx, qry, args...)
+	policy, ok := getRetryPolicy(ctx)
+	if !ok {
+		return rows, err
+	}
+	// A query that timed out or was cancelled has spent the time it was given, so it is not retried
+	for attempt := 0; err != nil && attempt < policy.retries && ctx.Err() == nil && !IsTimeoutOrCanceled(err) && policy.isTransient(err); attempt++ {
+		rows, err = querier.QueryContext(ctx, qry, args...)
+	}
+	return rows, err
+}
+
+// IsRetryableTxError reports whether a transaction that failed with `err` may succeed if it is
+// run again from the start: SQL Server chose it as a deadlock victim, it failed on a snapshot
+// isolation update conflict, or waiting for a lock timed out; or it failed on the connection,
+// see IsTransientError. Errors that can never succeed, e.g. syntax errors and constraint
+// violations, are not retryable, and neither is io.EOF, which the function run in the transaction
+// may return for reasons that have nothing to do with the connection. It is the default
+// classification used by RetryTransactional.
+func IsRetryableTxError(err error) bool {
+	return IsMssqlError(err, MssqlErrorDeadlockVictim, MssqlErrorSnapshotConflict, MssqlErrorLockTimeout) ||
+		(IsTransientError(err) && !errors.Is(err, io.EOF))
+}
+
+// RetryTransactional runs `f` in a transaction on `db`, which is committed if `f` returns nil and
+// rolled back otherwise. If beginning or running the transaction fails with an error that
+// `isRetryable` classifies as retryable, all of it is run again, up to `retries` times; other
+// errors are returned right away. If `isRetryable` is nil, IsRetryableTxError is used. As `f` may
+// be called several times, it must not have side effects outside the transaction.
+//
+// Errors from committing the transaction are never retried, since the transaction may have been
+// committed even if the commit failed, e.g. if the connection broke while waiting for the reply.
+// Neither are errors matching IsDataTruncationError or IsConversionError, whatever `isRetryable`
+// says, as running the same transaction again fails the same way.
+func RetryTransactional(ctx context.Context, db *sql.DB, retries int, isRetryable func(error) bool, f func(tx CtxQuerier) error) error {
+	if isRetryable == nil {
+		isRetryable = IsRetryableTxError
+	}
+	committing, err := runTransactional(ctx, db, f)
+	for attempt := 0; err != nil && !committing && attempt < retries && ctx.Err() == nil && isRetryableTx(err, isRetryable); attempt++ {
+		committing, err = runTransactional(ctx, db, f)
+	}
+	return err
+}
+
+// isRetryableTx tells whether `err` is classified as retryable by `isRetryable`, and is not a
+// truncation or conversion error
+func isRetryableTx(err error, isRetryable func(error) bool) bool {
+	return !IsDataTruncationError(err) && !IsConversionError(err) && isRetryable(err)
+}
+
+// runTransactional runs `f` in a transaction on `db`, committing it if `f` returns nil. It also
+// returns whether the error, if any, is that of the commit.
+func runTransactional(ctx context.Context, db *sql.DB, f func(tx CtxQuerier) error) (committing bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	// Rollback is a no-op after Commit. The transaction may also already be rolled back by
+	// SQL Server, e.g. for a deadlock victim; the error of `f` is the one to return in any case.
+	defer func() { _ = tx.Rollback() }()
+	if err = f(tx); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,265 @@
+package querysql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+// flakyQuerier fails the first `failures` calls to QueryContext with `err`
+type flakyQuerier struct {
+	querysql.CtxQuerier
+	failures int
+	err      error
+	calls    int
+}
+
+func (q *flakyQuerier) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	q.calls++
+	if q.calls <= q.failures {
+		return nil, q.err
+	}
+	return q.CtxQuerier.QueryContext(ctx, query, args...)
+}
+
+func TestIsTransientError(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{driver.ErrBadConn, true},
+		{fmt.Errorf("wrapped: %w", driver.ErrBadConn), true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{errors.New("read tcp 127.0.0.1:1433: connection reset by peer"), true},
+		{sql.ErrNoRows, false},
+		{mssql.Error{Number: 2627, Message: "Violation of PRIMARY KEY constraint"}, false},
+	} {
+		t.Run(fmt.Sprintf("%v", tc.err), func(t *testing.T) {
+			assert.Equal(t, tc.expected, querysql.IsTransientError(tc.err))
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	ctx := querysql.WithRetry(context.Background(), 2, nil)
+
+	// Fails twice, then succeeds on the last retry
+	q := &flakyQuerier{CtxQuerier: sqldb, failures: 2, err: driver.ErrBadConn}
+	v, err := querysql.Single[int](ctx, q, `select 1`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 3, q.calls)
+
+	// Gives up after the configured number of retries
+	q = &flakyQuerier{CtxQuerier: sqldb, failures: 3, err: driver.ErrBadConn}
+	_, err = querysql.Single[int](ctx, q, `select 1`)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, 3, q.calls)
+
+	// No retries unless asked for
+	q = &flakyQuerier{CtxQuerier: sqldb, failures: 1, err: driver.ErrBadConn}
+	_, err = querysql.Single[int](context.Background(), q, `select 1`)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, 1, q.calls)
+
+	// Errors that are not transient are not retried
+	otherErr := errors.New("not transient")
+	q = &flakyQuerier{CtxQuerier: sqldb, failures: 1, err: otherErr}
+	_, err = querysql.Single[int](ctx, q, `select 1`)
+	assert.ErrorIs(t, err, otherErr)
+	assert.Equal(t, 1, q.calls)
+
+	// The classification can be extended
+	ctx = querysql.WithRetry(context.Background(), 2, func(err error) bool {
+		return querysql.IsTransientError(err) || err == otherErr
+	})
+	q = &flakyQuerier{CtxQuerier: sqldb, failures: 1, err: otherErr}
+	v, err = querysql.Single[int](ctx, q, `select 1`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.Equal(t, 2, q.calls)
+
+	// Timeouts are not retried, even if classified as transient
+	ctx = querysql.WithRetry(context.Background(), 2, func(err error) bool { return true })
+	q = &flakyQuerier{CtxQuerier: sqldb, failures: 1, err: timeoutError{}}
+	_, err = querysql.Single[int](ctx, q, `select 1`)
+	assert.ErrorIs(t, err, timeoutError{})
+	assert.Equal(t, 1, q.calls)
+}
+
+// timeoutError is a net.Error timing out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "read tcp 127.0.0.1:1433: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTimeoutOrCanceled(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{context.Canceled, true},
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), true},
+		{&querysql.ResultSetError{Index: 2, Err: context.Canceled}, true},
+		{timeoutError{}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{&querysql.QueryError{Query: "select 1", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}}, true},
+		{errors.New("mssql: failed to send SQL Batch: write tcp 127.0.0.1:1433: i/o timeout"), true},
+		{mssql.Error{Number: querysql.MssqlErrorLockTimeout, Message: "Lock request time out period exceeded."}, false},
+		{mssql.Error{Number: querysql.MssqlErrorDeadlockVictim, Message: "deadlock victim"}, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, false},
+		{driver.ErrBadConn, false},
+	} {
+		t.Run(fmt.Sprintf("%v", tc.err), func(t *testing.T) {
+			assert.Equal(t, tc.expected, querysql.IsTimeoutOrCanceled(tc.err))
+		})
+	}
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{mssql.Error{Number: querysql.MssqlErrorDeadlockVictim}, true},
+		{mssql.Error{Number: querysql.MssqlErrorSnapshotConflict}, true},
+		{&querysql.QueryError{Query: "update T", Err: mssql.Error{Number: querysql.MssqlErrorLockTimeout}}, true},
+		{driver.ErrBadConn, true},
+		{io.ErrUnexpectedEOF, true},
+		{io.EOF, false},
+		{fmt.Errorf("reading input: %w", io.EOF), false},
+		{mssql.Error{Number: 2627, Message: "Violation of PRIMARY KEY constraint"}, false},
+		{mssql.Error{Number: 102, Message: "Incorrect syntax near 'selec'."}, false},
+		{mssql.Error{Number: querysql.MssqlErrorConstraintViolation}, false},
+		{context.Canceled, false},
+	} {
+		t.Run(fmt.Sprintf("%v", tc.err), func(t *testing.T) {
+			assert.Equal(t, tc.expected, querysql.IsRetryableTxError(tc.err))
+		})
+	}
+}
+
+func TestRetryTransactional(t *testing.T) {
+	ctx := context.Background()
+	_, err := querysql.ExecContext(ctx, sqldb, `
+if object_id('dbo.RetryTx', 'U') is not null drop table RetryTx;
+create table RetryTx (ID int primary key);
+`)
+	require.NoError(t, err)
+
+	// A deadlock is retried, and the transaction committed once it succeeds
+	attempts := 0
+	err = querysql.RetryTransactional(ctx, sqldb, 2, nil, func(tx querysql.CtxQuerier) error {
+		attempts++
+		if _, err := querysql.ExecContext(ctx, tx, `insert into RetryTx (ID) values (1)`); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return mssql.Error{Number: querysql.MssqlErrorDeadlockVictim, Message: "deadlock victim"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 1, querysql.MustSingle[int](ctx, sqldb, `select count(*) from RetryTx`))
+
+	// A unique key violation can never succeed, so it is not retried
+	attempts = 0
+	err = querysql.RetryTransactional(ctx, sqldb, 2, nil, func(tx querysql.CtxQuerier) error {
+		attempts++
+		_, err := querysql.ExecContext(ctx, tx, `insert into RetryTx (ID) values (1)`)
+		return err
+	})
+	assert.True(t, querysql.IsUniqueKeyOrIndexViolatedError(err))
+	assert.Equal(t, 1, attempts)
+
+	// The classification can be overridden
+	attempts = 0
+	errFailed := errors.New("failed")
+	err = querysql.RetryTransactional(ctx, sqldb, 2, func(err error) bool { return err == errFailed },
+		func(tx querysql.CtxQuerier) error {
+			attempts++
+			return errFailed
+		})
+	assert.Equal(t, errFailed, err)
+	assert.Equal(t, 3, attempts)
+
+	// A failing commit is not retried, even if classified as retryable, as it may have committed
+	attempts = 0
+	err = querysql.RetryTransactional(ctx, sqldb, 2, func(err error) bool { return true },
+		func(tx querysql.CtxQuerier) error {
+			attempts++
+			// Ends the transaction behind the back of database/sql, so that Commit fails
+			_, err := querysql.ExecContext(ctx, tx, `commit transaction`)
+			return err
+		})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+// txConnector opens connections whose transactions do nothing, for running RetryTransactional
+// without a database
+type txConnector struct{}
+
+func (txConnector) Connect(context.Context) (driver.Conn, error) { return txConn{}, nil }
+func (txConnector) Driver() driver.Driver                        { return nil }
+
+type txConn struct{}
+
+func (txConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("txConn: Prepare not supported")
+}
+func (txConn) Close() error              { return nil }
+func (txConn) Begin() (driver.Tx, error) { return txConn{}, nil }
+func (txConn) Commit() error             { return nil }
+func (txConn) Rollback() error           { return nil }
+
+func TestRetryTransactionalNeverRetried(t *testing.T) {
+	db := sql.OpenDB(txConnector{})
+	defer db.Close()
+
+	for _, tc := range []struct {
+		err      error
+		expected func(error) bool
+	}{
+		{mssql.Error{Number: querysql.MssqlErrorStringTruncated, Message: "String or binary data would be truncated."}, querysql.IsDataTruncationError},
+		{mssql.Error{Number: querysql.MssqlErrorConversionFailed, Message: "Conversion failed."}, querysql.IsConversionError},
+	} {
+		// even if classified as retryable
+		for _, isRetryable := range []func(error) bool{nil, func(err error) bool { return true }} {
+			attempts := 0
+			err := querysql.RetryTransactional(context.Background(), db, 2, isRetryable, func(tx querysql.CtxQuerier) error {
+				attempts++
+				return tc.err
+			})
+			assert.True(t, tc.expected(err))
+			assert.Equal(t, 1, attempts)
+		}
+	}
+
+	// other errors classified as retryable are retried
+	attempts := 0
+	err := querysql.RetryTransactional(context.Background(), db, 2, func(err error) bool { return true }, func(tx querysql.CtxQuerier) error {
+		attempts++
+		return mssql.Error{Number: querysql.MssqlErrorConstraintViolation}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, attempts)
+}
@@ -2,7 +2,11 @@ package querysql
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
 )
 
 type QuerySqlError struct {
@@ -14,6 +18,31 @@ var ManyRowsExpectedOne = QuerySqlError{
 	fmtString: "query: more than 1 row (use sliceScanner?)",
 }
 
+// maxCountedRows is the number of rows counted for ManyRowsError
+const maxCountedRows = 1000
+
+// ManyRowsError is returned when a single row was expected but the result set had more. It tells
+// how many rows there were, to help telling e.g. a missing where clause from duplicated data.
+// errors.Is(err, ManyRowsExpectedOne) is true for it.
+type ManyRowsError struct {
+	// Rows is the number of rows in the result set, counted up to 1000
+	Rows int
+	// MoreRows is set if the result set had more than Rows rows
+	MoreRows bool
+}
+
+func (e ManyRowsError) Error() string {
+	if e.MoreRows {
+		return fmt.Sprintf("query: %d+ rows, expected 1 (use sliceScanner?)", e.Rows)
+	}
+	return fmt.Sprintf("query: %d rows, expected 1 (use sliceScanner?)", e.Rows)
+}
+
+func (e ManyRowsError) Is(other error) bool {
+	t, ok := other.(QuerySqlError)
+	return ok && t.fmtString == ManyRowsExpectedOne.fmtString
+}
+
 var ZeroRowsExpectedOne = QuerySqlError{
 	fmtString: "query: 0 rows, expected 1: %w",
 }
@@ -22,21 +51,19 @@ func (e QuerySqlError) Error() string {
 	return fmt.Sprintf(e.fmtString, e.underlyingErr)
 }
 
+// Is tells whether `other` is the same kind of error as `e`, e.g. ZeroRowsExpectedOne, or the
+// underlying error of `e`. QuerySqlError is always used as a value, never as a pointer.
 func (e QuerySqlError) Is(other error) bool {
 	t, ok := other.(QuerySqlError)
 	if !ok {
-		// Check if the underlying error matches
-		if e.underlyingErr == nil {
-			return false
-		}
-		return e.underlyingErr.Error() == other.Error()
+		return e.underlyingIs(other)
 	}
 
 	if e.fmtString != t.fmtString {
 		return false
 	}
 
-	// At this point `e` and `other` are ZeroRowsExpectedOne errors
+	// At this point `e` and `other` are the same kind of error, e.g. ZeroRowsExpectedOne errors
 	//
 	// Note that querysql.ZeroRowsExpectedOne is a var with underlyingErr to nul
 	// This var captures a generic ZeroRowsExpectedOne
@@ -51,19 +78,63 @@ func (e QuerySqlError) Is(other error) bool {
 	// have an underlyingErr set).  So we expect:
 	//
 	// false: err.Is(querysql.ZeroRowsExpectedOne, specificZeroRowsExpectedOne)
-	return t.underlyingErr == nil || e.underlyingErr == t.underlyingErr
+	return t.underlyingErr == nil || e.underlyingIs(t.underlyingErr)
+}
+
+// underlyingIs tells whether the underlying error is, or wraps, `target`
+func (e QuerySqlError) underlyingIs(target error) bool {
+	return e.underlyingErr != nil && wrapsError(e.underlyingErr, target)
+}
+
+// wrapsError tells whether `err` is, or wraps, `target`. Errors of SQL Server such as mssql.Error
+// can not be compared with ==, so they are compared by number.
+func wrapsError(err, target error) bool {
+	if errors.Is(err, target) {
+		return true
+	}
+	sqlErr, ok := target.(mssqlError)
+	return ok && IsMssqlError(err, sqlErr.SQLErrorNumber())
 }
 
 func (e QuerySqlError) Unwrap() error {
 	return e.underlyingErr
 }
 
+// Underlying returns the error that caused `e`, e.g. the error of the driver that ended the
+// result set early for ZeroRowsExpectedOne, or sql.ErrNoRows if there was none; it is nil for the
+// generic errors ZeroRowsExpectedOne and ManyRowsExpectedOne. Use it after errors.As:
+//
+//	var qerr querysql.QuerySqlError
+//	if errors.As(err, &qerr) && qerr.Underlying() != sql.ErrNoRows { ... }
+func (e QuerySqlError) Underlying() error {
+	return e.underlyingErr
+}
+
 var _ error = QuerySqlError{} // Make sure QuerySqlError implements the error interface
 
 type Target interface {
 	ScanRow(*sql.Rows) error
 }
 
+// ErrScannerReuse is returned when a Target created by SingleInto, SliceInto, SingleOf, SliceOf
+// or Call is used to read a second result set. Such a Target keeps state from the result set it
+// read, such as whether a row was read and the mapping of its columns to struct fields; create a
+// new one for each result set.
+var ErrScannerReuse = fmt.Errorf("a Target can only be used for a single result set; create a new one for each result set")
+
+// boundTarget is implemented by the Targets that must only be used for a single result set
+type boundTarget interface {
+	// bind is called before reading the result set at `index` of `rs` with the Target
+	bind(rs *ResultSets, index int) error
+}
+
+// setEnder is implemented by the Targets that report an error after having read the complete
+// result set, see Lenient
+type setEnder interface {
+	// endSet is called after the last row of the result set was passed to ScanRow
+	endSet() error
+}
+
 type errorWrapper func(error) error
 
 type Result[T any] interface {
@@ -76,6 +147,22 @@ type RowScanner[T any] struct {
 	init         bool
 	target       *T
 	scanPointers []any
+	// fieldNames are the names of the struct fields the columns are scanned into, if T is a struct
+	fieldNames []string
+	// rowIndex is the zero-based index of the row to scan next within the result set
+	rowIndex int
+	// boundTo and boundIndex are the ResultSets and the result set the scanner is used with
+	boundTo    *ResultSets
+	boundIndex int
+}
+
+func (scanner *RowScanner[T]) bind(rs *ResultSets, index int) error {
+	if scanner.boundTo != nil && (scanner.boundTo != rs || scanner.boundIndex != index) {
+		return ErrScannerReuse
+	}
+	scanner.boundTo = rs
+	scanner.boundIndex = index
+	return nil
 }
 
 // scanRow calls rows.Scan to populate scanner.row
@@ -89,7 +176,7 @@ func (scanner *RowScanner[T]) scanRow(rows *sql.Rows) error {
 		}
 		if scanner.isStruct {
 			var err error
-			scanner.scanPointers, err = getPointersToFields(rows, scanner.target)
+			scanner.scanPointers, scanner.fieldNames, err = getPointersToFields(rows, scanner.target)
 			if err != nil {
 				return err
 			}
@@ -98,12 +185,45 @@ func (scanner *RowScanner[T]) scanRow(rows *sql.Rows) error {
 		}
 	}
 
+	// Count the row also if it fails, so that the following rows get the right index with Lenient
+	scanner.rowIndex++
 	if err := rows.Scan(scanner.scanPointers...); err != nil {
-		return err
+		return scanner.scanError(scanner.rowIndex-1, err)
 	}
 	return nil
 }
 
+// scanErrorColumnIndex finds the index of the failing column in errors from rows.Scan;
+// database/sql has it in the error text only
+var scanErrorColumnIndex = regexp.MustCompile(`^sql: Scan error on column index (\d+)`)
+
+// RowError is returned when scanning a row of a result set fails, e.g. because a value can not
+// be converted to the type scanned into. Err tells the type and struct field scanned into.
+type RowError struct {
+	// RowIndex is the zero-based index of the row within the result set
+	RowIndex int
+	Err      error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row index %d: %s", e.RowIndex, e.Err.Error())
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// scanError returns a RowError for an error from rows.Scan, adding the type and field scanned into
+func (scanner *RowScanner[T]) scanError(rowIndex int, err error) error {
+	typeName := reflect.TypeOf(scanner.target).Elem().String()
+	if match := scanErrorColumnIndex.FindStringSubmatch(err.Error()); match != nil && scanner.isStruct {
+		if index, convErr := strconv.Atoi(match[1]); convErr == nil && index < len(scanner.fieldNames) {
+			return RowError{RowIndex: rowIndex, Err: fmt.Errorf("scanning into field %s of %s: %w", scanner.fieldNames[index], typeName, err)}
+		}
+	}
+	return RowError{RowIndex: rowIndex, Err: fmt.Errorf("scanning into %s: %w", typeName, err)}
+}
+
 //
 // single values
 //
@@ -152,7 +272,7 @@ func (rv *singleScanner[T]) Result() (T, errorWrapper) {
 
 func (rv *singleScanner[T]) ScanRow(rows *sql.Rows) error {
 	if rv.hasRead {
-		return ManyRowsExpectedOne
+		return countManyRows(rows)
 	}
 	if err := rv.scanRow(rows); err != nil {
 		return err
@@ -161,6 +281,23 @@ func (rv *singleScanner[T]) ScanRow(rows *sql.Rows) error {
 	return nil
 }
 
+// countManyRows returns a ManyRowsError after reading the rest of the rows of the result set,
+// without scanning them, to count them. The current row is the second.
+func countManyRows(rows *sql.Rows) error {
+	manyRows := ManyRowsError{Rows: 2}
+	for rows.Next() {
+		if manyRows.Rows == maxCountedRows {
+			manyRows.MoreRows = true
+			break
+		}
+		manyRows.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return manyRows
+}
+
 //
 // slices
 //
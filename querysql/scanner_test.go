@@ -0,0 +1,88 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuerySqlErrorIs(t *testing.T) {
+	driverErr := mssql.Error{Number: 50000, Message: "failed", All: []mssql.Error{{Number: 50000, Message: "failed"}}}
+	noRows := QuerySqlError{fmtString: ZeroRowsExpectedOne.fmtString, underlyingErr: sql.ErrNoRows}
+	failed := QuerySqlError{fmtString: ZeroRowsExpectedOne.fmtString, underlyingErr: &QueryError{Err: driverErr}}
+
+	for _, tc := range []struct {
+		err, target error
+		expected    bool
+	}{
+		{noRows, ZeroRowsExpectedOne, true},
+		{ZeroRowsExpectedOne, noRows, false},
+		{noRows, ManyRowsExpectedOne, false},
+		{noRows, noRows, true},
+		{noRows, failed, false},
+		{noRows, sql.ErrNoRows, true},
+		{failed, driverErr, true},
+		{failed, sql.ErrNoRows, false},
+		{failed, mssql.Error{Number: 50000, Message: "other message"}, true},
+		{failed, mssql.Error{Number: 50001, Message: "failed"}, false},
+		// errors are not compared by message
+		{QuerySqlError{fmtString: ZeroRowsExpectedOne.fmtString, underlyingErr: errors.New("EOF")}, io.EOF, false},
+		{QuerySqlError{fmtString: ZeroRowsExpectedOne.fmtString, underlyingErr: errors.New("failed")}, errors.New("failed"), false},
+		{fmt.Errorf("wrapped: %w", failed), ZeroRowsExpectedOne, true},
+		{ManyRowsError{Rows: 2}, ManyRowsExpectedOne, true},
+		{ManyRowsError{Rows: 2}, ZeroRowsExpectedOne, false},
+	} {
+		assert.Equal(t, tc.expected, errors.Is(tc.err, tc.target), "errors.Is(%v, %v)", tc.err, tc.target)
+	}
+}
+
+func TestQuerySqlErrorAs(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", QuerySqlError{fmtString: ZeroRowsExpectedOne.fmtString, underlyingErr: sql.ErrNoRows})
+	var qerr QuerySqlError
+	require.True(t, errors.As(err, &qerr))
+	assert.Equal(t, sql.ErrNoRows, qerr.Underlying())
+	assert.Nil(t, ZeroRowsExpectedOne.Underlying())
+}
+
+func TestScannerReuse(t *testing.T) {
+	set := &bufferedSet{columns: []string{"x"}, databaseTypes: []string{"INT"}, rows: [][]any{{int64(1)}}}
+	var x int
+	target := SingleInto(&x)
+	require.NoError(t, Next(New(context.Background(), bufferedDB, "buffered set", set), target))
+	assert.Equal(t, 1, x)
+
+	// The target has read a row already, and would report ManyRowsExpectedOne
+	err := Next(New(context.Background(), bufferedDB, "buffered set", set), target)
+	assert.ErrorIs(t, err, ErrScannerReuse)
+	assert.EqualError(t, err, "result set 0: "+ErrScannerReuse.Error())
+
+	// Targets from the factories are used once each, so they are never reused
+	typ := SliceOf[int]
+	for i := 0; i < 2; i++ {
+		v, err := NextResult(New(context.Background(), bufferedDB, "buffered set", set), typ)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1}, v)
+	}
+}
+
+func TestMustNextResultPanicErrorPointer(t *testing.T) {
+	set := &bufferedSet{columns: []string{"x"}, databaseTypes: []string{"INT"}}
+	rs := New(context.Background(), bufferedDB, "buffered set", set)
+	defer func() {
+		err, ok := recover().(error)
+		require.True(t, ok)
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		assert.Equal(t, 0, panicErr.ResultSetIndex)
+		assert.Equal(t, "buffered set", panicErr.Query)
+		assert.ErrorIs(t, err, ZeroRowsExpectedOne)
+	}()
+	MustNextResult(rs, SingleOf[int])
+}
@@ -0,0 +1,140 @@
+package querysql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExecScript executes a script consisting of several batches separated by `GO` on a line
+// of its own, as used by e.g. sqlcmd and SSMS. Like there, `GO 5` executes the batch 5 times,
+// and the line may end with a -- comment. Each batch is executed with ExecContext,
+// passing `args` to every batch, so that logging and dispatcher selects inside the
+// batches are processed. Execution stops at the first failing batch; the error
+// tells the number of the batch and its first line.
+func ExecScript(ctx context.Context, querier CtxQuerier, script string, args ...any) error {
+	for i, batch := range splitBatches(script) {
+		if isBlankSQL(batch) {
+			continue
+		}
+		if _, err := ExecContext(ctx, querier, batch, args...); err != nil {
+			return fmt.Errorf("batch %d (%s): %w", i+1, firstLine(batch), err)
+		}
+	}
+	return nil
+}
+
+// splitBatches splits `script` on lines consisting only of `GO`, optionally followed by a count
+// and a -- comment; ignoring such lines inside string literals, quoted identifiers and comments.
+// A batch followed by `GO n` is repeated n times.
+func splitBatches(script string) []string {
+	var batches []string
+	start := 0
+	// blockComments is the nesting depth of /* */ comments
+	blockComments := 0
+	i := 0
+	for i < len(script) {
+		if blockComments > 0 {
+			switch {
+			case strings.HasPrefix(script[i:], "/*"):
+				blockComments++
+				i += 2
+			case strings.HasPrefix(script[i:], "*/"):
+				blockComments--
+				i += 2
+			default:
+				i++
+			}
+			continue
+		}
+
+		if i == 0 || script[i-1] == '\n' {
+			lineEnd := strings.IndexByte(script[i:], '\n')
+			if lineEnd == -1 {
+				lineEnd = len(script)
+			} else {
+				lineEnd += i
+			}
+			if count, ok := parseGoLine(script[i:lineEnd]); ok {
+				for n := 0; n < count; n++ {
+					batches = append(batches, script[start:i])
+				}
+				i = lineEnd
+				if i < len(script) {
+					i++
+				}
+				start = i
+				continue
+			}
+		}
+
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '[':
+			i = skipQuoted(script, i)
+		case strings.HasPrefix(script[i:], "--"):
+			lineEnd := strings.IndexByte(script[i:], '\n')
+			if lineEnd == -1 {
+				i = len(script)
+			} else {
+				i += lineEnd
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			blockComments++
+			i += 2
+		default:
+			i++
+		}
+	}
+	return append(batches, script[start:])
+}
+
+// parseGoLine tells whether `line` is a batch separator, `GO` optionally followed by a positive
+// count and a -- comment, and returns the count, which is 1 if not given
+func parseGoLine(line string) (count int, ok bool) {
+	if comment := strings.Index(line, "--"); comment != -1 {
+		line = line[:comment]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 || !strings.EqualFold(fields[0], "go") {
+		return 0, false
+	}
+	if len(fields) == 1 {
+		return 1, true
+	}
+	count, err := strconv.Atoi(fields[1])
+	if err != nil || count < 1 {
+		return 0, false
+	}
+	return count, true
+}
+
+// skipQuoted returns the index after the string literal or quoted identifier starting at
+// `script[i]`; a doubled closing quote is an escaped quote
+func skipQuoted(script string, i int) int {
+	closing := script[i]
+	if closing == '[' {
+		closing = ']'
+	}
+	i++
+	for i < len(script) {
+		if script[i] == closing {
+			if i+1 < len(script) && script[i+1] == closing {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+func firstLine(batch string) string {
+	for _, line := range strings.Split(batch, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package querysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitBatches(t *testing.T) {
+	assert.Equal(t, []string{"select 1\n", "select 2\n", ""}, splitBatches("select 1\nGO\nselect 2\n  go  \n"))
+	assert.Equal(t, []string{"", "select 1"}, splitBatches("go\nselect 1"))
+	assert.Equal(t, []string{"select 'a\ngo\nb'\n", "select 2"}, splitBatches("select 'a\ngo\nb'\ngo\nselect 2"))
+	assert.Equal(t, []string{"select 'it''s'\n", "select 2"}, splitBatches("select 'it''s'\nGO\nselect 2"))
+	assert.Equal(t, []string{"select [a\ngo\n]]b]\n", "x"}, splitBatches("select [a\ngo\n]]b]\ngo\nx"))
+	assert.Equal(t, []string{"/* /* nested\ngo\n*/\ngo\n */ select 1"}, splitBatches("/* /* nested\ngo\n*/\ngo\n */ select 1"))
+	assert.Equal(t, []string{"-- comment 'go\ngo_on\n", "select 1"}, splitBatches("-- comment 'go\ngo_on\ngo\nselect 1"))
+	assert.Equal(t, []string{"select 1 -- go\n"}, splitBatches("select 1 -- go\n"))
+}
+
+func TestSplitBatchesGoLine(t *testing.T) {
+	for _, tc := range []struct {
+		script   string
+		expected []string
+	}{
+		{"select 1\nGO 3\nselect 2", []string{"select 1\n", "select 1\n", "select 1\n", "select 2"}},
+		{"select 1\n  go 2  \nselect 2", []string{"select 1\n", "select 1\n", "select 2"}},
+		{"select 1\nGO 1\nselect 2", []string{"select 1\n", "select 2"}},
+		{"select 1\nGO -- end of the first batch\nselect 2", []string{"select 1\n", "select 2"}},
+		{"select 1\nGO 2 -- twice\nselect 2", []string{"select 1\n", "select 1\n", "select 2"}},
+		{"select 1\nGO--no space\nselect 2", []string{"select 1\n", "select 2"}},
+		// not separators
+		{"select 1\nGO 0\nselect 2", []string{"select 1\nGO 0\nselect 2"}},
+		{"select 1\nGO -1\nselect 2", []string{"select 1\nGO -1\nselect 2"}},
+		{"select 1\nGO x\nselect 2", []string{"select 1\nGO x\nselect 2"}},
+		{"select 1\nGO 2 3\nselect 2", []string{"select 1\nGO 2 3\nselect 2"}},
+		{"select 1\n-- GO 2\nselect 2", []string{"select 1\n-- GO 2\nselect 2"}},
+	} {
+		t.Run(tc.script, func(t *testing.T) {
+			assert.Equal(t, tc.expected, splitBatches(tc.script))
+		})
+	}
+}
+
+func TestFirstLine(t *testing.T) {
+	assert.Equal(t, "select 1", firstLine("\n  \n  select 1\nselect 2"))
+	assert.Equal(t, "", firstLine(" \n"))
+}
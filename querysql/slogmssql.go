@@ -0,0 +1,132 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SlogMSSQLLogger returns a basic RowsLogger suitable for the combination of MS SQL and log/slog.
+// It follows the same conventions as LogrusMSSQLLogger; the level names of logrus are mapped to
+// the closest slog level, and rows with an unknown level are logged at slog.LevelError with
+// the unknown level in the `invalid.level` attribute.
+func SlogMSSQLLogger(logger *slog.Logger, defaultLevel slog.Level, opts ...LoggerOption) RowsLogger {
+	cfg := newLoggerConfig(opts)
+	return func(rows *sql.Rows) error {
+		var logLevel string
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		colTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		info := logSetInfoOf(rows)
+
+		// The first column is the log level by protocol of RowsLogger.
+		fields := make([]interface{}, len(cols))
+		scanPointers := make([]interface{}, len(cols))
+		scanPointers[0] = &logLevel
+		for i := 1; i < len(cols); i++ {
+			scanPointers[i] = &fields[i]
+		}
+
+		eventCol := eventIndex(cols)
+		hadRow := false
+		if cfg.maxAggregatedRows > 0 {
+			entry, read, err := cfg.aggregateRows(rows, info, cols, colTypes)
+			if err != nil {
+				return err
+			}
+			hadRow = read
+			if entry != nil {
+				attrs := []slog.Attr{slog.Int("rows", entry.rows)}
+				for i, col := range entry.tagColumns {
+					attrs = append(attrs, slog.String(col, entry.tagValues[i]))
+				}
+				level := defaultLevel
+				if entry.levelOK {
+					level = slogLevel(entry.level)
+				}
+				logger.LogAttrs(context.Background(), level, entry.table, attrs...)
+			}
+		}
+		// when aggregating the rows have been read above
+		for rows.Next() {
+			hadRow = true
+			if err = rows.Scan(scanPointers...); err != nil {
+				return err
+			}
+
+			attrs := make([]slog.Attr, 0, len(cols))
+			level := slog.LevelError
+			if parsed, err := cfg.parseLevel(logLevel); err == nil {
+				if info.belowMinLevel(parsed) {
+					continue
+				}
+				// slog has no lethal levels, but mark them as for the other loggers
+				parsed, requestedLevel := cfg.nonLethalLevel(parsed)
+				if requestedLevel != "" {
+					attrs = append(attrs, slog.String("requested_level", requestedLevel))
+				}
+				level = slogLevel(parsed)
+			} else {
+				attrs = append(attrs, slog.String("invalid.level", logLevel))
+			}
+			for i, value := range fields {
+				if i == 0 || i == eventCol {
+					continue
+				}
+				if !info.isRedacted(cols[i]) {
+					value, err = cfg.logValue(value, colTypes[i].DatabaseTypeName())
+					if err != nil {
+						return err
+					}
+				}
+				if value == nil && cfg.omitNulls {
+					continue
+				}
+				attrs = append(attrs, slog.Any(cols[i], value))
+			}
+			logger.LogAttrs(context.Background(), level, eventMessage(fields, eventCol), attrs...)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		noRowsLevel := defaultLevel
+		if cfg.noRows == NoRowsLogAtDebug {
+			noRowsLevel = slog.LevelDebug
+		}
+		minLevel, hasMinLevel := info.minLogLevel()
+		if !hadRow && cfg.noRows != NoRowsSuppress && (!hasMinLevel || noRowsLevel >= slogLevel(minLevel)) {
+			// See LogrusMSSQLLogger
+			attrs := []slog.Attr{slog.Bool("_norows", true)}
+			for i, col := range cols {
+				if i == 0 || i == eventCol {
+					continue
+				}
+				attrs = append(attrs, slog.String(col, info.noRowsValue(col)))
+			}
+			logger.LogAttrs(context.Background(), noRowsLevel, "", attrs...)
+		}
+		return nil
+	}
+}
+
+// slogLevel maps a logrus level onto the closest slog level
+func slogLevel(level logrus.Level) slog.Level {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return slog.LevelError
+	case logrus.WarnLevel:
+		return slog.LevelWarn
+	case logrus.InfoLevel:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
@@ -0,0 +1,45 @@
+package querysql_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+func TestSlogMSSQLLogger(t *testing.T) {
+	qry := `
+select _log='info', x = 'hello world', y = 1;
+select _log='warn', m = convert(money, 1.5), id = convert(uniqueidentifier, '00010203-0405-0607-0809-0a0b0c0d0e0f');
+select _log='debug', b = 0x0102;
+select _log='nosuchlevel', x = 'unknown level';
+select _log='info', x = 1 where 1 = 0;
+select 1;
+`
+	var buf bytes.Buffer
+	// omit the time attribute to get predictable output
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	ctx := querysql.WithLogger(context.Background(), querysql.SlogMSSQLLogger(slog.New(handler), slog.LevelInfo))
+
+	require.Equal(t, 1, querysql.MustSingle[int](ctx, sqldb, qry))
+	assert.Equal(t, []string{
+		`level=INFO msg="" x="hello world" y=1`,
+		`level=WARN msg="" m=1.5000 id=00010203-0405-0607-0809-0a0b0c0d0e0f`,
+		`level=DEBUG msg="" b=0x0102`,
+		`level=ERROR msg="" invalid.level=nosuchlevel x="unknown level"`,
+		`level=INFO msg="" _norows=true x=""`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
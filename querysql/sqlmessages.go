@@ -0,0 +1,91 @@
+package querysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"github.com/denisenkom/go-mssqldb/msdsn"
+)
+
+// ForwardSQLMessages makes the go-mssqldb driver of `db` pass the informational messages of queries
+// run by New, i.e. the output of PRINT and of RAISERROR with severity 10 or lower, to the RowsLogger
+// of the query. Each message is logged as an entry at info level with the fields `source=sql.print`
+// and `message`. Errors, including RAISERROR with a higher severity, are returned as usual.
+//
+// The driver only reports messages for connections with the `log` flag 2 set in the connection
+// string, e.g. "sqlserver://host?database=db&log=2", and only to connections opened after the call,
+// so call it right after opening `db`. The driver logger is shared by every *sql.DB using the same
+// driver instance, and replaces any logger set with mssql.SetLogger or mssql.SetContextLogger; what
+// the driver logs outside of queries run by New, or in other categories, is passed on to `next`
+// if it is not nil.
+func ForwardSQLMessages(db *sql.DB, next mssql.ContextLogger) error {
+	driver, ok := db.Driver().(*mssql.Driver)
+	if !ok {
+		return fmt.Errorf("ForwardSQLMessages: the driver of db is %T, not go-mssqldb", db.Driver())
+	}
+	driver.SetContextLogger(sqlMessageLogger{next: next})
+	return nil
+}
+
+// sqlMessageLogger is the driver logger set by ForwardSQLMessages
+type sqlMessageLogger struct {
+	next mssql.ContextLogger
+}
+
+func (l sqlMessageLogger) Log(ctx context.Context, category msdsn.Log, msg string) {
+	if messages, ok := ctx.Value(ckSQLMessages).(*sqlMessages); ok && category == msdsn.LogMessages {
+		messages.add(msg)
+		return
+	}
+	if l.next != nil {
+		l.next.Log(ctx, category, msg)
+	}
+}
+
+// sqlMessages holds the messages the driver has reported for a query until they are logged.
+// The driver reports them from the goroutine reading the response, so they are queued and logged
+// by the goroutine using the ResultSets, as the RowsLogger is never called concurrently.
+type sqlMessages struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (m *sqlMessages) add(msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+}
+
+func (m *sqlMessages) take() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := m.messages
+	m.messages = nil
+	return messages
+}
+
+// withSQLMessages returns the context to run the query of `rs` with, so that messages reported
+// by the driver are queued in rs.messages; see ForwardSQLMessages
+func (rs *ResultSets) withSQLMessages(ctx context.Context) context.Context {
+	if rs.Logger == nil && rs.LoggerCtx == nil {
+		return ctx
+	}
+	rs.messages = &sqlMessages{}
+	return context.WithValue(ctx, ckSQLMessages, rs.messages)
+}
+
+// logSQLMessages logs the messages queued since the last call
+func (rs *ResultSets) logSQLMessages() error {
+	if rs.messages == nil {
+		return nil
+	}
+	for _, msg := range rs.messages.take() {
+		if err := rs.logEntry("info", []string{"source", "message"}, []any{"sql.print", msg}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
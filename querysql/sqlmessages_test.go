@@ -0,0 +1,58 @@
+package querysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denisenkom/go-mssqldb/msdsn"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingDriverLogger struct {
+	messages []string
+}
+
+func (l *recordingDriverLogger) Log(_ context.Context, _ msdsn.Log, msg string) {
+	l.messages = append(l.messages, msg)
+}
+
+func TestSQLMessages(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	next := &recordingDriverLogger{}
+	driverLogger := sqlMessageLogger{next: next}
+	set := &bufferedSet{columns: []string{"x"}, databaseTypes: []string{"INT"}, rows: [][]any{{int64(1)}}}
+
+	ctx := WithLogger(context.Background(), LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	rs := New(ctx, bufferedDB, "buffered set", set)
+	require.NotNil(t, rs.messages)
+	// What the driver would do while reading the response of the query
+	queryCtx := context.WithValue(ctx, ckSQLMessages, rs.messages)
+	driverLogger.Log(queryCtx, msdsn.LogMessages, "before the select")
+	driverLogger.Log(queryCtx, msdsn.LogErrors, "an error")
+	driverLogger.Log(context.Background(), msdsn.LogMessages, "outside querysql")
+
+	x, err := NextResult(rs, SingleOf[int])
+	require.NoError(t, err)
+	assert.Equal(t, 1, x)
+	require.Len(t, hook.AllEntries(), 1)
+	assert.Equal(t, logrus.InfoLevel, hook.LastEntry().Level)
+	assert.Equal(t, "sql.print", hook.LastEntry().Data["source"])
+	assert.Equal(t, "before the select", hook.LastEntry().Data["message"])
+
+	// Messages after the last select are logged on Close
+	driverLogger.Log(queryCtx, msdsn.LogMessages, "after the select")
+	require.NoError(t, rs.Close())
+	require.Len(t, hook.AllEntries(), 2)
+	assert.Equal(t, "after the select", hook.LastEntry().Data["message"])
+
+	assert.Equal(t, []string{"an error", "outside querysql"}, next.messages)
+
+	// Without a logger the messages are not collected
+	assert.Nil(t, New(context.Background(), bufferedDB, "buffered set", set).messages)
+
+	assert.EqualError(t, ForwardSQLMessages(bufferedDB, nil),
+		"ForwardSQLMessages: the driver of db is querysql.bufferedDriver, not go-mssqldb")
+}
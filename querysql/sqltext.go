@@ -0,0 +1,126 @@
+package querysql
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode"
+)
+
+// SQL is query text read from a []byte, an io.Reader or a file, e.g. one embedded with
+// //go:embed. It is passed to NewSQL, SingleSQL, SliceSQL and ExecContextSQL:
+//
+//	//go:embed queries
+//	var queries embed.FS
+//
+//	users, err := querysql.SliceSQL[User](ctx, db, querysql.SQLFile(queries, "queries/users.sql"))
+//
+// Errors reading the text are returned by the query, in the same way as query errors. The name
+// of the file, if known, is given in the echo of the query and in QueryError.
+type SQL struct {
+	text string
+	// name is the file the text was read from, if known
+	name string
+	err  error
+}
+
+// SQLString returns a SQL with the text `text`
+func SQLString(text string) SQL {
+	return SQL{text: text}
+}
+
+// SQLBytes returns a SQL with the text `b`
+func SQLBytes(b []byte) SQL {
+	return SQL{text: string(b)}
+}
+
+// SQLReader returns a SQL with the text read from `r`. If `r` has a Name method,
+// like *os.File, it is used as the name of the SQL.
+func SQLReader(r io.Reader) SQL {
+	var name string
+	if named, ok := r.(interface{ Name() string }); ok {
+		name = named.Name()
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return SQL{name: name, err: readSQLError(name, err)}
+	}
+	return SQL{text: string(b), name: name}
+}
+
+// SQLFile returns a SQL with the text of the file `path` in `fsys`
+func SQLFile(fsys fs.FS, path string) SQL {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return SQL{name: path, err: readSQLError(path, err)}
+	}
+	return SQL{text: string(b), name: path}
+}
+
+func readSQLError(name string, err error) error {
+	if name == "" {
+		return fmt.Errorf("reading SQL: %w", err)
+	}
+	return fmt.Errorf("reading SQL from %s: %w", name, err)
+}
+
+// String returns the query text
+func (q SQL) String() string {
+	return q.text
+}
+
+// Name returns the name of the file the query text was read from, or "" if unknown
+func (q SQL) Name() string {
+	return q.name
+}
+
+// Err returns the error from reading the query text, if any
+func (q SQL) Err() error {
+	return q.err
+}
+
+// describe returns the text of the query prefixed by the name of its file, if known
+func (q SQL) describe() string {
+	if q.name == "" {
+		return q.text
+	}
+	return q.name + ": " + q.text
+}
+
+// emptyErr returns ErrEmptyQuery if the text has nothing but whitespace and comments
+func (q SQL) emptyErr() error {
+	if !isBlankSQL(q.text) {
+		return nil
+	}
+	if q.name != "" {
+		return fmt.Errorf("SQL from %s: %w", q.name, ErrEmptyQuery)
+	}
+	return ErrEmptyQuery
+}
+
+// isBlankSQL tells whether `text` has nothing but whitespace, -- comments and /* */ comments,
+// which nest in T-SQL
+func isBlankSQL(text string) bool {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "/*"):
+			depth++
+			i++
+		case depth > 0 && strings.HasPrefix(text[i:], "*/"):
+			depth--
+			i++
+		case depth > 0:
+		case strings.HasPrefix(text[i:], "--"):
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				return true
+			}
+			i += end
+		case !unicode.IsSpace(rune(text[i])):
+			return false
+		}
+	}
+	return true
+}
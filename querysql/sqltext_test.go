@@ -0,0 +1,111 @@
+package querysql_test
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vippsas/go-querysql/querysql"
+)
+
+//go:embed testdata
+var testdata embed.FS
+
+// The functions taking a string can be passed as values
+var (
+	_ func(context.Context, querysql.CtxQuerier, string, ...any) *querysql.ResultSets = querysql.New
+	_ func(context.Context, querysql.CtxQuerier, string, ...any) (sql.Result, error)  = querysql.ExecContext
+	_ func(context.Context, querysql.CtxQuerier, string, ...any) (int, error)         = querysql.Single[int]
+	_ func(context.Context, querysql.CtxQuerier, querysql.SQL, ...any) ([]int, error) = querysql.SliceSQL[int]
+)
+
+func TestSQLFile(t *testing.T) {
+	var hook LogHook
+	logger := logrus.New()
+	logger.Hooks.Add(&hook)
+	ctx := querysql.WithLogger(context.Background(), querysql.LogrusMSSQLLogger(logger, logrus.InfoLevel))
+	ctx = querysql.WithQueryEcho(ctx)
+
+	x, err := querysql.SingleSQL[int](ctx, sqldb, querysql.SQLFile(testdata, "testdata/sqltext.sql"), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, x)
+	assert.Equal(t, "query.start", hook.lines[0]["event"])
+	assert.Equal(t, "testdata/sqltext.sql: select _log='info', x = 'from file'; select X = @p1 + 1;", hook.lines[0]["query"])
+	assert.Equal(t, logrus.Fields{"x": "from file"}, hook.lines[1])
+
+	xs, err := querysql.SliceSQL[int](ctx, sqldb, querysql.SQLReader(strings.NewReader("select 1 union all select 2")))
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, xs)
+
+	_, err = querysql.ExecContextSQL(ctx, sqldb, querysql.SQLBytes([]byte("select _log='info', x = 'exec'")))
+	require.NoError(t, err)
+}
+
+func TestSQLReadError(t *testing.T) {
+	ctx := context.Background()
+
+	rs := querysql.NewSQL(ctx, sqldb, querysql.SQLFile(testdata, "testdata/missing.sql"))
+	require.Error(t, rs.Err)
+	assert.Equal(t, "reading SQL from testdata/missing.sql: open testdata/missing.sql: file does not exist", rs.Err.Error())
+	assert.Equal(t, rs.Err, querysql.Drain(rs))
+
+	_, err := querysql.SingleSQL[int](ctx, sqldb, querysql.SQLReader(iotest.ErrReader(iotest.ErrTimeout)))
+	assert.Equal(t, "reading SQL: timeout", err.Error())
+}
+
+func TestSQLFileQueryError(t *testing.T) {
+	errQueried := errors.New("queried")
+	fsys := fstest.MapFS{"queries/users.sql": {Data: []byte("select * from Users where ID = @p1")}}
+
+	_, err := querysql.SingleSQL[int](context.Background(), &flakyQuerier{failures: 1, err: errQueried}, querysql.SQLFile(fsys, "queries/users.sql"), 1)
+	assert.ErrorIs(t, err, errQueried)
+	assert.Contains(t, err.Error(), "queries/users.sql")
+	assert.EqualError(t, err, `queried (query "select * from Users where ID = @p1" from queries/users.sql with 1 parameters, at result set 0)`)
+
+	var qerr *querysql.QueryError
+	require.ErrorAs(t, err, &qerr)
+	assert.Equal(t, "queries/users.sql", qerr.File)
+}
+
+func TestEmptyQuery(t *testing.T) {
+	errQueried := errors.New("queried")
+	for _, tc := range []struct {
+		qry   string
+		empty bool
+	}{
+		{"", true},
+		{" \n\t ", true},
+		{"-- just a comment", true},
+		{"-- a comment\n  /* and /* a nested */ comment */\n", true},
+		{"select 1", false},
+		{"-- a comment\nselect 1", false},
+		{"/* a comment */ select 1 -- and another", false},
+		{"/* /* nested */ still a comment */ select 1", false},
+	} {
+		t.Run(tc.qry, func(t *testing.T) {
+			q := &flakyQuerier{failures: 1, err: errQueried}
+			err := querysql.New(context.Background(), q, tc.qry).Err
+			if tc.empty {
+				assert.Equal(t, querysql.ErrEmptyQuery, err)
+				assert.Equal(t, 0, q.calls)
+			} else {
+				assert.ErrorIs(t, err, errQueried)
+				assert.Equal(t, 1, q.calls)
+			}
+		})
+	}
+
+	_, err := querysql.ExecContextSQL(context.Background(), &flakyQuerier{}, querysql.SQLBytes(nil))
+	assert.Equal(t, querysql.ErrEmptyQuery, err)
+	_, err = querysql.ExecContextSQL(context.Background(), &flakyQuerier{}, querysql.SQLFile(testdata, "testdata/empty.sql"))
+	assert.ErrorIs(t, err, querysql.ErrEmptyQuery)
+	assert.EqualError(t, err, "SQL from testdata/empty.sql: "+querysql.ErrEmptyQuery.Error())
+}
@@ -0,0 +1,79 @@
+package querysql
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// StatsdClient is the part of a StatsD client used by StatsdDispatcherFuncs. It is implemented by
+// e.g. the DataDog client in github.com/DataDog/datadog-go/v5/statsd.
+type StatsdClient interface {
+	Incr(name string, tags []string, rate float64) error
+	Gauge(name string, value float64, tags []string, rate float64) error
+	Timing(name string, value time.Duration, tags []string, rate float64) error
+}
+
+// StatsdDispatcherFuncs returns DispatcherFuncs sending the dispatcher selects calling them to
+// `client`:
+//
+//	select _function='statsd.incr', name='payments.captured', tags='region:eu,retry:false'
+//	select _function='statsd.gauge', name='queue.length', value=12, tags=null
+//	select _function='statsd.timing', name='batch.duration', ms=1500, tags='', rate=0.5
+//
+// The tags are a comma-separated string, or NULL for none. The sample rate is an optional last
+// column, defaulting to 1, and the value of statsd.timing is in milliseconds. Errors from
+// `client` follow the OnError policy of the returned DispatcherFuncs, so that e.g. a metrics
+// backend being down does not need to fail the query:
+//
+//	ctx = querysql.WithAdditionalDispatcher(ctx, querysql.StatsdDispatcherFuncs(client).OnError(querysql.DispatchErrorContinue))
+func StatsdDispatcherFuncs(client StatsdClient) *DispatcherFuncs {
+	return NewDispatcherFuncs().
+		Register("statsd.incr", func(name string, tags *string, rate ...float64) error {
+			sampleRate, err := statsdRate(rate)
+			if err != nil {
+				return err
+			}
+			return client.Incr(name, parseStatsdTags(tags), sampleRate)
+		}).
+		Register("statsd.gauge", func(name string, value float64, tags *string, rate ...float64) error {
+			sampleRate, err := statsdRate(rate)
+			if err != nil {
+				return err
+			}
+			return client.Gauge(name, value, parseStatsdTags(tags), sampleRate)
+		}).
+		Register("statsd.timing", func(name string, ms float64, tags *string, rate ...float64) error {
+			sampleRate, err := statsdRate(rate)
+			if err != nil {
+				return err
+			}
+			return client.Timing(name, time.Duration(ms*float64(time.Millisecond)), parseStatsdTags(tags), sampleRate)
+		})
+}
+
+// parseStatsdTags splits the comma-separated `tags`, ignoring spaces and empty tags
+func parseStatsdTags(tags *string) []string {
+	if tags == nil {
+		return nil
+	}
+	var parsed []string
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			parsed = append(parsed, tag)
+		}
+	}
+	return parsed
+}
+
+// statsdRate returns the optional sample rate passed to the functions of StatsdDispatcherFuncs
+func statsdRate(rate []float64) (float64, error) {
+	switch len(rate) {
+	case 0:
+		return 1, nil
+	case 1:
+		return rate[0], nil
+	default:
+		return 0, fmt.Errorf("expected at most one sample rate, got %d", len(rate))
+	}
+}
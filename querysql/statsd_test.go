@@ -0,0 +1,84 @@
+package querysql
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type statsdRecorder struct {
+	calls []string
+	err   error
+}
+
+func (r *statsdRecorder) Incr(name string, tags []string, rate float64) error {
+	r.calls = append(r.calls, fmt.Sprintf("incr %s %v %v", name, tags, rate))
+	return r.err
+}
+
+func (r *statsdRecorder) Gauge(name string, value float64, tags []string, rate float64) error {
+	r.calls = append(r.calls, fmt.Sprintf("gauge %s %v %v %v", name, value, tags, rate))
+	return r.err
+}
+
+func (r *statsdRecorder) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	r.calls = append(r.calls, fmt.Sprintf("timing %s %v %v %v", name, value, tags, rate))
+	return r.err
+}
+
+func TestStatsdDispatcherFuncs(t *testing.T) {
+	client := &statsdRecorder{}
+	dispatchSet := func(rs *ResultSets, set *bufferedSet) error {
+		rows, err := set.Rows()
+		require.NoError(t, err)
+		defer func() { _ = rows.Close() }()
+		rs.Rows = rows
+		return rs.processDispatcherSelect()
+	}
+	rs := &ResultSets{Dispatcher: StatsdDispatcherFuncs(client).Dispatcher()}
+
+	require.NoError(t, dispatchSet(rs, &bufferedSet{
+		columns:       []string{"_function", "name", "tags"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"},
+		rows: [][]any{
+			{"statsd.incr", "payments.captured", "region:eu, retry:false,"},
+			{"statsd.incr", "payments.captured", nil},
+		},
+	}))
+	require.NoError(t, dispatchSet(rs, &bufferedSet{
+		columns:       []string{"_function", "name", "value", "tags"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "DECIMAL", "NVARCHAR"},
+		rows:          [][]any{{"statsd.gauge", "queue.length", []byte("12.5"), "region:eu"}},
+	}))
+	require.NoError(t, dispatchSet(rs, &bufferedSet{
+		columns:       []string{"_function", "name", "ms", "tags", "rate"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "INT", "NVARCHAR", "FLOAT"},
+		rows:          [][]any{{"statsd.timing", "batch.duration", int64(1500), "", 0.5}},
+	}))
+	assert.Equal(t, []string{
+		"incr payments.captured [region:eu retry:false] 1",
+		"incr payments.captured [] 1",
+		"gauge queue.length 12.5 [region:eu] 1",
+		"timing batch.duration 1.5s [] 0.5",
+	}, client.calls)
+
+	// errors from the client follow the error policy
+	client.err = fmt.Errorf("connection refused")
+	set := &bufferedSet{
+		columns:       []string{"_function", "name", "tags"},
+		databaseTypes: []string{"NVARCHAR", "NVARCHAR", "NVARCHAR"},
+		rows:          [][]any{{"statsd.incr", "payments.captured", nil}},
+	}
+	assert.EqualError(t, dispatchSet(rs, set), "result set 0: statsd.incr: connection refused")
+
+	rs = &ResultSets{
+		Logger:     func(rows *sql.Rows) error { return nil },
+		Dispatcher: StatsdDispatcherFuncs(client).OnError(DispatchErrorContinue).Dispatcher(),
+	}
+	require.NoError(t, dispatchSet(rs, set))
+	assert.EqualError(t, rs.DispatchErrors(), "result set 0: statsd.incr: connection refused")
+}
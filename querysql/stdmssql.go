@@ -0,0 +1,162 @@
+package querysql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StdMSSQLLogger returns a basic RowsLogger suitable for the combination of MS SQL and the
+// standard library log package. Each row is printed as a line of key=value pairs, starting
+// with the level and the value of the `_event` column, if any, as the field `event`. Rows with
+// a level that cannot be parsed are logged at info level.
+func StdMSSQLLogger(logger *log.Logger, opts ...LoggerOption) RowsLogger {
+	return StdMSSQLLoggerWithLevel(logger, "info", opts...)
+}
+
+// StdMSSQLLoggerWithLevel is like StdMSSQLLogger, but rows with a level that cannot be parsed,
+// and by default the entries for empty log selects, are logged at `defaultLevel`. It panics if
+// `defaultLevel` is not a valid level.
+func StdMSSQLLoggerWithLevel(logger *log.Logger, defaultLevel string, opts ...LoggerOption) RowsLogger {
+	cfg := newLoggerConfig(opts)
+	defaultLogLevel, err := logrus.ParseLevel(defaultLevel)
+	if err != nil {
+		panic(fmt.Sprintf("StdMSSQLLoggerWithLevel: invalid default level: %s", err))
+	}
+
+	return func(rows *sql.Rows) error {
+		var logLevel string
+
+		cols, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		colTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		info := logSetInfoOf(rows)
+
+		// The first column is the log level by protocol of RowsLogger.
+		fields := make([]interface{}, len(cols))
+		scanPointers := make([]interface{}, len(cols))
+		scanPointers[0] = &logLevel
+		for i := 1; i < len(cols); i++ {
+			scanPointers[i] = &fields[i]
+		}
+
+		eventCol := eventIndex(cols)
+		hadRow := false
+		if cfg.maxAggregatedRows > 0 {
+			entry, read, err := cfg.aggregateRows(rows, info, cols, colTypes)
+			if err != nil {
+				return err
+			}
+			hadRow = read
+			if entry != nil {
+				line := []string{formatStdField("rows", entry.rows)}
+				for i, col := range entry.tagColumns {
+					line = append(line, formatStdField(col, entry.tagValues[i]))
+				}
+				level := defaultLogLevel
+				if entry.levelOK {
+					level = entry.level
+				}
+				// the table follows on the next lines
+				line[len(line)-1] += "\n" + entry.table
+				cfg.stdEmitLogEntry(logger, level, line)
+			}
+		}
+		// when aggregating the rows have been read above
+		for rows.Next() {
+			hadRow = true
+			if err = rows.Scan(scanPointers...); err != nil {
+				return err
+			}
+			parsedLogLevel, err := cfg.parseLevel(logLevel)
+			if err != nil {
+				line := []string{formatStdField("event", "invalid.log.level"), formatStdField("invalid.level", logLevel)}
+				for _, col := range cols {
+					if tag, ok := info.tagValue(col); ok {
+						line = append(line, formatStdField(col, tag))
+					}
+				}
+				cfg.stdEmitLogEntry(logger, logrus.ErrorLevel, line)
+				parsedLogLevel = defaultLogLevel
+			} else if info.belowMinLevel(parsedLogLevel) {
+				continue
+			}
+
+			var line []string
+			if event := eventMessage(fields, eventCol); event != "" {
+				line = append(line, formatStdField("event", event))
+			}
+			for i, value := range fields {
+				if i == 0 || i == eventCol {
+					continue
+				}
+				if !info.isRedacted(cols[i]) {
+					value, err = cfg.logValue(value, colTypes[i].DatabaseTypeName())
+					if err != nil {
+						return err
+					}
+				}
+				if value == nil && cfg.omitNulls {
+					continue
+				}
+				line = append(line, formatStdField(cols[i], value))
+			}
+			cfg.stdEmitLogEntry(logger, parsedLogLevel, line)
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		if noRowsLevel, ok := cfg.noRowsLevel(defaultLogLevel, info); !hadRow && ok {
+			// See LogrusMSSQLLogger
+			line := []string{formatStdField("_norows", true)}
+			for i, col := range cols {
+				if i == 0 || i == eventCol {
+					continue
+				}
+				line = append(line, formatStdField(col, info.noRowsValue(col)))
+			}
+			cfg.stdEmitLogEntry(logger, noRowsLevel, line)
+		}
+		return nil
+	}
+}
+
+// stdEmitLogEntry prints a line with the level followed by `fields`
+func (cfg *loggerConfig) stdEmitLogEntry(logger *log.Logger, level logrus.Level, fields []string) {
+	level, requestedLevel := cfg.nonLethalLevel(level)
+	line := []string{formatStdField("level", level)}
+	if requestedLevel != "" {
+		line = append(line, formatStdField("requested_level", requestedLevel))
+	}
+	line = append(line, fields...)
+	switch level {
+	case logrus.PanicLevel:
+		logger.Panic(strings.Join(line, " "))
+	case logrus.FatalLevel:
+		logger.Fatal(strings.Join(line, " "))
+	default:
+		logger.Print(strings.Join(line, " "))
+	}
+}
+
+// formatStdField formats a field as key=value, quoting the value if needed. NULL values
+// are formatted as null.
+func formatStdField(key string, value any) string {
+	if value == nil {
+		return key + "=null"
+	}
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		s = strconv.Quote(s)
+	}
+	return key + "=" + s
+}
@@ -0,0 +1,71 @@
+package querysql
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdMSSQLLogger(t *testing.T) {
+	var buf bytes.Buffer
+	rs := &ResultSets{Logger: StdMSSQLLoggerWithLevel(log.New(&buf, "", 0), "warning")}
+
+	require.NoError(t, rs.logEntry("info", []string{"x", "y"}, []any{"hello world", 1}))
+	require.NoError(t, rs.logEntry("nosuchlevel", []string{"x"}, []any{"hello"}))
+	empty := &bufferedSet{columns: []string{"_log", "x"}, databaseTypes: []string{"NVARCHAR", "NVARCHAR"}}
+	rows, err := empty.Rows()
+	require.NoError(t, err)
+	require.NoError(t, rs.Logger(rows))
+	require.NoError(t, rows.Close())
+
+	assert.Equal(t, []string{
+		`level=info x="hello world" y=1`,
+		`level=error event=invalid.log.level invalid.level=nosuchlevel`,
+		`level=warning x=hello`,
+		`level=warning _norows=true x=""`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+
+	// The default of StdMSSQLLogger is info
+	buf.Reset()
+	rs.Logger = StdMSSQLLogger(log.New(&buf, "", 0))
+	require.NoError(t, rs.logEntry("nosuchlevel", []string{"x"}, []any{"hello"}))
+	assert.Equal(t, "level=info x=hello", strings.Split(strings.TrimSpace(buf.String()), "\n")[1])
+}
+
+func TestStdMSSQLLoggerInvalidDefaultLevel(t *testing.T) {
+	assert.PanicsWithValue(t, `StdMSSQLLoggerWithLevel: invalid default level: not a valid logrus Level: "loud"`, func() {
+		StdMSSQLLoggerWithLevel(log.Default(), "loud")
+	})
+}
+
+func TestStdMSSQLLoggerNumericLevel(t *testing.T) {
+	var buf bytes.Buffer
+	rs := &ResultSets{Logger: StdMSSQLLogger(log.New(&buf, "", 0))}
+	require.NoError(t, rs.logEntry("1", []string{"x"}, []any{"one"}))
+	require.NoError(t, rs.logEntry("40", []string{"x"}, []any{"forty"}))
+	require.NoError(t, rs.logEntry("7", []string{"x"}, []any{"seven"}))
+	assert.Equal(t, []string{
+		`level=info x=one`,
+		`level=error x=forty`,
+		`level=error event=invalid.log.level invalid.level=7`,
+		`level=info x=seven`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
+
+func TestStdMSSQLLoggerLethalLevels(t *testing.T) {
+	var buf bytes.Buffer
+	rs := &ResultSets{Logger: StdMSSQLLogger(log.New(&buf, "", 0))}
+	require.NotPanics(t, func() {
+		require.NoError(t, rs.logEntry("panic", []string{"x"}, []any{"panic"}))
+	})
+	assert.Equal(t, "level=error requested_level=panic x=panic\n", buf.String())
+
+	rs = &ResultSets{Logger: StdMSSQLLogger(log.New(&buf, "", 0), WithLethalLogLevels())}
+	assert.Panics(t, func() {
+		_ = rs.logEntry("panic", []string{"x"}, []any{"panic"})
+	})
+}
@@ -0,0 +1,2 @@
+select _log='info', x = 'from file';
+select X = @p1 + 1;
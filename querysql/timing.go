@@ -0,0 +1,50 @@
+package querysql
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type queryTiming struct {
+	start time.Time
+	// setStart is when the current result set became current, or zero between sets
+	setStart     time.Time
+	setDurations []time.Duration
+	rows         int64
+}
+
+func newQueryTiming(start time.Time) *queryTiming {
+	return &queryTiming{start: start, setStart: start}
+}
+
+func (t *queryTiming) startSet() {
+	t.setStart = time.Now()
+}
+
+func (t *queryTiming) endSet() {
+	if t.setStart.IsZero() {
+		return
+	}
+	t.setDurations = append(t.setDurations, time.Since(t.setStart))
+	t.setStart = time.Time{}
+}
+
+// endTiming logs the summary of the query, if WithTimingLogs is set on the context
+func (rs *ResultSets) endTiming() error {
+	if rs.timing == nil {
+		return nil
+	}
+	timing := rs.timing
+	rs.timing = nil
+	timing.endSet()
+
+	setDurations := make([]string, len(timing.setDurations))
+	for i, d := range timing.setDurations {
+		setDurations[i] = strconv.FormatInt(d.Milliseconds(), 10)
+	}
+	return rs.logEntry("debug",
+		[]string{"event", "sets", "rows", "duration_ms", "set_durations_ms"},
+		[]any{"query.timing", len(timing.setDurations), timing.rows, time.Since(timing.start).Milliseconds(), strings.Join(setDurations, ",")},
+	)
+}